@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os/user"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/auth"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+// runAPIKeyCommand выполняет команду управления API ключами напрямую в хранилище:
+//
+//	shortener apikey create -scopes shorten,read [-owner uid] [-name text] [флаги сервера]
+//	shortener apikey revoke -id <id> [флаги сервера]
+//	shortener apikey list [флаги сервера]
+//
+// Хранилище определяется конфигурацией сервера: файлом конфигурации, окружением и флагами -f, -d.
+//
+// Работающий сервис находит созданные командой ключи при первом обращении с ними,
+// а отзыв ключа применяет после сигнала SIGHUP. Отзыв через /api/admin/keys действует сразу.
+//
+// Создание и отзыв ключа записываются в журнал аудита сервиса от имени пользователя ОС.
+func runAPIKeyCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: shortener apikey create|revoke|list [flags]")
+	}
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ContinueOnError)
+	scopes := fs.String("scopes", "", "comma separated scopes: "+scopeNames())
+	owner := fs.String("owner", "", "owner uid, new uid is generated if empty")
+	name := fs.String("name", "", "key description")
+	id := fs.String("id", "", "key id")
+	cfg, err := loadCommandConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	urlstorage := storage.NewStorage(cfg.FileStoragePath, cfg.DatabaseDSN)
+	auditLog, ctx := commandAuditLog(cfg.AuditLogPath, cfg.DatabaseDSN)
+
+	switch args[0] {
+	case "create":
+		parsed, err := auth.ParseScopes(*scopes)
+		if err != nil {
+			return err
+		}
+		if *owner == "" {
+			*owner = uuid.NewV4().String()
+		}
+		plain, k, err := apikey.Generate(*name, *owner, parsed)
+		if err != nil {
+			return err
+		}
+		if !urlstorage.PutAPIKey(k) {
+			return errors.New("can not store api key")
+		}
+		k.Hash = ""
+		auditLog.Record(ctx, audit.OpAPIKeyCreate, k.ID, "", audit.State(k))
+		fmt.Printf("id: %s\nowner: %s\napi key: %s\n", k.ID, k.Owner, plain)
+		return nil
+	case "revoke":
+		var before apikey.Key
+		for _, k := range urlstorage.GetAPIKeys() {
+			if k.ID == *id {
+				before = k
+			}
+		}
+		if !urlstorage.RevokeAPIKey(*id) {
+			return fmt.Errorf("can not revoke api key %q", *id)
+		}
+		after := before
+		after.Revoked = true
+		auditLog.Record(ctx, audit.OpAPIKeyRevoke, *id, audit.State(before), audit.State(after))
+		fmt.Println("revoked: " + *id)
+		fmt.Println("send SIGHUP to the running service to apply")
+		return nil
+	case "list":
+		for _, k := range urlstorage.GetAPIKeys() {
+			state := "active"
+			if k.Revoked {
+				state = "revoked"
+			}
+			fmt.Printf("%s\t%s\t%s\t%v\t%s\n", k.ID, k.Owner, state, k.Scopes, k.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown apikey command %q", args[0])
+}
+
+// commandAuditLog открывает журнал аудита сервиса и возвращает контекст, в котором
+// автором операций указан пользователь ОС, а протоколом - командная строка.
+// Если журнал ведется только в памяти сервиса, записывать некуда и возвращается nil.
+func commandAuditLog(filePath string, conndb string) (*audit.Logger, context.Context) {
+	ctx := audit.WithSource(context.Background(), audit.Source{Transport: audit.TransportCLI})
+	if u, err := user.Current(); err == nil {
+		ctx = auth.WithIdentity(ctx, auth.Identity{UID: u.Username})
+	}
+	if filePath == "" && conndb == "" {
+		return nil, ctx
+	}
+	return audit.NewLogger(audit.Open(filePath, conndb)), ctx
+}
+
+func scopeNames() string {
+	names := make([]string, 0, len(auth.AllScopes))
+	for _, s := range auth.AllScopes {
+		names = append(names, string(s))
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/jon69/shorturl/internal/app/config"
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// runConfigCommand выполняет команду работы с конфигурацией:
+//
+//	shortener config print [-format yaml|json|toml] [флаги сервера]
+//
+// Печатает действующие значения всех параметров с учетом файла, окружения и флагов,
+// скрывая секреты. Если конфигурация неверна, она все равно печатается, а ошибки возвращаются.
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: shortener config print [-format yaml|json|toml] [flags]")
+	}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	format := fs.String("format", config.FormatYAML, "output format: yaml, json or toml")
+	loader := config.NewLoader(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	cfg, loadErr := loader.Load(os.Getenv)
+	if err := cfg.Masked().Write(os.Stdout, *format); err != nil {
+		return err
+	}
+	return loadErr
+}
+
+// loadCommandConfig разбирает аргументы команды вместе с флагами сервера и собирает
+// конфигурацию так же, как сервер: файл конфигурации, окружение, затем флаги.
+func loadCommandConfig(fs *flag.FlagSet, args []string) (config.Config, error) {
+	loader := config.NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return config.Config{}, err
+	}
+	return loader.Load(os.Getenv)
+}
+
+// logConfigErrors записывает в журнал каждую ошибку конфигурации отдельно.
+func logConfigErrors(err error) {
+	var errs config.Errors
+	if !errors.As(err, &errs) {
+		logger.Error("invalid configuration", "error", err)
+		return
+	}
+	for _, e := range errs {
+		logger.Error("invalid configuration", "error", e)
+	}
+}
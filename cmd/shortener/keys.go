@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// loadKeyRing загружает набор секретных ключей.
+// Приоритет: файл с набором ключей, затем ключи из переменной окружения или конфигурации.
+// Если файл задан, но еще не существует, он создается со случайным ключом.
+// Если ключи не заданы вовсе, генерируется случайный ключ, действующий до перезапуска.
+func loadKeyRing(secretKeysFile string, secretKey string) (*keyring.KeyRing, error) {
+	if secretKeysFile != "" {
+		keys, err := keyring.Load(secretKeysFile)
+		if err == nil {
+			logger.Info("loaded secret keys", "path", secretKeysFile)
+			return keys, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		keys, err = keyring.Generate()
+		if err != nil {
+			return nil, err
+		}
+		if err := keys.Save(secretKeysFile); err != nil {
+			return nil, err
+		}
+		logger.Info("generated new secret keys file", "path", secretKeysFile)
+		return keys, nil
+	}
+	if secretKey != "" {
+		return keyring.Parse(secretKey)
+	}
+	keys, err := keyring.Generate()
+	if err != nil {
+		return nil, err
+	}
+	logger.Warn("generated new key, cookies will be invalidated on restart")
+	return keys, nil
+}
+
+// runKeysCommand выполняет команду управления ключами:
+//
+//	shortener keys rotate [-k keys.json] [-keep N] [флаги сервера]
+//	shortener keys list [-k keys.json] [флаги сервера]
+//
+// Путь к файлу ключей берется из конфигурации сервера: параметра secret_keys_file
+// файла конфигурации, переменной SECRET_KEYS_FILE или флага -k.
+//
+// Работающие реплики перечитывают файл ключей по сигналу SIGHUP. Сигнал нужно отправить
+// всем репликам, использующим файл, до того как выданные новым ключом токены попадут к ним.
+func runKeysCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: shortener keys rotate|list [-k <path>] [-keep N]")
+	}
+	fs := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	keep := fs.Int("keep", 0, "number of keys to keep after rotation, 0 keeps all")
+	cfg, err := loadCommandConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	path := cfg.SecretKeysFile
+	if path == "" {
+		return errors.New("path to secret keys file is not set (secret_keys_file)")
+	}
+
+	switch args[0] {
+	case "rotate":
+		keys, err := keyring.Load(path)
+		if errors.Is(err, os.ErrNotExist) {
+			keys, err = keyring.Generate()
+			if err == nil {
+				fmt.Println("created new key ring")
+			}
+		} else if err == nil {
+			var id string
+			id, err = keys.Rotate()
+			if err == nil {
+				fmt.Println("new active key: " + id)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if *keep > 0 {
+			for _, id := range keys.Prune(*keep) {
+				fmt.Println("removed key: " + id)
+			}
+		}
+		if err := keys.Save(path); err != nil {
+			return err
+		}
+		fmt.Println("send SIGHUP to the running services to apply")
+		return nil
+	case "list":
+		keys, err := keyring.Load(path)
+		if err != nil {
+			return err
+		}
+		active, _ := keys.Active()
+		for _, id := range keys.IDs() {
+			if id == active {
+				fmt.Println(id + " (active)")
+			} else {
+				fmt.Println(id)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown keys command %q", args[0])
+}
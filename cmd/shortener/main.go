@@ -1,14 +1,22 @@
 package main
 
 import (
-	"crypto/rand"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jon69/shorturl/internal/app/config"
+	"github.com/jon69/shorturl/internal/app/httpsmaker"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/lifecycle"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
 	"github.com/jon69/shorturl/internal/app/server"
+	"github.com/jon69/shorturl/internal/app/tracing"
 )
 
 var (
@@ -17,6 +25,9 @@ var (
 	buildCommit  string
 )
 
+// tracingShutdownTimeout - срок выгрузки накопленных спанов при остановке.
+const tracingShutdownTimeout = 5 * time.Second
+
 func fillIfEmpty(str string) string {
 	if str == "" {
 		str = "N/A"
@@ -24,9 +35,55 @@ func fillIfEmpty(str string) string {
 	return str
 }
 
+// setupLogger настраивает журнал по умолчанию и перенаправляет в него стандартный пакет log.
+func setupLogger(logLevel string, logFormat string) bool {
+	level, err := logger.ParseLevel(logLevel)
+	if err != nil {
+		logger.Error("invalid log level", "error", err)
+		return false
+	}
+	format, err := logger.ParseFormat(logFormat)
+	if err != nil {
+		logger.Error("invalid log format", "error", err)
+		return false
+	}
+	l := logger.New(os.Stderr, format, level)
+	logger.SetDefault(l)
+	log.SetFlags(0)
+	log.SetOutput(logger.StdWriter(l))
+	return true
+}
+
+// main завершает процесс с кодом, полученным от run. Все отложенные действия
+// выполняются в run до завершения процесса.
 func main() {
+	os.Exit(run())
+}
+
+// run разбирает аргументы, запускает сервис и возвращает код завершения процесса.
+func run() int {
 	args := os.Args
 
+	if len(args) > 1 && args[1] == "keys" {
+		if err := runKeysCommand(args[2:]); err != nil {
+			logger.Fatal("command failed", "command", args[1], "error", err)
+		}
+		return lifecycle.ExitOK
+	}
+	if len(args) > 1 && args[1] == "config" {
+		if err := runConfigCommand(args[2:]); err != nil {
+			logConfigErrors(err)
+			return lifecycle.ExitConfig
+		}
+		return lifecycle.ExitOK
+	}
+	if len(args) > 1 && args[1] == "apikey" {
+		if err := runAPIKeyCommand(args[2:]); err != nil {
+			logger.Fatal("command failed", "command", args[1], "error", err)
+		}
+		return lifecycle.ExitOK
+	}
+
 	fmt.Printf("Build version: %s", fillIfEmpty(buildVersion))
 	fmt.Println()
 	fmt.Printf("Build date: %s", fillIfEmpty(buildDate))
@@ -34,89 +91,108 @@ func main() {
 	fmt.Printf("Build commit: %s", fillIfEmpty(buildCommit))
 	fmt.Println()
 
-	log.Printf("Все аргументы запуска: %v\n", args)
-
-	serverAddress := os.Getenv("SERVER_ADDRESS")
-	baseURL := os.Getenv("BASE_URL")
-	filePath := os.Getenv("FILE_STORAGE_PATH")
-	conndb := os.Getenv("DATABASE_DSN")
-	enableHTTPS := os.Getenv("ENABLE_HTTPS")
-	configPath := os.Getenv("CONFIG")
-	confPath := ""
-
-	trustedSubNet := os.Getenv("TRUSTED_SUBNET")
-
-	log.Print("os FILE_STORAGE_PATH=" + filePath)
-	log.Print("os SERVER_ADDRESS=" + serverAddress)
-	log.Print("os BASE_URL=" + baseURL)
-
-	if configPath == "" {
-		flag.StringVar(&configPath, "c", "", "path to config file")
-		flag.StringVar(&confPath, "config", "", "path to config file")
-	}
-	if serverAddress == "" {
-		flag.StringVar(&serverAddress, "a", "127.0.0.1:8080", "server address")
-	}
-	if baseURL == "" {
-		flag.StringVar(&baseURL, "b", "http://127.0.0.1:8080", "base url")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+	cfg, err := loader.Load(os.Getenv)
+	if err != nil {
+		logConfigErrors(err)
+		return lifecycle.ExitConfig
 	}
-	if filePath == "" {
-		flag.StringVar(&filePath, "f", "", "path to file")
+
+	if !setupLogger(cfg.LogLevel, cfg.LogFormat) {
+		return lifecycle.ExitConfig
 	}
-	if conndb == "" {
-		flag.StringVar(&conndb, "d", "", "connection to database")
+
+	serv := server.MakeMyServer()
+	serv.SetBaseURL(cfg.BaseURL)
+	registry, err := cfg.DomainRegistry()
+	if err != nil {
+		logger.Error("can not configure domains", "error", err)
+		return lifecycle.ExitConfig
 	}
-	if enableHTTPS == "" {
-		flag.StringVar(&enableHTTPS, "s", "", "enable HTTPS")
+	serv.SetDomains(registry)
+	serv.SetConnDB(cfg.DatabaseDSN)
+	serv.SetFilePath(cfg.FileStoragePath)
+	serv.SetServerAddr(cfg.ServerAddress)
+	serv.SetGRPCAddress(cfg.GRPCAddress)
+	serv.SetPprofAddress(cfg.PprofAddress)
+	serv.SetEnableHTTPS(cfg.EnableHTTPS)
+	if cfg.EnableHTTPS {
+		tlsConfig, challenge, err := httpsmaker.NewTLSConfig(cfg.TLSOptions())
+		if err != nil {
+			logger.Error("can not configure HTTPS", "error", err)
+			return lifecycle.ExitConfig
+		}
+		serv.SetTLSConfig(tlsConfig)
+		if challenge != nil {
+			serv.SetACMEChallenge(cfg.ACME.HTTPAddress, challenge)
+		}
 	}
-	if trustedSubNet == "" {
-		flag.StringVar(&trustedSubNet, "t", "", "trusted subnet")
+	serv.SetRedirectAddress(cfg.RedirectAddress)
+	serv.SetH2C(cfg.H2C)
+	serv.SetGRPCOnHTTP(cfg.GRPCOnHTTP)
+	serv.SetGRPCReflection(cfg.GRPCReflection)
+	serv.SetCSRFProtection(cfg.CSRFEnabled())
+	serv.SetAdminUIDs(strings.Join(cfg.AdminUIDs, ","))
+	serv.SetAuditLogPath(cfg.AuditLogPath)
+	serv.SetFetchTitles(cfg.FetchTitles)
+	serv.SetTitleFetchTimeout(time.Duration(cfg.TitleFetchTimeout))
+	serv.SetShutdownTimeout(time.Duration(cfg.ShutdownTimeout))
+	serv.SetLimits(cfg.Limits)
+	// по SIGHUP конфигурация собирается заново из тех же источников
+	serv.SetConfigLoader(cfg, func() (config.Config, error) {
+		return loader.Load(os.Getenv)
+	})
+
+	// значения уже проверены в Load, ошибки здесь не ожидаются
+	trusted, err := ipacl.New(cfg.TrustedSubnet, strings.Join(cfg.TrustedProxies, ","))
+	if err != nil {
+		logger.Error("invalid trusted subnets", "error", err)
+		return lifecycle.ExitConfig
 	}
+	serv.SetTrustedPolicy(trusted)
 
-	flag.Parse()
-
-	if configPath == "" {
-		configPath = confPath
+	rules, err := ratelimit.ParseRules(cfg.RateLimitsString())
+	if err != nil {
+		logger.Error("invalid rate limits", "error", err)
+		return lifecycle.ExitConfig
 	}
+	serv.SetRateLimits(rules)
 
-	if configPath != "" {
-		confHandler, err := config.Parse(configPath)
-		if err != nil {
-			log.Printf("can not get confHandler | %s", err.Error())
-			return
-		}
-		serverAddress = confHandler.ServerAddress(serverAddress)
-		baseURL = confHandler.BaseURL(baseURL)
-		filePath = confHandler.FilePath(filePath)
-		conndb = confHandler.DatabaseDNS(conndb)
-		enableHTTPS = confHandler.EnableHTTPS(enableHTTPS)
+	cookieAttrs, err := cfg.CookieAttributes()
+	if err != nil {
+		logger.Error("invalid cookie attributes", "error", err)
+		return lifecycle.ExitConfig
 	}
+	serv.SetCookieAttributes(cookieAttrs)
 
-	serv := server.MakeMyServer()
-	serv.SetBaseURL(baseURL)
-	serv.SetConnDB(conndb)
-	serv.SetFilePath(filePath)
-	serv.SetServerAddr(serverAddress)
-	serv.SetEnableHTTPS(enableHTTPS)
-	serv.SetTrustedSubNet(trustedSubNet)
-
-	key, err := generateRandom(16)
+	keys, err := loadKeyRing(cfg.SecretKeysFile, cfg.SecretKey)
 	if err != nil {
-		log.Println("error to generate new key")
-		return
+		logger.Error("can not load secret keys", "error", err)
+		return lifecycle.ExitConfig
 	}
-	log.Println("generated new key")
-	serv.SetSecretKey(key)
-	serv.RunServers()
-	log.Println("Exit main")
-}
+	serv.SetKeyRing(keys)
 
-func generateRandom(size int) ([]byte, error) {
-	// генерируем случайную последовательность байт
-	b := make([]byte, size)
-	_, err := rand.Read(b)
+	exporter, err := tracing.ParseExporter(cfg.TraceExporter)
+	if err != nil {
+		logger.Error("invalid trace exporter", "error", err)
+		return lifecycle.ExitConfig
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), exporter, cfg.TraceEndpoint, fillIfEmpty(buildVersion))
 	if err != nil {
-		return nil, err
+		logger.Error("can not set up tracing", "error", err)
+		return lifecycle.ExitConfig
 	}
-	return b, nil
+	logger.Info("tracing", "exporter", exporter, "endpoint", cfg.TraceEndpoint)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("can not flush traces", "error", err)
+		}
+	}()
+
+	code := serv.RunServers()
+	logger.Info("exit main", "code", code)
+	return code
 }
@@ -0,0 +1,74 @@
+// Модуль apikey выпускает API ключи для межсервисных клиентов.
+// Сервис хранит только хеши ключей, сам ключ показывается один раз при создании.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/auth"
+)
+
+// Header - заголовок HTTP запроса с API ключом.
+const Header = "X-API-Key"
+
+// MetadataKey - ключ метаданных gRPC с API ключом.
+const MetadataKey = "x-api-key"
+
+// prefix - префикс выдаваемых ключей, облегчает их поиск в утечках.
+const prefix = "sk_"
+
+// Key хранит информацию об API ключе.
+type Key struct {
+	// ID - идентификатор ключа.
+	ID string `json:"id"`
+	// Hash - SHA-256 хеш ключа в шестнадцатеричном виде.
+	Hash string `json:"hash,omitempty"`
+	// Name - описание ключа.
+	Name string `json:"name"`
+	// Owner - идентификатор пользователя, от имени которого действует ключ.
+	Owner string `json:"owner"`
+	// Scopes - права ключа.
+	Scopes []auth.Scope `json:"scopes"`
+	// Created - время создания.
+	Created time.Time `json:"created"`
+	// Revoked - признак отзыва ключа.
+	Revoked bool `json:"revoked"`
+}
+
+// Identity возвращает информацию о клиенте, аутентифицированном ключом.
+func (k Key) Identity() auth.Identity {
+	return auth.Identity{UID: k.Owner, Method: auth.MethodAPIKey, Scopes: k.Scopes, KeyID: k.ID}
+}
+
+// Generate создает новый ключ. Возвращает сам ключ и информацию о нем для хранения.
+func Generate(name string, owner string, scopes []auth.Scope) (string, Key, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", Key{}, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", Key{}, err
+	}
+	plain := prefix + id + "_" + secret
+	k := Key{ID: id, Hash: Hash(plain), Name: name, Owner: owner, Scopes: scopes, Created: time.Now().UTC()}
+	return plain, k, nil
+}
+
+// Hash вычисляет хеш ключа для поиска в хранилище.
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(plain)))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,172 @@
+// Модуль audit ведет журнал всех изменяющих состояние операций.
+// Журнал только дополняется и хранится в отдельном файле, таблице Postgres либо в памяти.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/auth"
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// Transport - протокол, по которому поступил запрос.
+type Transport string
+
+// Протоколы.
+const (
+	// TransportHTTP - HTTP API.
+	TransportHTTP Transport = "http"
+	// TransportGRPC - gRPC API.
+	TransportGRPC Transport = "grpc"
+	// TransportCLI - команды командной строки.
+	TransportCLI Transport = "cli"
+)
+
+// Операции, фиксируемые в журнале.
+const (
+	// OpCreate - создание короткой ссылки.
+	OpCreate = "create"
+	// OpDelete - удаление ссылки.
+	OpDelete = "delete"
+	// OpDisable - блокировка ссылки администратором.
+	OpDisable = "disable"
+	// OpEnable - разблокировка ссылки администратором.
+	OpEnable = "enable"
+	// OpEdit - изменение описания ссылки.
+	OpEdit = "edit"
+	// OpAPIKeyCreate - создание API ключа.
+	OpAPIKeyCreate = "apikey.create"
+	// OpAPIKeyRevoke - отзыв API ключа.
+	OpAPIKeyRevoke = "apikey.revoke"
+)
+
+// Record запись журнала.
+type Record struct {
+	// Time - время операции.
+	Time time.Time `json:"time"`
+	// Actor - идентификатор пользователя, выполнившего операцию.
+	Actor string `json:"actor"`
+	// IP - адрес клиента.
+	IP string `json:"ip"`
+	// Transport - протокол запроса.
+	Transport Transport `json:"transport"`
+	// Operation - операция.
+	Operation string `json:"operation"`
+	// Code - краткая форма URL или идентификатор объекта операции.
+	Code string `json:"code"`
+	// Before - значение до операции.
+	Before string `json:"before,omitempty"`
+	// After - значение после операции.
+	After string `json:"after,omitempty"`
+}
+
+// Filter задает условия выборки записей журнала.
+type Filter struct {
+	// From - начало интервала (включительно), нулевое значение - без ограничения.
+	From time.Time
+	// To - конец интервала (не включительно), нулевое значение - без ограничения.
+	To time.Time
+	// Actor - идентификатор пользователя.
+	Actor string
+	// Limit - максимальное количество записей, 0 - без ограничений.
+	Limit int
+}
+
+// Match проверяет, удовлетворяет ли запись условиям фильтра.
+func (f Filter) Match(rec Record) bool {
+	if !f.From.IsZero() && rec.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !rec.Time.Before(f.To) {
+		return false
+	}
+	return f.Actor == "" || rec.Actor == f.Actor
+}
+
+// Store хранилище записей журнала.
+type Store interface {
+	// Append добавляет запись в журнал.
+	Append(rec Record) error
+	// Query возвращает записи журнала, удовлетворяющие фильтру, в порядке времени.
+	Query(f Filter) ([]Record, error)
+}
+
+// Open открывает хранилище журнала: файл, если задан путь, иначе таблицу БД,
+// если задано подключение, иначе журнал в памяти.
+func Open(filePath string, conndb string) Store {
+	if filePath != "" {
+		return newFileStore(filePath)
+	}
+	if conndb != "" {
+		if s, ok := newDBStore(conndb); ok {
+			return s
+		}
+		logger.Warn("can not open audit log in db, keeping it in memory")
+	}
+	return newMemoryStore()
+}
+
+// Source описывает источник запроса.
+type Source struct {
+	// IP - адрес клиента.
+	IP string
+	// Transport - протокол запроса.
+	Transport Transport
+}
+
+// CTXSource структура для хранения в контексте информации об источнике запроса.
+type CTXSource struct {
+}
+
+// WithSource возвращает контекст с информацией об источнике запроса.
+func WithSource(ctx context.Context, src Source) context.Context {
+	return context.WithValue(ctx, CTXSource{}, src)
+}
+
+// Logger добавляет в журнал записи об операциях, дополняя их сведениями
+// о клиенте и источнике запроса из контекста.
+type Logger struct {
+	// store - хранилище журнала.
+	store Store
+}
+
+// NewLogger создает журнал поверх хранилища.
+func NewLogger(store Store) *Logger {
+	return &Logger{store: store}
+}
+
+// Record добавляет в журнал запись об операции op над объектом code.
+// Ошибка записи в журнал не прерывает операцию, но фиксируется в логе.
+func (l *Logger) Record(ctx context.Context, op string, code string, before string, after string) {
+	if l == nil {
+		return
+	}
+	rec := Record{Time: time.Now().UTC(), Operation: op, Code: code, Before: before, After: after}
+	if id, ok := auth.FromContext(ctx); ok {
+		rec.Actor = id.UID
+	}
+	if src, ok := ctx.Value(CTXSource{}).(Source); ok {
+		rec.IP = src.IP
+		rec.Transport = src.Transport
+	}
+	if err := l.store.Append(rec); err != nil {
+		logger.FromContext(ctx).Error("can not write audit record", "op", op, "error", err)
+	}
+}
+
+// Query возвращает записи журнала, удовлетворяющие фильтру.
+func (l *Logger) Query(f Filter) ([]Record, error) {
+	return l.store.Query(f)
+}
+
+// State возвращает представление объекта для полей Before и After.
+func State(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("can not marshal audit state", "error", err)
+		return ""
+	}
+	return string(data)
+}
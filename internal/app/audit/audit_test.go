@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/auth"
+)
+
+func TestFileStoreQuery(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), "audit.log"), "")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, actor := range []string{"a", "b", "a"} {
+		require.NoError(t, store.Append(Record{Time: start.Add(time.Duration(i) * time.Hour), Actor: actor, Operation: OpCreate}))
+	}
+
+	all, err := store.Query(Filter{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	byActor, err := store.Query(Filter{Actor: "a"})
+	require.NoError(t, err)
+	assert.Len(t, byActor, 2)
+
+	byTime, err := store.Query(Filter{From: start.Add(time.Hour), To: start.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, byTime, 1)
+	assert.Equal(t, "b", byTime[0].Actor)
+
+	last, err := store.Query(Filter{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, last, 1)
+	assert.Equal(t, start.Add(2*time.Hour), last[0].Time)
+}
+
+func TestLoggerRecord(t *testing.T) {
+	l := NewLogger(newMemoryStore())
+	ctx := auth.WithIdentity(context.Background(), auth.Identity{UID: "user-1"})
+	ctx = WithSource(ctx, Source{IP: "10.0.0.1", Transport: TransportGRPC})
+	l.Record(ctx, OpDelete, "42", "before", "after")
+
+	records, err := l.Query(Filter{Actor: "user-1"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "10.0.0.1", records[0].IP)
+	assert.Equal(t, TransportGRPC, records[0].Transport)
+	assert.Equal(t, "42", records[0].Code)
+}
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	dbh "github.com/jon69/shorturl/internal/app/db"
+)
+
+// memoryLimit - максимальное количество записей журнала в памяти.
+const memoryLimit = 10000
+
+// memoryStore хранит последние записи журнала в памяти.
+type memoryStore struct {
+	// mux - мьютекс для синхронизации.
+	mux *sync.RWMutex
+	// records - записи журнала.
+	records []Record
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{mux: &sync.RWMutex{}}
+}
+
+// Append добавляет запись, вытесняя самые старые при превышении лимита.
+func (s *memoryStore) Append(rec Record) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.records = append(s.records, rec)
+	if len(s.records) > memoryLimit {
+		s.records = s.records[len(s.records)-memoryLimit:]
+	}
+	return nil
+}
+
+// Query возвращает записи, удовлетворяющие фильтру.
+func (s *memoryStore) Query(f Filter) ([]Record, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return filter(s.records, f), nil
+}
+
+// fileStore хранит журнал в файле в формате JSON lines.
+type fileStore struct {
+	// mux - мьютекс для синхронизации.
+	mux *sync.Mutex
+	// path - путь к файлу журнала.
+	path string
+}
+
+func newFileStore(path string) *fileStore {
+	return &fileStore{mux: &sync.Mutex{}, path: path}
+}
+
+// Append дописывает запись в конец файла.
+func (s *fileStore) Append(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Query читает файл и возвращает записи, удовлетворяющие фильтру.
+func (s *fileStore) Query(f Filter) ([]Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	file, err := os.OpenFile(s.path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err == nil && f.Match(rec) {
+			records = append(records, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return limit(records, f.Limit), nil
+}
+
+// dbStore хранит журнал в таблице Postgres.
+type dbStore struct {
+	// conndb - параметры подключения к БД.
+	conndb string
+}
+
+func newDBStore(conndb string) (*dbStore, bool) {
+	if !dbh.CreateAuditTable(conndb) {
+		return nil, false
+	}
+	return &dbStore{conndb: conndb}, true
+}
+
+// Append добавляет запись в таблицу.
+func (s *dbStore) Append(rec Record) error {
+	return dbh.InsertAudit(s.conndb, toDB(rec))
+}
+
+// Query выбирает записи из таблицы условиями фильтра.
+func (s *dbStore) Query(f Filter) ([]Record, error) {
+	rows, err := dbh.QueryAudit(s.conndb, f.From, f.To, f.Actor, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, Record{Time: row.Time, Actor: row.Actor, IP: row.IP, Transport: Transport(row.Transport),
+			Operation: row.Operation, Code: row.Code, Before: row.Before, After: row.After})
+	}
+	return records, nil
+}
+
+func toDB(rec Record) dbh.AuditFromDB {
+	return dbh.AuditFromDB{Time: rec.Time, Actor: rec.Actor, IP: rec.IP, Transport: string(rec.Transport),
+		Operation: rec.Operation, Code: rec.Code, Before: rec.Before, After: rec.After}
+}
+
+func filter(records []Record, f Filter) []Record {
+	var result []Record
+	for _, rec := range records {
+		if f.Match(rec) {
+			result = append(result, rec)
+		}
+	}
+	return limit(result, f.Limit)
+}
+
+// limit оставляет не более n последних записей.
+func limit(records []Record, n int) []Record {
+	if n > 0 && len(records) > n {
+		return records[len(records)-n:]
+	}
+	return records
+}
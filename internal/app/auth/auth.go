@@ -0,0 +1,149 @@
+// Модуль auth описывает аутентифицированного клиента и его права.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Scope - право на выполнение группы операций.
+type Scope string
+
+// Права клиентов.
+const (
+	// ScopeShorten - создание коротких ссылок.
+	ScopeShorten Scope = "shorten"
+	// ScopeRead - чтение своих ссылок.
+	ScopeRead Scope = "read"
+	// ScopeDelete - удаление своих ссылок.
+	ScopeDelete Scope = "delete"
+	// ScopeStats - получение статистики сервиса.
+	ScopeStats Scope = "stats"
+	// ScopeAdmin - роль администратора для API ключа.
+	ScopeAdmin Scope = "admin"
+)
+
+// AllScopes - все известные права.
+var AllScopes = []Scope{ScopeShorten, ScopeRead, ScopeDelete, ScopeStats, ScopeAdmin}
+
+// UserScopes - права пользователя, аутентифицированного кукой или токеном.
+var UserScopes = []Scope{ScopeShorten, ScopeRead, ScopeDelete}
+
+// Role - роль клиента.
+type Role string
+
+// Роли клиентов.
+const (
+	// RoleUser - обычный пользователь.
+	RoleUser Role = "user"
+	// RoleAdmin - администратор: модерация ссылок и управление API ключами.
+	RoleAdmin Role = "admin"
+)
+
+// Method - способ аутентификации клиента.
+type Method string
+
+// Способы аутентификации.
+const (
+	// MethodCookie - токен в куке uid.
+	MethodCookie Method = "cookie"
+	// MethodBearer - токен в заголовке Authorization.
+	MethodBearer Method = "bearer"
+	// MethodAPIKey - API ключ в заголовке X-API-Key.
+	MethodAPIKey Method = "apikey"
+)
+
+// Identity хранит информацию об аутентифицированном клиенте.
+type Identity struct {
+	// UID - идентификатор владельца.
+	UID string
+	// Method - способ аутентификации.
+	Method Method
+	// Scopes - права клиента.
+	Scopes []Scope
+	// KeyID - идентификатор API ключа, если клиент аутентифицирован ключом.
+	KeyID string
+	// Role - роль клиента.
+	Role Role
+}
+
+// IsAdmin проверяет, является ли клиент администратором.
+func (id Identity) IsAdmin() bool {
+	return id.Role == RoleAdmin
+}
+
+// Admins - множество идентификаторов пользователей с ролью администратора.
+type Admins map[string]bool
+
+// ParseAdmins разбирает список идентификаторов администраторов, разделенных запятыми.
+func ParseAdmins(str string) Admins {
+	admins := make(Admins)
+	for _, uid := range strings.Split(str, ",") {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			admins[uid] = true
+		}
+	}
+	return admins
+}
+
+// AssignRole назначает клиенту роль: администратором считается пользователь из списка
+// администраторов либо клиент с API ключом, обладающим правом admin.
+func (a Admins) AssignRole(id Identity) Identity {
+	id.Role = RoleUser
+	if a[id.UID] || (id.Method == MethodAPIKey && id.HasScope(ScopeAdmin)) {
+		id.Role = RoleAdmin
+	}
+	return id
+}
+
+// HasScope проверяет наличие у клиента права scope.
+func (id Identity) HasScope(scope Scope) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes разбирает список прав, разделенных запятыми.
+func ParseScopes(str string) ([]Scope, error) {
+	var scopes []Scope
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		known := false
+		for _, s := range AllScopes {
+			if string(s) == item {
+				known = true
+				scopes = append(scopes, s)
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown scope %q", item)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("no scopes given")
+	}
+	return scopes, nil
+}
+
+// CTXIdentity структура для хранения в контексте информации о клиенте.
+type CTXIdentity struct {
+}
+
+// WithIdentity возвращает контекст с информацией о клиенте.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, CTXIdentity{}, id)
+}
+
+// FromContext возвращает информацию о клиенте из контекста.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(CTXIdentity{}).(Identity)
+	return id, ok
+}
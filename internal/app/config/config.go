@@ -1,87 +1,329 @@
-// Модуль config представляет класс для разбора конфигурации.
+// Модуль config собирает конфигурацию сервиса из значений по умолчанию, файла конфигурации,
+// переменных окружения и флагов командной строки.
+//
+// Приоритет источников: флаги > переменные окружения > файл > значения по умолчанию.
+// Файл конфигурации может быть в формате JSON, YAML или TOML, формат определяется по расширению.
 package config
 
 import (
+	"bytes"
 	"encoding/json"
-	"log"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/httpsmaker"
+	"github.com/jon69/shorturl/internal/app/limits"
 )
 
-// ConfigHandler определяет класс управления конфигурацией.
-type ConfigHandler struct {
-	params configParams
+// Форматы файла конфигурации.
+const (
+	// FormatJSON - JSON, расширение .json.
+	FormatJSON = "json"
+	// FormatYAML - YAML, расширения .yaml и .yml.
+	FormatYAML = "yaml"
+	// FormatTOML - TOML, расширение .toml.
+	FormatTOML = "toml"
+)
+
+// Duration - длительность, которая в файле конфигурации задается строкой, например "30s".
+type Duration time.Duration
+
+// UnmarshalText разбирает длительность из строки.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText записывает длительность строкой.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// String возвращает длительность в виде "30s".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Config хранит все настройки сервиса.
+type Config struct {
+	// ServerAddress - адрес (хост:порт) HTTP сервера.
+	ServerAddress string `json:"server_address" yaml:"server_address" toml:"server_address"`
+	// BaseURL - базовый URL для выдачи сокращенных ссылок.
+	BaseURL string `json:"base_url" yaml:"base_url" toml:"base_url"`
+	// Domains - дополнительные домены кратких ссылок со своими пространствами ссылок.
+	Domains []domains.Spec `json:"domains" yaml:"domains" toml:"domains"`
+	// GRPCAddress - адрес (хост:порт) gRPC сервера.
+	GRPCAddress string `json:"grpc_address" yaml:"grpc_address" toml:"grpc_address"`
+	// PprofAddress - адрес (хост:порт) сервера pprof.
+	PprofAddress string `json:"pprof_address" yaml:"pprof_address" toml:"pprof_address"`
+	// FileStoragePath - путь к файлу с адресами.
+	FileStoragePath string `json:"file_storage_path" yaml:"file_storage_path" toml:"file_storage_path"`
+	// DatabaseDSN - параметры подключения к БД.
+	DatabaseDSN string `json:"database_dsn" yaml:"database_dsn" toml:"database_dsn"`
+	// EnableHTTPS - признак использования HTTPS.
+	EnableHTTPS bool `json:"enable_https" yaml:"enable_https" toml:"enable_https"`
+	// TLS - параметры HTTPS.
+	TLS TLS `json:"tls" yaml:"tls" toml:"tls"`
+	// ACME - параметры автоматического получения сертификатов.
+	ACME ACME `json:"acme" yaml:"acme" toml:"acme"`
+	// RedirectAddress - адрес (хост:порт) HTTP сервера, перенаправляющего на HTTPS, пустой отключает его.
+	RedirectAddress string `json:"redirect_address" yaml:"redirect_address" toml:"redirect_address"`
+	// H2C - признак поддержки HTTP/2 без TLS.
+	H2C bool `json:"h2c" yaml:"h2c" toml:"h2c"`
+	// GRPCOnHTTP - признак обслуживания gRPC на порту HTTP сервера, требует HTTP/2 (HTTPS или h2c).
+	GRPCOnHTTP bool `json:"grpc_on_http" yaml:"grpc_on_http" toml:"grpc_on_http"`
+	// GRPCReflection - признак регистрации сервиса рефлексии gRPC.
+	GRPCReflection bool `json:"grpc_reflection" yaml:"grpc_reflection" toml:"grpc_reflection"`
+	// SecretKeysFile - путь к файлу с набором секретных ключей.
+	SecretKeysFile string `json:"secret_keys_file" yaml:"secret_keys_file" toml:"secret_keys_file"`
+	// SecretKey - секретные ключи подписи в виде строки "id:hex,...".
+	SecretKey string `json:"secret_key" yaml:"secret_key" toml:"secret_key"`
+	// CSRFProtection - признак проверки CSRF токена, по умолчанию включена.
+	CSRFProtection bool `json:"csrf_protection" yaml:"csrf_protection" toml:"csrf_protection"`
+	// Cookie - атрибуты выдаваемых кук.
+	Cookie Cookie `json:"cookie" yaml:"cookie" toml:"cookie"`
+	// AdminUIDs - идентификаторы пользователей с ролью администратора.
+	AdminUIDs []string `json:"admin_uids" yaml:"admin_uids" toml:"admin_uids"`
+	// AuditLogPath - путь к файлу журнала аудита.
+	AuditLogPath string `json:"audit_log_path" yaml:"audit_log_path" toml:"audit_log_path"`
+	// FetchTitles - признак загрузки заголовков страниц для новых ссылок без заголовка.
+	FetchTitles bool `json:"fetch_titles" yaml:"fetch_titles" toml:"fetch_titles"`
+	// TitleFetchTimeout - время ожидания страницы при загрузке заголовка.
+	TitleFetchTimeout Duration `json:"title_fetch_timeout" yaml:"title_fetch_timeout" toml:"title_fetch_timeout"`
+	// TrustedSubnet - доверенные подсети IPv4 и IPv6 через запятую.
+	TrustedSubnet string `json:"trusted_subnet" yaml:"trusted_subnet" toml:"trusted_subnet"`
+	// TrustedProxies - адреса или подсети прокси, чьим заголовкам X-Forwarded-For и X-Real-IP можно доверять.
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies" toml:"trusted_proxies"`
+	// RateLimits - ограничения частоты запросов по маршрутам, например {"shorten": "10/s:20"}.
+	RateLimits map[string]string `json:"rate_limits" yaml:"rate_limits" toml:"rate_limits"`
+	// Limits - ограничения на размер запросов.
+	Limits limits.Limits `json:"limits" yaml:"limits" toml:"limits"`
+	// LogLevel - уровень журнала: debug, info, warn или error.
+	LogLevel string `json:"log_level" yaml:"log_level" toml:"log_level"`
+	// LogFormat - формат журнала: logfmt или json.
+	LogFormat string `json:"log_format" yaml:"log_format" toml:"log_format"`
+	// TraceExporter - способ экспорта спанов: none, otlp или stdout.
+	TraceExporter string `json:"trace_exporter" yaml:"trace_exporter" toml:"trace_exporter"`
+	// TraceEndpoint - адрес коллектора OTLP.
+	TraceEndpoint string `json:"trace_endpoint" yaml:"trace_endpoint" toml:"trace_endpoint"`
+	// ShutdownTimeout - срок остановки сервиса.
+	ShutdownTimeout Duration `json:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// Cookie хранит атрибуты выдаваемых кук.
+type Cookie struct {
+	// Secure - передавать куку только по HTTPS, по умолчанию включено при HTTPS.
+	Secure *bool `json:"secure,omitempty" yaml:"secure,omitempty" toml:"secure,omitempty"`
+	// HTTPOnly - запретить доступ к куке из JavaScript.
+	HTTPOnly *bool `json:"http_only,omitempty" yaml:"http_only,omitempty" toml:"http_only,omitempty"`
+	// SameSite - политика SameSite: lax, strict или none.
+	SameSite string `json:"same_site" yaml:"same_site" toml:"same_site"`
+	// Path - путь куки.
+	Path string `json:"path" yaml:"path" toml:"path"`
+	// Domain - домен куки.
+	Domain string `json:"domain" yaml:"domain" toml:"domain"`
+	// MaxAge - время жизни куки в секундах.
+	MaxAge int `json:"max_age" yaml:"max_age" toml:"max_age"`
+}
+
+// TLS хранит параметры HTTPS.
+type TLS struct {
+	// CertFile - путь к файлу сертификата в формате PEM, перечитывается при изменении.
+	CertFile string `json:"cert_file" yaml:"cert_file" toml:"cert_file"`
+	// KeyFile - путь к файлу ключа в формате PEM, перечитывается при изменении.
+	KeyFile string `json:"key_file" yaml:"key_file" toml:"key_file"`
+	// MinVersion - минимальная версия TLS: 1.2 или 1.3.
+	MinVersion string `json:"min_version" yaml:"min_version" toml:"min_version"`
+	// CipherSuites - разрешенные шифры TLS 1.2, по умолчанию набор стандартной библиотеки.
+	CipherSuites []string `json:"cipher_suites" yaml:"cipher_suites" toml:"cipher_suites"`
+	// SelfSigned - режим разработки с самоподписанным сертификатом.
+	SelfSigned bool `json:"self_signed" yaml:"self_signed" toml:"self_signed"`
+	// SelfSignedHosts - имена и адреса самоподписанного сертификата.
+	SelfSignedHosts []string `json:"self_signed_hosts" yaml:"self_signed_hosts" toml:"self_signed_hosts"`
+}
+
+// ACME хранит параметры автоматического получения сертификатов по протоколу ACME.
+type ACME struct {
+	// Enabled - получать и продлевать сертификаты автоматически.
+	Enabled bool `json:"enabled" yaml:"enabled" toml:"enabled"`
+	// DirectoryURL - адрес каталога ACME, по умолчанию Let's Encrypt.
+	DirectoryURL string `json:"directory_url" yaml:"directory_url" toml:"directory_url"`
+	// CAFile - корневые сертификаты сервера ACME, например тестового Pebble.
+	CAFile string `json:"ca_file" yaml:"ca_file" toml:"ca_file"`
+	// CacheDir - каталог для ключа учетной записи и полученных сертификатов.
+	CacheDir string `json:"cache_dir" yaml:"cache_dir" toml:"cache_dir"`
+	// Email - контактный адрес учетной записи.
+	Email string `json:"email" yaml:"email" toml:"email"`
+	// Hosts - имена для сертификатов, по умолчанию хост из base_url.
+	Hosts []string `json:"hosts" yaml:"hosts" toml:"hosts"`
+	// HTTPAddress - адрес сервера проверок HTTP-01, пустой отключает HTTP-01.
+	HTTPAddress string `json:"http_address" yaml:"http_address" toml:"http_address"`
 }
 
-// Parse открывает файл конфигурации и парсит его содержимое.
-func Parse(configPath string) (ConfigHandler, error) {
-	cfg := ConfigHandler{}
-	log.Printf("opening config file %s", configPath)
-	data, err := os.ReadFile(configPath)
+// Default возвращает конфигурацию по умолчанию.
+func Default() Config {
+	attrs := cookie.DefaultAttributes()
+	return Config{
+		ServerAddress:   "127.0.0.1:8080",
+		BaseURL:         "http://127.0.0.1:8080",
+		GRPCAddress:     ":8082",
+		PprofAddress:    ":6060",
+		TLS:             TLS{MinVersion: "1.2", SelfSignedHosts: httpsmaker.DefaultSelfSignedHosts},
+		ACME:            ACME{DirectoryURL: httpsmaker.DefaultACMEDirectory, CacheDir: "acme-cache", HTTPAddress: ":80"},
+		CSRFProtection:  true,
+		Cookie:          Cookie{SameSite: "lax", Path: attrs.Path, MaxAge: attrs.MaxAge},
+		Limits:          limits.Default(),
+		LogLevel:        "info",
+		LogFormat:       "logfmt",
+		TraceExporter:   "none",
+		ShutdownTimeout: Duration(30 * time.Second),
+		// совпадает с titles.DefaultTimeout
+		TitleFetchTimeout: Duration(10 * time.Second),
+	}
+}
+
+// FormatOf определяет формат файла конфигурации по расширению.
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("unknown config file format %q, expected .json, .yaml, .yml or .toml", filepath.Ext(path))
+}
+
+// LoadFile дополняет cfg значениями из файла конфигурации. Параметры, отсутствующие в файле,
+// не изменяются. Неизвестные параметры считаются ошибкой.
+func LoadFile(path string, cfg *Config) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Printf("can not open file | %s", err.Error())
-		return cfg, err
+		return err
+	}
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	case FormatYAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	case FormatTOML:
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), cfg)
+		if err == nil {
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown field %q", undecoded[0].String())
+			}
+		}
 	}
-	err = json.Unmarshal(data, &cfg.params)
 	if err != nil {
-		log.Printf("can not Unmarshal json | %s", err.Error())
-		return cfg, err
+		return fmt.Errorf("%s: %w", path, err)
 	}
-	return cfg, nil
+	return nil
 }
 
-// ServerAddress возвращает адрес сервера.
-func (h *ConfigHandler) ServerAddress(serverAddress string) string {
-	if serverAddress != "" {
-		return serverAddress
+// RateLimitsString возвращает ограничения частоты запросов в виде "route=limit,...".
+func (c *Config) RateLimitsString() string {
+	routes := make([]string, 0, len(c.RateLimits))
+	for route := range c.RateLimits {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	rules := make([]string, 0, len(routes))
+	for _, route := range routes {
+		rules = append(rules, route+"="+c.RateLimits[route])
 	}
-	return h.params.Addr
+	return strings.Join(rules, ",")
 }
 
-// BaseURL возвращает базовый URL.
-func (h *ConfigHandler) BaseURL(baseURL string) string {
-	if baseURL != "" {
-		return baseURL
-	}
-	return h.params.BaseURL
+// CSRFEnabled сообщает, проверяется ли CSRF токен. При SameSite=None браузер отправляет куку
+// и с запросами с чужих сайтов, поэтому проверка включается независимо от csrf_protection.
+func (c *Config) CSRFEnabled() bool {
+	return c.CSRFProtection || strings.EqualFold(c.Cookie.SameSite, "none")
 }
 
-// FilePath возвращает путь к файлу с адресами.
-func (h *ConfigHandler) FilePath(filePath string) string {
-	if filePath != "" {
-		return filePath
+// CookieAttributes возвращает атрибуты выдаваемых кук.
+func (c *Config) CookieAttributes() (cookie.Attributes, error) {
+	optBool := func(v *bool) string {
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(*v)
 	}
-	return h.params.FileStoragePath
+	maxAge := ""
+	if c.Cookie.MaxAge != 0 {
+		maxAge = fmt.Sprint(c.Cookie.MaxAge)
+	}
+	return cookie.ParseAttributes(optBool(c.Cookie.Secure), optBool(c.Cookie.HTTPOnly), c.Cookie.SameSite,
+		c.Cookie.Path, c.Cookie.Domain, maxAge, c.EnableHTTPS)
 }
 
-// DatabaseDNS возвращает адрес БД.
-func (h *ConfigHandler) DatabaseDNS(conndb string) string {
-	if conndb != "" {
-		return conndb
+// TLSOptions возвращает параметры HTTPS.
+func (c *Config) TLSOptions() httpsmaker.Options {
+	return httpsmaker.Options{
+		CertFile:        c.TLS.CertFile,
+		KeyFile:         c.TLS.KeyFile,
+		MinVersion:      c.TLS.MinVersion,
+		CipherSuites:    c.TLS.CipherSuites,
+		SelfSigned:      c.TLS.SelfSigned,
+		SelfSignedHosts: c.TLS.SelfSignedHosts,
+		ACME: httpsmaker.ACMEOptions{
+			Enabled:      c.ACME.Enabled,
+			DirectoryURL: c.ACME.DirectoryURL,
+			CAFile:       c.ACME.CAFile,
+			CacheDir:     c.ACME.CacheDir,
+			Email:        c.ACME.Email,
+			Hosts:        c.ACMEHosts(),
+		},
 	}
-	return h.params.DatabaseDNS
 }
 
-// EnableHTTPS возвращает признак использования https.
-func (h *ConfigHandler) EnableHTTPS(enableHTTPS string) string {
-	if enableHTTPS != "" {
-		return enableHTTPS
+// ACMEHosts возвращает имена для сертификатов ACME: заданные явно или хосты из base_url и domains.
+func (c *Config) ACMEHosts() []string {
+	if len(c.ACME.Hosts) > 0 {
+		return c.ACME.Hosts
 	}
-	if h.params.EnableHTTPS {
-		return "true"
+	var hosts []string
+	for _, str := range append([]string{c.BaseURL}, c.domainURLs()...) {
+		if u, err := url.Parse(str); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
 	}
-	return ""
-}
-
-// configParams храние информацию о парамтрах конфигурации.
-type configParams struct {
-	// server_address - адрес сервера.
-	Addr string `json:"server_address"`
-	// base_url - базовый URL.
-	BaseURL string `json:"base_url"`
-	// file_storage_path - путь к файлу с адресами.
-	FileStoragePath string `json:"file_storage_path"`
-	// database_dsn - адрес БД.
-	DatabaseDNS string `json:"database_dsn"`
-	// enable_https - признак использования https.
-	EnableHTTPS bool `json:"enable_https"`
+	return hosts
+}
+
+// domainURLs возвращает базовые URL дополнительных доменов.
+func (c *Config) domainURLs() []string {
+	urls := make([]string, len(c.Domains))
+	for i, d := range c.Domains {
+		urls[i] = d.URL
+	}
+	return urls
+}
+
+// DomainRegistry создает реестр доменов из base_url и domains.
+func (c *Config) DomainRegistry() (*domains.Registry, error) {
+	return domains.New(c.BaseURL, c.Domains)
 }
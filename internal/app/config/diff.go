@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// Diff возвращает отсортированные имена параметров, значения которых различаются в a и b.
+// Вложенные параметры именуются через точку, например cookie.same_site.
+func Diff(a, b Config) []string {
+	fa, fb := flatten(a), flatten(b)
+	keys := make(map[string]bool)
+	for k := range fa {
+		keys[k] = true
+	}
+	for k := range fb {
+		keys[k] = true
+	}
+	var changed []string
+	for k := range keys {
+		if !reflect.DeepEqual(fa[k], fb[k]) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// flatten возвращает значения параметров по именам. Ограничения частоты запросов и списки
+// сравниваются целиком, вложенными считаются только группы cookie, limits, tls и acme.
+func flatten(c Config) map[string]interface{} {
+	data, _ := json.Marshal(c)
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	flat := make(map[string]interface{})
+	for k, v := range m {
+		if group, ok := v.(map[string]interface{}); ok && (k == "cookie" || k == "limits" || k == "tls" || k == "acme") {
+			for gk, gv := range group {
+				flat[k+"."+gk] = gv
+			}
+			continue
+		}
+		flat[k] = v
+	}
+	return flat
+}
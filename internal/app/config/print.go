@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// dsnPassword находит пароль в параметрах подключения вида "host=... password=...".
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// maskDSN скрывает пароль в параметрах подключения к БД, оставляя остальные параметры.
+func maskDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.Host != "" {
+		// в URL пароль заменяется на xxxxx, как в url.URL.Redacted
+		q := u.Query()
+		if q.Has("password") {
+			q.Set("password", "xxxxx")
+			u.RawQuery = q.Encode()
+		}
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+logger.Redacted)
+}
+
+// Masked возвращает копию конфигурации со скрытыми секретами: паролем БД и ключами подписи.
+func (c Config) Masked() Config {
+	c.DatabaseDSN = maskDSN(c.DatabaseDSN)
+	if c.SecretKey != "" {
+		c.SecretKey = logger.Redacted
+	}
+	return c
+}
+
+// Write записывает конфигурацию в w в формате format: json, yaml или toml.
+func (c Config) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	case FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+		return enc.Close()
+	case FormatTOML:
+		return toml.NewEncoder(w).Encode(c)
+	}
+	return fmt.Errorf("unknown config format %q, expected json, yaml or toml", format)
+}
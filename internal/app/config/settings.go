@@ -0,0 +1,332 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/domains"
+)
+
+// EnvConfig - переменная окружения с путем к файлу конфигурации.
+const EnvConfig = "CONFIG"
+
+// setting описывает параметр, задаваемый переменной окружения и флагом.
+type setting struct {
+	// key - имя параметра в файле конфигурации.
+	key string
+	// env - имя переменной окружения.
+	env string
+	// flag - имя флага командной строки.
+	flag string
+	// usage - описание флага.
+	usage string
+	// set - разбирает значение и записывает его в конфигурацию.
+	set func(c *Config, v string) error
+}
+
+func stringVar(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func boolVar(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// legacyBoolVar разбирает логическое значение, как прежний флаг -s: кроме true и false
+// допускается любое непустое значение, которое означает true (например, -s yes или ENABLE_HTTPS=on).
+func legacyBoolVar(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			b = v != ""
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func optBoolVar(field func(c *Config) **bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*field(c) = &b
+		return nil
+	}
+}
+
+func intVar(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func int64Var(field func(c *Config) *int64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func listVar(field func(c *Config) *[]string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func durationVar(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
+
+// setRateLimits разбирает ограничения частоты запросов вида "route=limit,...".
+func setRateLimits(c *Config, v string) error {
+	rules := make(map[string]string)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid rate limit %q, expected route=limit", item)
+		}
+		rules[strings.TrimSpace(route)] = strings.TrimSpace(limit)
+	}
+	c.RateLimits = rules
+	return nil
+}
+
+// setDomains разбирает дополнительные домены вида "url[=uid|uid],...".
+func setDomains(c *Config, v string) error {
+	var specs []domains.Spec
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		u, owners, _ := strings.Cut(item, "=")
+		spec := domains.Spec{URL: strings.TrimSpace(u)}
+		for _, uid := range strings.Split(owners, "|") {
+			if uid = strings.TrimSpace(uid); uid != "" {
+				spec.Owners = append(spec.Owners, uid)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	c.Domains = specs
+	return nil
+}
+
+// settings - все параметры, задаваемые переменными окружения и флагами.
+var settings = []setting{
+	{"server_address", "SERVER_ADDRESS", "a", "server address",
+		stringVar(func(c *Config) *string { return &c.ServerAddress })},
+	{"base_url", "BASE_URL", "b", "base url",
+		stringVar(func(c *Config) *string { return &c.BaseURL })},
+	{"domains", "DOMAINS", "domains", "additional short link domains, e.g. https://sho.rt=uid1|uid2,https://go.example",
+		setDomains},
+	{"grpc_address", "GRPC_ADDRESS", "grpc-address", "gRPC server address",
+		stringVar(func(c *Config) *string { return &c.GRPCAddress })},
+	{"pprof_address", "PPROF_ADDRESS", "pprof-address", "pprof server address",
+		stringVar(func(c *Config) *string { return &c.PprofAddress })},
+	{"file_storage_path", "FILE_STORAGE_PATH", "f", "path to file",
+		stringVar(func(c *Config) *string { return &c.FileStoragePath })},
+	{"database_dsn", "DATABASE_DSN", "d", "connection to database",
+		stringVar(func(c *Config) *string { return &c.DatabaseDSN })},
+	{"enable_https", "ENABLE_HTTPS", "s", "enable HTTPS, any non-empty value except false means true",
+		legacyBoolVar(func(c *Config) *bool { return &c.EnableHTTPS })},
+	{"tls.cert_file", "TLS_CERT_FILE", "tls-cert", "path to TLS certificate file, reloaded on change",
+		stringVar(func(c *Config) *string { return &c.TLS.CertFile })},
+	{"tls.key_file", "TLS_KEY_FILE", "tls-key", "path to TLS key file, reloaded on change",
+		stringVar(func(c *Config) *string { return &c.TLS.KeyFile })},
+	{"tls.min_version", "TLS_MIN_VERSION", "tls-min-version", "minimum TLS version: 1.2 or 1.3",
+		stringVar(func(c *Config) *string { return &c.TLS.MinVersion })},
+	{"tls.cipher_suites", "TLS_CIPHER_SUITES", "tls-ciphers", "comma separated TLS 1.2 cipher suites",
+		listVar(func(c *Config) *[]string { return &c.TLS.CipherSuites })},
+	{"tls.self_signed", "TLS_SELF_SIGNED", "tls-self-signed", "use a generated self-signed certificate, for development only",
+		boolVar(func(c *Config) *bool { return &c.TLS.SelfSigned })},
+	{"tls.self_signed_hosts", "TLS_SELF_SIGNED_HOSTS", "tls-self-signed-hosts", "comma separated names and addresses of the self-signed certificate",
+		listVar(func(c *Config) *[]string { return &c.TLS.SelfSignedHosts })},
+	{"acme.enabled", "ACME_ENABLED", "acme", "obtain and renew certificates over ACME",
+		boolVar(func(c *Config) *bool { return &c.ACME.Enabled })},
+	{"acme.directory_url", "ACME_DIRECTORY_URL", "acme-directory", "ACME directory url, default Let's Encrypt",
+		stringVar(func(c *Config) *string { return &c.ACME.DirectoryURL })},
+	{"acme.ca_file", "ACME_CA_FILE", "acme-ca", "root certificates of the ACME server, e.g. for Pebble",
+		stringVar(func(c *Config) *string { return &c.ACME.CAFile })},
+	{"acme.cache_dir", "ACME_CACHE_DIR", "acme-cache", "directory for the ACME account key and certificates",
+		stringVar(func(c *Config) *string { return &c.ACME.CacheDir })},
+	{"acme.email", "ACME_EMAIL", "acme-email", "ACME account contact email",
+		stringVar(func(c *Config) *string { return &c.ACME.Email })},
+	{"acme.hosts", "ACME_HOSTS", "acme-hosts", "comma separated certificate hosts, default the base url host",
+		listVar(func(c *Config) *[]string { return &c.ACME.Hosts })},
+	{"acme.http_address", "ACME_HTTP_ADDRESS", "acme-http-address", "HTTP-01 challenge server address, empty disables HTTP-01",
+		stringVar(func(c *Config) *string { return &c.ACME.HTTPAddress })},
+	{"redirect_address", "REDIRECT_ADDRESS", "redirect-address", "HTTP server address redirecting to HTTPS, empty disables it",
+		stringVar(func(c *Config) *string { return &c.RedirectAddress })},
+	{"h2c", "ENABLE_H2C", "h2c", "enable HTTP/2 without TLS",
+		boolVar(func(c *Config) *bool { return &c.H2C })},
+	{"grpc_on_http", "GRPC_ON_HTTP", "grpc-on-http", "serve gRPC on the HTTP server port too, requires HTTPS or h2c",
+		boolVar(func(c *Config) *bool { return &c.GRPCOnHTTP })},
+	{"grpc_reflection", "GRPC_REFLECTION", "r", "enable gRPC reflection",
+		boolVar(func(c *Config) *bool { return &c.GRPCReflection })},
+	{"secret_keys_file", "SECRET_KEYS_FILE", "k", "path to secret keys file",
+		stringVar(func(c *Config) *string { return &c.SecretKeysFile })},
+	{"secret_key", "SECRET_KEY", "secret-key", "secret signing keys as id:hex,...",
+		stringVar(func(c *Config) *string { return &c.SecretKey })},
+	{"csrf_protection", "CSRF_PROTECTION", "csrf", "enable CSRF protection, always on with cookie.same_site=none",
+		boolVar(func(c *Config) *bool { return &c.CSRFProtection })},
+	{"cookie.secure", "COOKIE_SECURE", "cookie-secure", "send cookies over HTTPS only, default true with HTTPS",
+		optBoolVar(func(c *Config) **bool { return &c.Cookie.Secure })},
+	{"cookie.http_only", "COOKIE_HTTP_ONLY", "cookie-http-only", "hide cookies from JavaScript",
+		optBoolVar(func(c *Config) **bool { return &c.Cookie.HTTPOnly })},
+	{"cookie.same_site", "COOKIE_SAME_SITE", "cookie-same-site", "cookie SameSite policy: lax, strict or none",
+		stringVar(func(c *Config) *string { return &c.Cookie.SameSite })},
+	{"cookie.path", "COOKIE_PATH", "cookie-path", "cookie path",
+		stringVar(func(c *Config) *string { return &c.Cookie.Path })},
+	{"cookie.domain", "COOKIE_DOMAIN", "cookie-domain", "cookie domain",
+		stringVar(func(c *Config) *string { return &c.Cookie.Domain })},
+	{"cookie.max_age", "COOKIE_MAX_AGE", "cookie-max-age", "cookie max age in seconds",
+		intVar(func(c *Config) *int { return &c.Cookie.MaxAge })},
+	{"admin_uids", "ADMIN_UIDS", "admins", "comma separated admin uids",
+		listVar(func(c *Config) *[]string { return &c.AdminUIDs })},
+	{"audit_log_path", "AUDIT_LOG_PATH", "audit", "path to audit log file",
+		stringVar(func(c *Config) *string { return &c.AuditLogPath })},
+	{"fetch_titles", "FETCH_TITLES", "fetch-titles", "fetch page titles for new links without a title",
+		boolVar(func(c *Config) *bool { return &c.FetchTitles })},
+	{"title_fetch_timeout", "TITLE_FETCH_TIMEOUT", "title-fetch-timeout", "page title fetch timeout",
+		durationVar(func(c *Config) *Duration { return &c.TitleFetchTimeout })},
+	{"trusted_subnet", "TRUSTED_SUBNET", "t", "comma separated trusted subnets",
+		stringVar(func(c *Config) *string { return &c.TrustedSubnet })},
+	{"trusted_proxies", "TRUSTED_PROXIES", "proxies", "comma separated trusted proxies",
+		listVar(func(c *Config) *[]string { return &c.TrustedProxies })},
+	{"rate_limits", "RATE_LIMITS", "rate-limits", "rate limits, e.g. redirect=100/s:200,shorten=10/s,batch=1/s,delete=5/s",
+		setRateLimits},
+	{"limits.max_body_bytes", "MAX_BODY_SIZE", "max-body-size", "max request body size in bytes",
+		int64Var(func(c *Config) *int64 { return &c.Limits.MaxBodyBytes })},
+	{"limits.max_decoded_bytes", "MAX_DECODED_BODY_SIZE", "max-decoded-body-size", "max decompressed request body size in bytes",
+		int64Var(func(c *Config) *int64 { return &c.Limits.MaxDecodedBytes })},
+	{"limits.max_url_length", "MAX_URL_LENGTH", "max-url-length", "max length of a shortened url",
+		intVar(func(c *Config) *int { return &c.Limits.MaxURLLength })},
+	{"limits.max_batch_size", "MAX_BATCH_SIZE", "max-batch-size", "max number of urls in a batch request",
+		intVar(func(c *Config) *int { return &c.Limits.MaxBatchSize })},
+	{"log_level", "LOG_LEVEL", "log-level", "log level: debug, info, warn or error",
+		stringVar(func(c *Config) *string { return &c.LogLevel })},
+	{"log_format", "LOG_FORMAT", "log-format", "log format: logfmt or json",
+		stringVar(func(c *Config) *string { return &c.LogFormat })},
+	{"trace_exporter", "TRACE_EXPORTER", "trace-exporter", "trace exporter: none, otlp or stdout",
+		stringVar(func(c *Config) *string { return &c.TraceExporter })},
+	{"trace_endpoint", "TRACE_ENDPOINT", "trace-endpoint", "OTLP collector address, default localhost:4317",
+		stringVar(func(c *Config) *string { return &c.TraceEndpoint })},
+	{"shutdown_timeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout", "graceful shutdown timeout",
+		durationVar(func(c *Config) *Duration { return &c.ShutdownTimeout })},
+}
+
+// Errors - ошибки конфигурации, собранные со всех параметров.
+type Errors []error
+
+// Error перечисляет ошибки через точку с запятой.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Loader регистрирует флаги всех параметров и собирает по ним конфигурацию.
+type Loader struct {
+	// fs - набор флагов.
+	fs *flag.FlagSet
+	// path - путь к файлу конфигурации из флагов -c и -config.
+	path string
+	// values - значения флагов по именам.
+	values map[string]*string
+}
+
+// NewLoader регистрирует в fs флаги всех параметров и флаги -c и -config с путем к файлу конфигурации.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{fs: fs, values: make(map[string]*string)}
+	fs.StringVar(&l.path, "c", "", "path to config file (.json, .yaml, .yml or .toml)")
+	fs.StringVar(&l.path, "config", "", "path to config file (.json, .yaml, .yml or .toml)")
+	for _, s := range settings {
+		l.values[s.flag] = fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	return l
+}
+
+// Load собирает конфигурацию после разбора флагов: значения по умолчанию дополняются файлом
+// конфигурации, затем непустыми переменными окружения из getenv, затем явно заданными флагами.
+// Ошибки разбора и проверки всех параметров возвращаются вместе, как Errors.
+func (l *Loader) Load(getenv func(string) string) (Config, error) {
+	cfg := Default()
+	var errs Errors
+
+	path := l.path
+	if path == "" {
+		path = getenv(EnvConfig)
+	}
+	if path != "" {
+		if err := LoadFile(path, &cfg); err != nil {
+			errs = append(errs, fmt.Errorf("config file: %w", err))
+		}
+	}
+
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(&cfg, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s (env %s): %w", s.key, s.env, err))
+			}
+		}
+	}
+
+	set := make(map[string]bool)
+	l.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range settings {
+		if set[s.flag] {
+			if err := s.set(&cfg, *l.values[s.flag]); err != nil {
+				errs = append(errs, fmt.Errorf("%s (flag -%s): %w", s.key, s.flag, err))
+			}
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
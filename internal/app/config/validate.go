@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/jon69/shorturl/internal/app/httpsmaker"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
+	"github.com/jon69/shorturl/internal/app/tracing"
+)
+
+// Validate проверяет все параметры и возвращает ошибки всех неверных параметров как Errors.
+func (c *Config) Validate() error {
+	if errs := c.validate(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) validate() Errors {
+	var errs Errors
+	check := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	check("server_address", validateAddress(c.ServerAddress))
+	check("grpc_address", validateAddress(c.GRPCAddress))
+	check("pprof_address", validateAddress(c.PprofAddress))
+	if err := validateBaseURL(c.BaseURL); err != nil {
+		check("base_url", err)
+	} else {
+		_, err = c.DomainRegistry()
+		check("domains", err)
+	}
+	check("tls", c.validateTLS())
+	if c.RedirectAddress != "" {
+		if !c.EnableHTTPS {
+			check("redirect_address", fmt.Errorf("requires enable_https"))
+		} else {
+			check("redirect_address", validateAddress(c.RedirectAddress))
+		}
+	}
+	if c.GRPCOnHTTP && !c.EnableHTTPS && !c.H2C {
+		check("grpc_on_http", fmt.Errorf("requires HTTP/2, enable enable_https or h2c"))
+	}
+	if c.ACME.Enabled && c.ACME.HTTPAddress != "" {
+		check("acme.http_address", validateAddress(c.ACME.HTTPAddress))
+	}
+	if c.SecretKey != "" {
+		_, err := keyring.Parse(c.SecretKey)
+		check("secret_key", err)
+	}
+	_, err := c.CookieAttributes()
+	check("cookie", err)
+	_, err = ipacl.New(c.TrustedSubnet, strings.Join(c.TrustedProxies, ","))
+	check("trusted_subnet", err)
+	_, err = ratelimit.ParseRules(c.RateLimitsString())
+	check("rate_limits", err)
+	check("limits", c.Limits.Validate())
+	_, err = logger.ParseLevel(c.LogLevel)
+	check("log_level", err)
+	_, err = logger.ParseFormat(c.LogFormat)
+	check("log_format", err)
+	_, err = tracing.ParseExporter(c.TraceExporter)
+	check("trace_exporter", err)
+	if c.ShutdownTimeout <= 0 {
+		check("shutdown_timeout", fmt.Errorf("must be positive, got %s", c.ShutdownTimeout))
+	}
+	if c.TitleFetchTimeout <= 0 {
+		check("title_fetch_timeout", fmt.Errorf("must be positive, got %s", c.TitleFetchTimeout))
+	}
+	return errs
+}
+
+// validateTLS проверяет параметры HTTPS. Источник сертификата (файлы, ACME или самоподписанный)
+// обязателен, только если HTTPS включен.
+func (c *Config) validateTLS() error {
+	if c.EnableHTTPS {
+		return c.TLSOptions().Validate()
+	}
+	if _, err := httpsmaker.ParseMinVersion(c.TLS.MinVersion); err != nil {
+		return err
+	}
+	_, err := httpsmaker.ParseCipherSuites(c.TLS.CipherSuites)
+	return err
+}
+
+// validateAddress проверяет адрес вида хост:порт.
+func validateAddress(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateBaseURL проверяет, что базовый URL абсолютный и использует HTTP или HTTPS.
+func validateBaseURL(str string) error {
+	u, err := url.Parse(str)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an absolute http or https url, got %q", str)
+	}
+	return nil
+}
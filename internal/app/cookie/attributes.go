@@ -0,0 +1,91 @@
+package cookie
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Attributes хранит атрибуты выдаваемых кук.
+type Attributes struct {
+	// Path - путь, для которого действует кука.
+	Path string
+	// Domain - домен, для которого действует кука.
+	Domain string
+	// MaxAge - время жизни куки в секундах.
+	MaxAge int
+	// Secure - передавать куку только по HTTPS.
+	Secure bool
+	// HTTPOnly - запретить доступ к куке из JavaScript.
+	HTTPOnly bool
+	// SameSite - политика отправки куки при межсайтовых запросах.
+	SameSite http.SameSite
+}
+
+// DefaultAttributes возвращает атрибуты кук по умолчанию.
+func DefaultAttributes() Attributes {
+	return Attributes{
+		Path:     "/",
+		MaxAge:   int(TokenTTL.Seconds()),
+		HTTPOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// New создает куку с заданными именем, значением и атрибутами.
+func (a Attributes) New(name string, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     a.Path,
+		Domain:   a.Domain,
+		MaxAge:   a.MaxAge,
+		Secure:   a.Secure,
+		HttpOnly: a.HTTPOnly,
+		SameSite: a.SameSite,
+	}
+}
+
+// ParseAttributes разбирает строковые значения атрибутов кук.
+// Пустые значения оставляют атрибуты по умолчанию.
+// Признак secure по умолчанию включается, если сервер работает по HTTPS.
+func ParseAttributes(secure, httpOnly, sameSite, path, domain, maxAge string, https bool) (Attributes, error) {
+	a := DefaultAttributes()
+	a.Secure = https
+	var err error
+	if secure != "" {
+		if a.Secure, err = strconv.ParseBool(secure); err != nil {
+			return a, fmt.Errorf("cookie secure: %w", err)
+		}
+	}
+	if httpOnly != "" {
+		if a.HTTPOnly, err = strconv.ParseBool(httpOnly); err != nil {
+			return a, fmt.Errorf("cookie http only: %w", err)
+		}
+	}
+	switch strings.ToLower(sameSite) {
+	case "":
+	case "lax":
+		a.SameSite = http.SameSiteLaxMode
+	case "strict":
+		a.SameSite = http.SameSiteStrictMode
+	case "none":
+		if !a.Secure {
+			return a, fmt.Errorf("cookie same site none requires secure cookies")
+		}
+		a.SameSite = http.SameSiteNoneMode
+	default:
+		return a, fmt.Errorf("cookie same site: unknown value %q", sameSite)
+	}
+	if path != "" {
+		a.Path = path
+	}
+	a.Domain = domain
+	if maxAge != "" {
+		if a.MaxAge, err = strconv.Atoi(maxAge); err != nil {
+			return a, fmt.Errorf("cookie max age: %w", err)
+		}
+	}
+	return a, nil
+}
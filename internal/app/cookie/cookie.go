@@ -1,82 +1,68 @@
-// Модуль server представляет абстрацию сервера по обработке запросов.
+// Модуль cookie выдает и проверяет подписанные токены пользователей, передаваемые в куке uid.
 package cookie
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
-	"log"
-	"strings"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
+
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/token"
 )
 
-// GetNewSignedCookie получить новую подписанную куку.
-func GetNewSignedCookie(secretKey []byte) (string, string, string) {
+// Name - имя куки с токеном пользователя.
+const Name = "uid"
+
+// TokenTTL - срок действия выдаваемого токена.
+var TokenTTL = 30 * 24 * time.Hour
+
+// RefreshBefore - за сколько до окончания срока действия токен перевыпускается.
+var RefreshBefore = 7 * 24 * time.Hour
+
+// GetNewSignedCookie получить новую подписанную куку для нового пользователя.
+func GetNewSignedCookie(keys *keyring.KeyRing) (string, string, string) {
 	// создаем новый идентификатор
 	myuuid := uuid.NewV4()
-	log.Println("new UUID is: ", myuuid.String())
+	logger.Debug("generated new uid", "uid", myuuid.String())
 
-	name := "uid"
-	val := myuuid.String()
+	return Name, SignUID(keys, myuuid.String()), myuuid.String()
+}
 
-	mac := hmac.New(sha256.New, secretKey)
-	mac.Write([]byte(name))
-	mac.Write([]byte(val))
-	signature := mac.Sum(nil)
-	signatureHEX := hex.EncodeToString(signature)
-	// Prepend the cookie value with the HMAC signature.
-	val = signatureHEX + "-" + val
-	return name, val, myuuid.String()
+// SignUID выпускает новый токен для существующего пользователя, подписанный активным ключом.
+func SignUID(keys *keyring.KeyRing, uid string) string {
+	kid, secretKey := keys.Active()
+	return token.Issue(secretKey, kid, uid, TokenTTL)
 }
 
-// ValidateCookie проверить подписанную куку.
-func ValidateCookie(secretKey []byte, name string, val string) (bool, string) {
-	// A SHA256 HMAC signature has a fixed length of 32 bytes. To avoid a potential
-	// 'index out of range' panic in the next step, we need to check sure that the
-	// length of the signed cookie value is at least this long. We'll use the
-	// sha256.Size constant here, rather than 32, just because it makes our code
-	// a bit more understandable at a glance.
-	signedValue := val
-	if len(signedValue) < 4 {
-		return false, ""
+// Validate проверяет токен любым ключом из набора и возвращает содержащуюся в нем информацию.
+func Validate(keys *keyring.KeyRing, val string) (token.Claims, bool) {
+	claims, err := token.Parse(val, keys.Key)
+	if err != nil {
+		logger.Debug("token not valid", "error", err)
+		return claims, false
 	}
+	return claims, true
+}
 
-	i := strings.Index(signedValue, "-")
-	if i == -1 {
-		log.Println("not found: - ")
-		return false, ""
+// NeedRefresh проверяет, пора ли перевыпустить токен.
+// Токен, подписанный неактивным ключом, перевыпускается, чтобы старые ключи можно было удалить.
+func NeedRefresh(keys *keyring.KeyRing, claims token.Claims) bool {
+	if kid, _ := keys.Active(); kid != claims.KeyID {
+		return true
 	}
+	return claims.ExpiresWithin(RefreshBefore)
+}
 
-	log.Println("i=", i)
-
-	// Split apart the signature and original cookie value.
-	signatureHEX := signedValue[:i]
-	value := signedValue[i+1:]
-
-	log.Println("signature=", signatureHEX)
-	log.Println("value=", value)
-
-	signature, err := hex.DecodeString(signatureHEX)
-	if err != nil {
-		log.Println("error to decode hex signature")
+// ValidateCookie проверить подписанную куку.
+func ValidateCookie(keys *keyring.KeyRing, name string, val string) (bool, string) {
+	if name != Name {
+		logger.Warn("unexpected cookie name", "name", name)
 		return false, ""
 	}
-
-	// Recalculate the HMAC signature of the cookie name and original value.
-	mac := hmac.New(sha256.New, secretKey)
-	mac.Write([]byte(name))
-	mac.Write([]byte(value))
-	expectedSignature := mac.Sum(nil)
-
-	// Check that the recalculated signature matches the signature we received
-	// in the cookie. If they match, we can be confident that the cookie name
-	// and value haven't been edited by the client.
-	if !hmac.Equal(signature, expectedSignature) {
-		log.Println("cookie not equal")
+	claims, ok := Validate(keys, val)
+	if !ok {
 		return false, ""
 	}
-	log.Println("cookie equal")
-	// Return the original cookie value.
-	return true, value
+	return true, claims.UID
 }
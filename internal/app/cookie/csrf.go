@@ -0,0 +1,93 @@
+package cookie
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// CSRFCookieName - имя куки с CSRF токеном.
+const CSRFCookieName = "csrf_token"
+
+// CSRFHeader - заголовок, в котором клиент повторяет значение CSRF токена.
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRFFormField - поле HTML формы, в котором браузер без JavaScript повторяет значение CSRF токена.
+const CSRFFormField = "csrf_token"
+
+// csrfKey - ключ контекста с CSRF токеном, выданным в ответе на запрос.
+type csrfKey struct{}
+
+// WithCSRFToken возвращает контекст с токеном, выданным клиенту в ответе на текущий запрос.
+func WithCSRFToken(ctx context.Context, tok string) context.Context {
+	return context.WithValue(ctx, csrfKey{}, tok)
+}
+
+// CSRFToken возвращает CSRF токен клиента: из куки или выданный в ответе на текущий запрос.
+func CSRFToken(r *http.Request) string {
+	if c, err := r.Cookie(CSRFCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	tok, _ := r.Context().Value(csrfKey{}).(string)
+	return tok
+}
+
+// NewCSRFToken создает новый случайный CSRF токен.
+func NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CheckCSRF проверяет, что токен из заголовка X-CSRF-Token или, если заголовка нет,
+// из поля csrf_token формы совпадает с токеном из куки (схема double-submit cookie).
+func CheckCSRF(r *http.Request) bool {
+	c, err := r.Cookie(CSRFCookieName)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	tok := r.Header.Get(CSRFHeader)
+	if tok == "" {
+		tok = formToken(r)
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(tok)) == 1
+}
+
+// formToken возвращает значение поля csrf_token из тела формы application/x-www-form-urlencoded.
+// Прочитанное тело возвращается в запрос, чтобы его мог прочитать обработчик.
+func formToken(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" || r.Body == nil || r.Header.Get("Content-Encoding") != "" {
+		return ""
+	}
+	b, err := io.ReadAll(r.Body)
+	// при ошибке чтения, например превышении размера, обработчик получит ту же ошибку
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return ""
+	}
+	return values.Get(CSRFFormField)
+}
+
+// CSRFCookie создает куку с CSRF токеном. Кука доступна из JavaScript,
+// чтобы клиент мог скопировать ее значение в заголовок.
+func (a Attributes) CSRFCookie(value string) *http.Cookie {
+	c := a.New(CSRFCookieName, value)
+	c.HttpOnly = false
+	return c
+}
@@ -0,0 +1,114 @@
+package dbh
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// APIKeyFromDB хранит информацию об API ключе, считанную из БД.
+type APIKeyFromDB struct {
+	// ID - идентификатор ключа.
+	ID string
+	// Hash - хеш ключа.
+	Hash string
+	// Name - описание ключа.
+	Name string
+	// Owner - идентификатор владельца.
+	Owner string
+	// Scopes - права ключа через запятую.
+	Scopes string
+	// Created - время создания.
+	Created time.Time
+	// Revoked - признак отзыва.
+	Revoked bool
+}
+
+// createAPIKeysTable создает таблицу API ключей, если ее еще нет.
+func createAPIKeysTable(db *sql.DB) bool {
+	queryCreate := `CREATE TABLE IF NOT EXISTS public.apikeys (
+						id text primary key,
+						hash text unique,
+						name text,
+						owner text,
+						scopes text,
+						created timestamptz,
+						revoked boolean default false)`
+	_, err := db.Exec(queryCreate)
+	if err != nil {
+		logger.Error("can not exec query", "query", queryCreate, "error", err)
+		return false
+	}
+	return true
+}
+
+// InsertAPIKey добавляет в БД запись об API ключе.
+func InsertAPIKey(conn string, k APIKeyFromDB) bool {
+	db, errOpen := sql.Open("postgres", conn)
+	if errOpen != nil {
+		logger.Error("can not connect to db", "func", "InsertAPIKey", "error", errOpen)
+		return false
+	}
+	defer db.Close()
+
+	queryInsert := `INSERT INTO public.apikeys (id, hash, name, owner, scopes, created, revoked) VALUES ($1,$2,$3,$4,$5,$6,$7)`
+	_, err := db.Exec(queryInsert, k.ID, k.Hash, k.Name, k.Owner, k.Scopes, k.Created, k.Revoked)
+	if err != nil {
+		logger.Error("can not exec query", "func", "InsertAPIKey", "query", queryInsert, "error", err)
+		return false
+	}
+	return true
+}
+
+// RevokeAPIKey помечает API ключ в БД как отозванный.
+func RevokeAPIKey(conn string, id string) bool {
+	db, errOpen := sql.Open("postgres", conn)
+	if errOpen != nil {
+		logger.Error("can not connect to db", "func", "RevokeAPIKey", "error", errOpen)
+		return false
+	}
+	defer db.Close()
+
+	queryRevoke := `UPDATE public.apikeys SET revoked=true WHERE id=$1`
+	_, err := db.Exec(queryRevoke, id)
+	if err != nil {
+		logger.Error("can not exec query", "func", "RevokeAPIKey", "query", queryRevoke, "error", err)
+		return false
+	}
+	return true
+}
+
+// ReadAPIKeys считывает из БД все API ключи.
+func ReadAPIKeys(conn string) ([]APIKeyFromDB, bool) {
+	var ret []APIKeyFromDB
+	db, errOpen := sql.Open("postgres", conn)
+	if errOpen != nil {
+		logger.Error("can not connect to db", "func", "ReadAPIKeys", "error", errOpen)
+		return ret, false
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, hash, name, owner, scopes, created, revoked FROM public.apikeys")
+	if err != nil {
+		logger.Error("can not select", "func", "ReadAPIKeys", "error", err)
+		return ret, false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k APIKeyFromDB
+		err = rows.Scan(&k.ID, &k.Hash, &k.Name, &k.Owner, &k.Scopes, &k.Created, &k.Revoked)
+		if err != nil {
+			logger.Error("can not scan row", "func", "ReadAPIKeys", "error", err)
+			return ret, false
+		}
+		ret = append(ret, k)
+	}
+	err = rows.Err()
+	if err != nil {
+		logger.Error("can not read rows", "func", "ReadAPIKeys", "error", err)
+		return ret, false
+	}
+	return ret, true
+}
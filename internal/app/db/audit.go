@@ -0,0 +1,116 @@
+package dbh
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// AuditFromDB хранит запись журнала аудита.
+type AuditFromDB struct {
+	// Time - время операции.
+	Time time.Time
+	// Actor - идентификатор пользователя.
+	Actor string
+	// IP - адрес клиента.
+	IP string
+	// Transport - протокол запроса.
+	Transport string
+	// Operation - операция.
+	Operation string
+	// Code - объект операции.
+	Code string
+	// Before - значение до операции.
+	Before string
+	// After - значение после операции.
+	After string
+}
+
+// CreateAuditTable создает таблицу журнала аудита, если ее еще нет.
+func CreateAuditTable(conn string) bool {
+	db, err := sql.Open("postgres", conn)
+	if err != nil {
+		logger.Error("can not connect to db", "func", "CreateAuditTable", "error", err)
+		return false
+	}
+	defer db.Close()
+
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS public.audit_log (
+			id bigserial primary key,
+			ts timestamptz not null,
+			actor text,
+			ip text,
+			transport text,
+			operation text,
+			code text,
+			before text,
+			after text)`,
+		`CREATE INDEX IF NOT EXISTS audit_log_ts ON public.audit_log (ts)`,
+		`CREATE INDEX IF NOT EXISTS audit_log_actor ON public.audit_log (actor, ts)`,
+	}
+	for _, query := range queries {
+		if _, err = db.Exec(query); err != nil {
+			logger.Error("can not exec query", "func", "CreateAuditTable", "query", query, "error", err)
+			return false
+		}
+	}
+	return true
+}
+
+// InsertAudit добавляет запись в журнал аудита.
+func InsertAudit(conn string, rec AuditFromDB) error {
+	db, err := sql.Open("postgres", conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := `INSERT INTO public.audit_log (ts, actor, ip, transport, operation, code, before, after)
+				VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
+	_, err = db.Exec(query, rec.Time, rec.Actor, rec.IP, rec.Transport, rec.Operation, rec.Code, rec.Before, rec.After)
+	return err
+}
+
+// QueryAudit выбирает записи журнала аудита за интервал времени [from, to) и по пользователю.
+// Нулевые значения параметров не ограничивают выборку.
+func QueryAudit(conn string, from time.Time, to time.Time, actor string, limit int) ([]AuditFromDB, error) {
+	db, err := sql.Open("postgres", conn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT ts, actor, ip, transport, operation, code, before, after FROM (
+				SELECT * FROM public.audit_log
+				WHERE ($1::timestamptz IS NULL OR ts >= $1)
+				  AND ($2::timestamptz IS NULL OR ts < $2)
+				  AND ($3 = '' OR actor = $3)
+				ORDER BY ts DESC, id DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	query += `) AS last ORDER BY ts, id`
+
+	rows, err := db.Query(query, nullTime(from), nullTime(to), actor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []AuditFromDB
+	for rows.Next() {
+		var rec AuditFromDB
+		if err = rows.Scan(&rec.Time, &rec.Actor, &rec.IP, &rec.Transport, &rec.Operation, &rec.Code, &rec.Before, &rec.After); err != nil {
+			return nil, err
+		}
+		ret = append(ret, rec)
+	}
+	return ret, rows.Err()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,59 @@
+package dbh
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/tracing"
+)
+
+// ClickDelta хранит количество переходов по ссылке, еще не записанное в БД.
+type ClickDelta struct {
+	// Domain - пространство ссылок домена.
+	Domain string
+	// Code - краткая форма URL.
+	Code string
+	// Count - количество новых переходов.
+	Count uint64
+}
+
+// AddClicks увеличивает в БД счетчики переходов по ссылкам одной транзакцией.
+func AddClicks(ctx context.Context, conn string, deltas []ClickDelta) bool {
+	db, errOpen := sql.Open("postgres", conn)
+	if errOpen != nil {
+		logger.Error("can not connect to db", "func", "AddClicks", "error", errOpen)
+		return false
+	}
+	defer db.Close()
+
+	queryAdd := `UPDATE public.shorturls SET clicks=clicks+$3 WHERE domain=$1 AND shorturl=$2`
+
+	ctx, span := startSpan(ctx, "db.AddClicks", queryAdd)
+	err := addClicks(ctx, db, queryAdd, deltas)
+	tracing.End(span, err == nil)
+	if err != nil {
+		logger.Error("can not exec query", "func", "AddClicks", "query", queryAdd, "error", err)
+		return false
+	}
+	return true
+}
+
+func addClicks(ctx context.Context, db *sql.DB, query string, deltas []ClickDelta) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, d := range deltas {
+		if _, err := stmt.ExecContext(ctx, d.Domain, d.Code, int64(d.Count)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -2,29 +2,65 @@
 package dbh
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/tracing"
 )
 
+// startSpan начинает клиентский спан запроса query к БД.
+func startSpan(ctx context.Context, name string, query string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatement(query)))
+}
+
 // Ping проверяет есть ли подключение к БД.
 func Ping(conn string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), PingTimeout)
+	defer cancel()
+	if err := PingContext(ctx, conn); err != nil {
+		logger.Error("can not connect to db", "error", err)
+		return false
+	}
+	return true
+}
+
+// PingTimeout - время ожидания ответа БД в Ping.
+const PingTimeout = 2 * time.Second
+
+// PingContext устанавливает соединение с БД и проверяет, что она отвечает, не дольше срока действия ctx.
+func PingContext(ctx context.Context, conn string) error {
+	ctx, span := startSpan(ctx, "db.Ping", "")
+	defer span.End()
 	db, err := sql.Open("postgres", conn)
 	if err != nil {
-		log.Println("Error connect to db: " + err.Error())
-		return false
+		return err
 	}
 	defer db.Close()
-	return true
+	return db.PingContext(ctx)
+}
+
+// Ready проверяет готовность БД к работе.
+// Если подключение к БД не задано, хранилище считается готовым.
+func Ready(conn string) bool {
+	if conn == "" {
+		return true
+	}
+	return Ping(conn)
 }
 
 // CreateIfNotExist создает структуру в БД, если ее там еще нет.
 func CreateIfNotExist(conn string) bool {
-	log.Println("CreateIfNotExist")
+	logger.Debug("creating db structure")
 	db, err := sql.Open("postgres", conn)
 	if err != nil {
-		log.Println("Error connect to db: " + err.Error())
+		logger.Error("can not connect to db", "error", err)
 		return false
 	}
 	defer db.Close()
@@ -35,74 +71,167 @@ func CreateIfNotExist(conn string) bool {
 	row := db.QueryRow(queryCheck)
 	err = row.Scan(&exist)
 	if err != nil {
-		log.Println("Error exec query [" + queryCheck + "]: " + err.Error())
+		logger.Error("can not exec query", "query", queryCheck, "error", err)
 		return false
 	}
 	// если нет, создаем
 	if !exist {
-		log.Println("table does not exist, creating...")
+		logger.Info("table does not exist, creating", "table", "public.shorturls")
 		queryCreate := "CREATE TABLE public.shorturls (uid bigserial, url bytea, originurl text unique, shorturl text, del boolean default false)"
 		_, err = db.Exec(queryCreate)
 		if err != nil {
-			log.Println("Error exec query [" + queryCreate + "]: " + err.Error())
+			logger.Error("can not exec query", "query", queryCreate, "error", err)
 			return false
 		}
 	} else {
-		log.Println("table exist")
+		logger.Debug("table exists", "table", "public.shorturls")
+	}
+	if !migrate(db) {
+		return false
+	}
+	return createAPIKeysTable(db)
+}
+
+// migrations - изменения структуры таблицы shorturls, добавленные после ее создания.
+var migrations = []string{
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS disabled boolean default false",
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS reason text default ''",
+	// у каждого домена собственное пространство ссылок, исходный URL уникален в пределах домена
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS domain text NOT NULL default ''",
+	"ALTER TABLE public.shorturls DROP CONSTRAINT IF EXISTS shorturls_originurl_key",
+	"CREATE UNIQUE INDEX IF NOT EXISTS shorturls_domain_originurl_key ON public.shorturls (domain, originurl)",
+	"CREATE INDEX IF NOT EXISTS shorturls_domain_shorturl_idx ON public.shorturls (domain, shorturl)",
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS clicks bigint NOT NULL default 0",
+	// владелец хранится отдельно от записи url, чтобы выбирать ссылки пользователя в БД
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS owner text NOT NULL default ''",
+	"UPDATE public.shorturls SET owner = convert_from(url, 'UTF8')::json->>'uid' WHERE owner = ''",
+	"CREATE INDEX IF NOT EXISTS shorturls_owner_idx ON public.shorturls (owner, uid)",
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS title text NOT NULL default ''",
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS note text NOT NULL default ''",
+	"ALTER TABLE public.shorturls ADD COLUMN IF NOT EXISTS tags text[] NOT NULL default '{}'",
+	"CREATE INDEX IF NOT EXISTS shorturls_tags_idx ON public.shorturls USING gin (tags)",
+}
+
+// migrate приводит структуру таблицы shorturls к актуальной.
+func migrate(db *sql.DB) bool {
+	for _, query := range migrations {
+		if _, err := db.Exec(query); err != nil {
+			logger.Error("can not exec query", "query", query, "error", err)
+			return false
+		}
 	}
 	return true
 }
 
-// InsertURL добавляет в БД запись с информацией о URL.
-func InsertURL(conn string, data []byte, originURL string, shortURL string) (bool, int, string) {
+// LinkMeta хранит описание ссылки.
+type LinkMeta struct {
+	// Title - заголовок.
+	Title string
+	// Note - заметка.
+	Note string
+	// Tags - теги.
+	Tags []string
+}
+
+// InsertURL добавляет в БД запись с информацией о URL владельца owner с описанием meta
+// в пространстве ссылок домена domain.
+func InsertURL(ctx context.Context, conn string, data []byte, domain string, owner string, originURL string, shortURL string, meta LinkMeta) (bool, int, string) {
 	db, errOpen := sql.Open("postgres", conn)
 	if errOpen != nil {
-		log.Println("Error connect to db: " + errOpen.Error())
+		logger.Error("can not connect to db", "func", "InsertURL", "error", errOpen)
 		return false, 1, ""
 	}
 	defer db.Close()
 
 	insertOrUpdateQuery := `WITH e AS(
-								INSERT INTO public.shorturls (url, originurl, shorturl) 
-									VALUES ($1,$2,$3)
-								ON CONFLICT(originurl) DO NOTHING
+								INSERT INTO public.shorturls (url, originurl, shorturl, domain, owner, title, note, tags) 
+									VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+								ON CONFLICT(domain, originurl) DO NOTHING
 								RETURNING 1, uid, shorturl
 							)
 							SELECT * FROM e
 							UNION
-								SELECT 2, uid, shorturl FROM public.shorturls WHERE originurl=$2`
+								SELECT 2, uid, shorturl FROM public.shorturls WHERE originurl=$2 AND domain=$4`
 	var iou int
 	var id int64
 	var su string
-	row := db.QueryRow(insertOrUpdateQuery, data, originURL, shortURL)
+	ctx, span := startSpan(ctx, "db.InsertURL", insertOrUpdateQuery)
+	row := db.QueryRowContext(ctx, insertOrUpdateQuery, data, originURL, shortURL, domain, owner,
+		meta.Title, meta.Note, pq.Array(meta.Tags))
 	err := row.Scan(&iou, &id, &su)
+	tracing.End(span, err == nil)
 	if err != nil {
-		log.Println("error readin from insert row: " + err.Error())
+		logger.Error("can not read inserted row", "error", err)
 		return false, 1, su
 	}
 
 	if iou == 1 {
-		log.Println("Inserted new into db: " + originURL)
+		logger.Debug("inserted url into db", "code", su)
 	} else {
-		log.Println("exist in db: " + originURL)
+		logger.Debug("url already exists in db", "code", su)
 	}
 	return true, iou, su
 }
 
-// DeleteURL удаляет из БД запись с информацией о URL.
-func DeleteURL(conn string, shortURL string) bool {
+// DeleteURL удаляет из БД запись с информацией о URL в пространстве ссылок домена domain,
+// если ее владелец owner.
+func DeleteURL(ctx context.Context, conn string, domain string, owner string, shortURL string) bool {
+	db, errOpen := sql.Open("postgres", conn)
+	if errOpen != nil {
+		logger.Error("can not connect to db", "func", "DeleteURL", "error", errOpen)
+		return false
+	}
+	defer db.Close()
+
+	queryDel := `UPDATE public.shorturls SET del=true WHERE shorturl=$1 AND domain=$2 AND owner=$3`
+
+	ctx, span := startSpan(ctx, "db.DeleteURL", queryDel)
+	_, err := db.ExecContext(ctx, queryDel, shortURL, domain, owner)
+	tracing.End(span, err == nil)
+	if err != nil {
+		logger.Error("can not exec query", "func", "DeleteURL", "query", queryDel, "error", err)
+		return false
+	}
+	return true
+}
+
+// SetDisabled блокирует или разблокирует в БД запись с информацией о URL в пространстве ссылок домена domain.
+func SetDisabled(ctx context.Context, conn string, domain string, shortURL string, disabled bool, reason string) bool {
+	db, errOpen := sql.Open("postgres", conn)
+	if errOpen != nil {
+		logger.Error("can not connect to db", "func", "SetDisabled", "error", errOpen)
+		return false
+	}
+	defer db.Close()
+
+	queryDisable := `UPDATE public.shorturls SET disabled=$2, reason=$3 WHERE shorturl=$1 AND domain=$4`
+
+	ctx, span := startSpan(ctx, "db.SetDisabled", queryDisable)
+	_, err := db.ExecContext(ctx, queryDisable, shortURL, disabled, reason, domain)
+	tracing.End(span, err == nil)
+	if err != nil {
+		logger.Error("can not exec query", "func", "SetDisabled", "query", queryDisable, "error", err)
+		return false
+	}
+	return true
+}
+
+// UpdateMeta заменяет в БД описание ссылки в пространстве ссылок домена domain.
+func UpdateMeta(ctx context.Context, conn string, domain string, shortURL string, meta LinkMeta) bool {
 	db, errOpen := sql.Open("postgres", conn)
 	if errOpen != nil {
-		log.Println("DelUserURL | Error connect to db: " + errOpen.Error())
+		logger.Error("can not connect to db", "func", "UpdateMeta", "error", errOpen)
 		return false
 	}
 	defer db.Close()
 
-	queryDel := `UPDATE public.shorturls SET del=true WHERE shorturl=$1`
+	queryMeta := `UPDATE public.shorturls SET title=$3, note=$4, tags=$5 WHERE shorturl=$1 AND domain=$2`
 
-	_, err := db.Exec(queryDel, shortURL)
+	ctx, span := startSpan(ctx, "db.UpdateMeta", queryMeta)
+	_, err := db.ExecContext(ctx, queryMeta, shortURL, domain, meta.Title, meta.Note, pq.Array(meta.Tags))
+	tracing.End(span, err == nil)
 	if err != nil {
-		log.Println("DelUserURL | Error exec query [" + queryDel + "]: " + err.Error())
+		logger.Error("can not exec query", "func", "UpdateMeta", "query", queryMeta, "error", err)
 		return false
 	}
 	return true
@@ -114,6 +243,14 @@ type URLFromDB struct {
 	DumpJSONURL []byte
 	// Deleted - была ли запись удалена.
 	Deleted bool
+	// Disabled - заблокирована ли запись администратором.
+	Disabled bool
+	// Reason - причина блокировки.
+	Reason string
+	// Clicks - количество переходов по ссылке.
+	Clicks uint64
+	// LinkMeta - описание ссылки.
+	LinkMeta
 }
 
 // ReadURLS считывает из БД записи с информацией о URL.
@@ -121,14 +258,14 @@ func ReadURLS(conn string) ([]URLFromDB, bool) {
 	var ret []URLFromDB
 	db, errOpen := sql.Open("postgres", conn)
 	if errOpen != nil {
-		log.Println("ReadURLS Error connect to db: " + errOpen.Error())
+		logger.Error("can not connect to db", "func", "ReadURLS", "error", errOpen)
 		return ret, false
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT url, del from public.shorturls")
+	rows, err := db.Query("SELECT url, del, coalesce(disabled, false), coalesce(reason, ''), clicks, title, note, tags from public.shorturls")
 	if err != nil {
-		log.Println("Error select url: " + err.Error())
+		logger.Error("can not select urls", "error", err)
 		return ret, false
 	}
 
@@ -138,9 +275,9 @@ func ReadURLS(conn string) ([]URLFromDB, bool) {
 	// пробегаем по всем записям
 	for rows.Next() {
 		var v URLFromDB
-		err = rows.Scan(&v.DumpJSONURL, &v.Deleted)
+		err = rows.Scan(&v.DumpJSONURL, &v.Deleted, &v.Disabled, &v.Reason, &v.Clicks, &v.Title, &v.Note, pq.Array(&v.Tags))
 		if err != nil {
-			log.Println("Error rows.Scan: " + err.Error())
+			logger.Error("can not scan row", "func", "ReadURLS", "error", err)
 			return ret, false
 		}
 		ret = append(ret, v)
@@ -148,7 +285,7 @@ func ReadURLS(conn string) ([]URLFromDB, bool) {
 	// проверяем на ошибки
 	err = rows.Err()
 	if err != nil {
-		log.Println("Error rows.Err: " + err.Error())
+		logger.Error("can not read rows", "func", "ReadURLS", "error", err)
 		return ret, false
 	}
 
@@ -0,0 +1,128 @@
+package dbh
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/jon69/shorturl/internal/app/tracing"
+)
+
+// UserURLQuery задает выборку ссылок пользователя.
+type UserURLQuery struct {
+	// Owner - идентификатор владельца.
+	Owner string
+	// Domain - пространство ссылок домена, учитывается при AllDomains == false.
+	Domain string
+	// AllDomains - выбирать ссылки всех доменов.
+	AllDomains bool
+	// Destination - подстрока исходного URL, пустая не ограничивает выборку.
+	Destination string
+	// Tag - тег ссылки, пустой не ограничивает выборку.
+	Tag string
+	// ByClicks - упорядочить по количеству переходов, иначе по времени создания.
+	ByClicks bool
+	// Desc - упорядочить по убыванию.
+	Desc bool
+	// Limit - максимальное количество записей, 0 - без ограничений.
+	Limit int
+	// After - выбирать записи, следующие за этой позицией, nil - с начала.
+	After *UserURLPosition
+}
+
+// UserURLPosition - позиция записи в упорядоченной выборке.
+type UserURLPosition struct {
+	// Clicks - количество переходов, учитывается при упорядочивании по переходам.
+	Clicks uint64
+	// ID - порядковый номер записи.
+	ID int64
+}
+
+// UserURLRow хранит информацию о ссылке пользователя, считанную из БД.
+type UserURLRow struct {
+	// ID - порядковый номер записи, возрастает со временем создания.
+	ID int64
+	// Domain - пространство ссылок домена.
+	Domain string
+	// Code - краткая форма URL.
+	Code string
+	// OriginalURL - исходный URL.
+	OriginalURL string
+	// Clicks - количество переходов.
+	Clicks uint64
+	// Deleted - признак удаления.
+	Deleted bool
+	// LinkMeta - описание ссылки.
+	LinkMeta
+}
+
+// ListUserURLs выбирает страницу ссылок пользователя и общее количество ссылок,
+// удовлетворяющих условиям без учета позиции и ограничения количества.
+func ListUserURLs(ctx context.Context, conn string, q UserURLQuery) ([]UserURLRow, int, error) {
+	db, err := sql.Open("postgres", conn)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+
+	where := `WHERE owner = $1
+				AND ($2 OR domain = $3)
+				AND ($4 = '' OR strpos(originurl, $4) > 0)
+				AND ($5 = '' OR $5 = ANY(tags))`
+	args := []interface{}{q.Owner, q.AllDomains, q.Domain, q.Destination, q.Tag}
+
+	var total int
+	queryCount := "SELECT count(*) FROM public.shorturls " + where
+	countCtx, span := startSpan(ctx, "db.CountUserURLs", queryCount)
+	err = db.QueryRowContext(countCtx, queryCount, args...).Scan(&total)
+	tracing.End(span, err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	order := fmt.Sprintf("uid %s", dir)
+	if q.ByClicks {
+		order = fmt.Sprintf("clicks %s, uid %s", dir, dir)
+	}
+	if q.After != nil {
+		if q.ByClicks {
+			where += fmt.Sprintf(" AND (clicks, uid) %s ($6, $7)", cmp)
+			args = append(args, int64(q.After.Clicks), q.After.ID)
+		} else {
+			where += fmt.Sprintf(" AND uid %s $6", cmp)
+			args = append(args, q.After.ID)
+		}
+	}
+	query := "SELECT uid, domain, shorturl, originurl, clicks, del, title, note, tags FROM public.shorturls " + where + " ORDER BY " + order
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	ctx, span = startSpan(ctx, "db.ListUserURLs", query)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		tracing.End(span, false)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var ret []UserURLRow
+	for rows.Next() {
+		var v UserURLRow
+		if err = rows.Scan(&v.ID, &v.Domain, &v.Code, &v.OriginalURL, &v.Clicks, &v.Deleted,
+			&v.Title, &v.Note, pq.Array(&v.Tags)); err != nil {
+			tracing.End(span, false)
+			return nil, 0, err
+		}
+		ret = append(ret, v)
+	}
+	err = rows.Err()
+	tracing.End(span, err == nil)
+	return ret, total, err
+}
@@ -0,0 +1,219 @@
+// Модуль domains описывает домены, под которыми сервис выдает краткие ссылки.
+//
+// Домен по умолчанию задается BASE_URL, дополнительные брендированные домены - конфигурацией.
+// У каждого домена собственное пространство кратких ссылок: одна и та же краткая форма может
+// независимо существовать на разных доменах. Дополнительному домену можно назначить владельцев,
+// тогда создавать ссылки под ним могут только они.
+package domains
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MetadataHost - ключ метаданных gRPC с доменом исходного HTTP запроса,
+// который передает шлюз HTTP/JSON.
+const MetadataHost = "x-forwarded-host"
+
+// DefaultNamespace - пространство ссылок домена по умолчанию. Ссылки, созданные до появления
+// доменов, относятся к нему.
+const DefaultNamespace = ""
+
+var (
+	// ErrUnknown - домен не обслуживается сервисом.
+	ErrUnknown = errors.New("unknown domain")
+	// ErrForbidden - пользователь не является владельцем домена.
+	ErrForbidden = errors.New("domain is not owned by user")
+)
+
+// Spec описывает дополнительный домен в конфигурации.
+type Spec struct {
+	// URL - базовый URL кратких ссылок домена, например https://sho.rt.
+	URL string `json:"url" yaml:"url" toml:"url"`
+	// Owners - пользователи, которым разрешено создавать ссылки под доменом, пусто - всем.
+	Owners []string `json:"owners,omitempty" yaml:"owners,omitempty" toml:"owners,omitempty"`
+}
+
+// Domain хранит информацию о домене.
+type Domain struct {
+	// Host - имя домена без порта в нижнем регистре.
+	Host string
+	// BaseURL - базовый URL кратких ссылок домена.
+	BaseURL string
+	// Namespace - пространство ссылок домена в хранилище.
+	Namespace string
+	// owners - владельцы домена, пусто - домен доступен всем.
+	owners map[string]bool
+}
+
+// ShortURL возвращает краткую ссылку с краткой формой code на домене.
+func (d Domain) ShortURL(code string) string {
+	return d.BaseURL + "/" + code
+}
+
+// Allowed проверяет, может ли пользователь uid создавать ссылки под доменом.
+func (d Domain) Allowed(uid string) bool {
+	return len(d.owners) == 0 || d.owners[uid]
+}
+
+// Owners возвращает отсортированный список владельцев домена.
+func (d Domain) Owners() []string {
+	owners := make([]string, 0, len(d.owners))
+	for uid := range d.owners {
+		owners = append(owners, uid)
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// Registry хранит домен по умолчанию и дополнительные домены.
+type Registry struct {
+	// def - домен по умолчанию.
+	def Domain
+	// byHost - дополнительные домены по именам.
+	byHost map[string]Domain
+}
+
+// parseBaseURL разбирает базовый URL и возвращает его без завершающего слеша и имя хоста.
+func parseBaseURL(str string) (string, string, error) {
+	u, err := url.Parse(str)
+	if err != nil {
+		return "", "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "", "", fmt.Errorf("must be an absolute http or https url, got %q", str)
+	}
+	return strings.TrimSuffix(str, "/"), strings.ToLower(u.Hostname()), nil
+}
+
+// New создает реестр из базового URL домена по умолчанию и дополнительных доменов.
+func New(baseURL string, specs []Spec) (*Registry, error) {
+	base, host, err := parseBaseURL(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("base url: %w", err)
+	}
+	r := &Registry{
+		def:    Domain{Host: host, BaseURL: base, Namespace: DefaultNamespace},
+		byHost: make(map[string]Domain),
+	}
+	for _, s := range specs {
+		base, host, err := parseBaseURL(s.URL)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.byHost[host]; ok || host == r.def.Host {
+			return nil, fmt.Errorf("duplicate domain %q", host)
+		}
+		d := Domain{Host: host, BaseURL: base, Namespace: host, owners: make(map[string]bool)}
+		for _, uid := range s.Owners {
+			d.owners[uid] = true
+		}
+		r.byHost[host] = d
+	}
+	return r, nil
+}
+
+// Single создает реестр только с доменом по умолчанию. Базовый URL не проверяется.
+func Single(baseURL string) *Registry {
+	r, err := New(baseURL, nil)
+	if err != nil {
+		return &Registry{def: Domain{BaseURL: baseURL, Namespace: DefaultNamespace}, byHost: map[string]Domain{}}
+	}
+	return r
+}
+
+// Default возвращает домен по умолчанию.
+func (r *Registry) Default() Domain {
+	return r.def
+}
+
+// All возвращает домен по умолчанию и дополнительные домены, упорядоченные по имени.
+func (r *Registry) All() []Domain {
+	all := make([]Domain, 0, len(r.byHost)+1)
+	for _, d := range r.byHost {
+		all = append(all, d)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Host < all[j].Host })
+	return append([]Domain{r.def}, all...)
+}
+
+// Lookup ищет домен по имени или значению заголовка Host, порт не учитывается.
+func (r *Registry) Lookup(name string) (Domain, bool) {
+	host := strings.ToLower(strings.TrimSpace(name))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == r.def.Host {
+		return r.def, true
+	}
+	d, ok := r.byHost[host]
+	return d, ok
+}
+
+// ForHost возвращает домен запроса по заголовку Host. Запросы к неизвестным именам,
+// например по IP адресу, относятся к домену по умолчанию.
+func (r *Registry) ForHost(host string) Domain {
+	if d, ok := r.Lookup(host); ok {
+		return d
+	}
+	return r.def
+}
+
+// ByNamespace возвращает домен пространства ссылок ns. Если домен удален из конфигурации,
+// ссылки на нем строятся по схеме домена по умолчанию.
+func (r *Registry) ByNamespace(ns string) Domain {
+	if ns == DefaultNamespace {
+		return r.def
+	}
+	if d, ok := r.byHost[ns]; ok {
+		return d
+	}
+	scheme := "https"
+	if u, err := url.Parse(r.def.BaseURL); err == nil && u.Scheme != "" {
+		scheme = u.Scheme
+	}
+	return Domain{Host: ns, BaseURL: scheme + "://" + ns, Namespace: ns}
+}
+
+// Select выбирает домен для создания ссылки пользователем uid: явно указанный explicit,
+// иначе по заголовку Host. Возвращает ErrUnknown для неизвестного явного домена
+// и ErrForbidden, если пользователь не владеет доменом.
+func (r *Registry) Select(explicit string, host string, uid string) (Domain, error) {
+	d := r.ForHost(host)
+	if explicit != "" {
+		var ok bool
+		if d, ok = r.Lookup(explicit); !ok {
+			return Domain{}, fmt.Errorf("%w %q", ErrUnknown, explicit)
+		}
+	}
+	if !d.Allowed(uid) {
+		return Domain{}, fmt.Errorf("%w: %s", ErrForbidden, d.Host)
+	}
+	return d, nil
+}
+
+// Find возвращает домен для обращения к существующим ссылкам: явно указанный explicit,
+// иначе по заголовку Host. Возвращает ErrUnknown для неизвестного явного домена.
+func (r *Registry) Find(explicit string, host string) (Domain, error) {
+	if explicit == "" {
+		return r.ForHost(host), nil
+	}
+	d, ok := r.Lookup(explicit)
+	if !ok {
+		return Domain{}, fmt.Errorf("%w %q", ErrUnknown, explicit)
+	}
+	return d, nil
+}
+
+// Qualify возвращает краткую форму вместе с пространством ссылок домена для журналов,
+// например brand.example/abc. На домене по умолчанию возвращает краткую форму как есть.
+func Qualify(ns string, code string) string {
+	if ns == DefaultNamespace {
+		return code
+	}
+	return ns + "/" + code
+}
@@ -0,0 +1,39 @@
+package domains
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := New("http://127.0.0.1:8080", []Spec{
+		{URL: "https://Brand.example/"},
+		{URL: "https://vip.example", Owners: []string{"u1"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultNamespace, r.ForHost("127.0.0.1:8080").Namespace)
+	assert.Equal(t, DefaultNamespace, r.ForHost("10.0.0.1").Namespace)
+	d := r.ForHost("brand.example:443")
+	assert.Equal(t, "brand.example", d.Namespace)
+	assert.Equal(t, "https://Brand.example/x", d.ShortURL("x"))
+	assert.Len(t, r.All(), 3)
+
+	d, err = r.Select("vip.example", "127.0.0.1", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "vip.example", d.Host)
+	_, err = r.Select("", "vip.example", "u2")
+	assert.True(t, errors.Is(err, ErrForbidden))
+	_, err = r.Select("other.example", "vip.example", "u1")
+	assert.True(t, errors.Is(err, ErrUnknown))
+
+	assert.Equal(t, "http://gone.example/x", r.ByNamespace("gone.example").ShortURL("x"))
+
+	_, err = New("http://brand.example", []Spec{{URL: "https://brand.example"}})
+	assert.Error(t, err)
+	_, err = New("http://a.example", []Spec{{URL: "brand.example"}})
+	assert.Error(t, err)
+}
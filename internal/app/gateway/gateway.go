@@ -0,0 +1,258 @@
+// Модуль gateway предоставляет доступ к gRPC API сервиса ShortURL в формате HTTP/JSON
+// по аналогии с grpc-gateway.
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	cookie "github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
+	"github.com/jon69/shorturl/internal/app/tracing"
+	pb "github.com/jon69/shorturl/proto"
+)
+
+// metadataHeaderPrefix - префикс HTTP заголовков, передаваемых в gRPC метаданные и обратно.
+const metadataHeaderPrefix = "Grpc-Metadata-"
+
+// Gateway транслирует HTTP/JSON запросы в вызовы gRPC сервиса ShortURL.
+type Gateway struct {
+	// conn - соединение с gRPC сервером.
+	conn *grpc.ClientConn
+	// client - клиент сервиса ShortURL.
+	client pb.ShortURLClient
+	// router - маршрутизатор HTTP запросов.
+	router chi.Router
+	// cookieAttrs - атрибуты выдаваемых кук.
+	cookieAttrs cookie.Attributes
+	// trusted - доверенные прокси для определения адреса клиента.
+	trusted *ipacl.Policy
+	// limits - ограничения на размер запросов.
+	limits limits.Limits
+}
+
+var marshaler = protojson.MarshalOptions{EmitUnpopulated: true}
+
+var unmarshaler = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// MakeGateway создает новый шлюз, обращающийся к gRPC серверу по адресу grpcAddr.
+// Куки, выданные gRPC сервером, возвращаются клиенту с атрибутами cookieAttrs.
+func MakeGateway(grpcAddr string, cookieAttrs cookie.Attributes) (*Gateway, error) {
+	conn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Error("gateway can not dial gRPC server", "error", err)
+		return nil, err
+	}
+	gw := &Gateway{}
+	gw.conn = conn
+	gw.client = pb.NewShortURLClient(conn)
+	gw.cookieAttrs = cookieAttrs
+	gw.limits = limits.Default()
+
+	r := chi.NewRouter()
+	r.Get("/ping", gw.servePing)
+	r.Post("/urls", gw.servePostURL)
+	r.Get("/urls/{id}", gw.serveGetURL)
+	r.Get("/internal/stats", gw.serveGetStats)
+	gw.router = r
+	return gw, nil
+}
+
+// SetTrustedPolicy устанавливает доверенные прокси, по заголовкам которых определяется адрес клиента.
+func (gw *Gateway) SetTrustedPolicy(p *ipacl.Policy) {
+	gw.trusted = p
+}
+
+// SetLimits устанавливает ограничения на размер запросов.
+func (gw *Gateway) SetLimits(l limits.Limits) {
+	gw.limits = l
+}
+
+// ServeHTTP обрабатывает HTTP запрос.
+func (gw *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gw.router.ServeHTTP(w, r)
+}
+
+// Close закрывает соединение с gRPC сервером.
+func (gw *Gateway) Close() error {
+	return gw.conn.Close()
+}
+
+// GET /v1/ping -> ShortURL.Ping
+func (gw *Gateway) servePing(w http.ResponseWriter, r *http.Request) {
+	var header metadata.MD
+	resp, err := gw.client.Ping(gw.outgoingContext(r), &pb.PingRequest{}, grpc.Header(&header))
+	gw.writeResponse(w, r, header, resp, err)
+}
+
+// POST /v1/urls -> ShortURL.PostURL
+func (gw *Gateway) servePostURL(w http.ResponseWriter, r *http.Request) {
+	var in pb.PostURLRequest
+	if !gw.readRequest(w, r, &in) {
+		return
+	}
+	var header metadata.MD
+	resp, err := gw.client.PostURL(gw.outgoingContext(r), &in, grpc.Header(&header))
+	gw.writeResponse(w, r, header, resp, err)
+}
+
+// GET /v1/urls/{id} -> ShortURL.GetURL
+func (gw *Gateway) serveGetURL(w http.ResponseWriter, r *http.Request) {
+	in := pb.GetURLRequest{Id: chi.URLParam(r, "id"), Domain: r.URL.Query().Get("domain")}
+	var header metadata.MD
+	resp, err := gw.client.GetURL(gw.outgoingContext(r), &in, grpc.Header(&header))
+	gw.writeResponse(w, r, header, resp, err)
+}
+
+// GET /v1/internal/stats -> ShortURL.GetStats
+func (gw *Gateway) serveGetStats(w http.ResponseWriter, r *http.Request) {
+	var header metadata.MD
+	resp, err := gw.client.GetStats(gw.outgoingContext(r), &pb.GetStatsRequest{}, grpc.Header(&header))
+	gw.writeResponse(w, r, header, resp, err)
+}
+
+// readRequest разбирает тело запроса в формате JSON в сообщение protobuf.
+func (gw *Gateway) readRequest(w http.ResponseWriter, r *http.Request, m proto.Message) bool {
+	b, err := gw.limits.ReadBody(r)
+	if err != nil {
+		limits.WriteError(w, err)
+		return false
+	}
+	if len(b) == 0 {
+		return true
+	}
+	if err := unmarshaler.Unmarshal(b, m); err != nil {
+		logger.FromContext(r.Context()).Warn("gateway can not unmarshal request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// outgoingContext переносит заголовки Grpc-Metadata-*, Authorization, X-API-Key, куку пользователя,
+// адрес клиента, домен запроса, идентификатор запроса и контекст трассировки в метаданные gRPC.
+func (gw *Gateway) outgoingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, metadataHeaderPrefix) {
+			md.Append(strings.ToLower(strings.TrimPrefix(name, metadataHeaderPrefix)), values...)
+		}
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		md.Set("authorization", auth)
+	}
+	if key := r.Header.Get(apikey.Header); key != "" {
+		md.Set(apikey.MetadataKey, key)
+	}
+	// адрес клиента заменяет любые переданные им значения, чтобы их нельзя было подделать
+	md.Delete(ipacl.MetadataRealIP)
+	if ip := gw.trusted.ClientIP(r); ip != nil {
+		md.Set(ipacl.MetadataForwardedFor, ip.String())
+	} else {
+		md.Delete(ipacl.MetadataForwardedFor)
+	}
+	// домен ссылок определяется по исходному HTTP запросу
+	md.Set(domains.MetadataHost, r.Host)
+	if c, err := r.Cookie(cookie.Name); err == nil {
+		md.Set("cookie_name", c.Name)
+		md.Set("cookie_value", c.Value)
+	}
+	// вызов gRPC журналируется с тем же идентификатором, что и HTTP запрос
+	if id := logger.RequestID(r.Context()); id != "" {
+		md.Set(logger.MetadataRequestID, id)
+	}
+	// спан вызова gRPC продолжает трассировку HTTP запроса
+	md.Delete("traceparent")
+	md.Delete("tracestate")
+	tracing.Inject(r.Context(), md)
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
+
+// writeResponse записывает ответ gRPC сервера в формате JSON.
+func (gw *Gateway) writeResponse(w http.ResponseWriter, r *http.Request, header metadata.MD, resp proto.Message, err error) {
+	for key, values := range header {
+		if key == "content-type" {
+			continue
+		}
+		for _, v := range values {
+			w.Header().Add(metadataHeaderPrefix+key, v)
+		}
+	}
+	// заголовки ограничения частоты запросов передаются клиенту как есть
+	for _, name := range ratelimit.Headers {
+		if values := header.Get(name); len(values) > 0 {
+			w.Header().Set(name, values[0])
+		}
+	}
+	if names, values := header.Get("cookie_name"), header.Get("cookie_value"); len(names) > 0 && len(values) > 0 {
+		http.SetCookie(w, gw.cookieAttrs.New(names[0], values[0]))
+	}
+
+	if err != nil {
+		st := status.Convert(err)
+		logger.FromContext(r.Context()).Debug("gateway gRPC call failed", "code", st.Code().String(), "error", st.Message())
+		b, errMarshal := marshaler.Marshal(st.Proto())
+		if errMarshal != nil {
+			http.Error(w, st.Message(), httpStatusFromCode(st.Code()))
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(httpStatusFromCode(st.Code()))
+		w.Write(b)
+		return
+	}
+
+	b, err := marshaler.Marshal(resp)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("gateway can not marshal response", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// httpStatusFromCode сопоставляет код ошибки gRPC коду ответа HTTP.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	cookie "github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	pb "github.com/jon69/shorturl/proto"
+)
+
+// fakeShortURL - сервис ShortURL, запоминающий метаданные последнего вызова.
+type fakeShortURL struct {
+	pb.UnimplementedShortURLServer
+	// md - метаданные последнего вызова.
+	md metadata.MD
+}
+
+func (s *fakeShortURL) PostURL(ctx context.Context, in *pb.PostURLRequest) (*pb.PostURLResponse, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	if in.Url == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty url")
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("cookie_name", cookie.Name, "cookie_value", "signed", "x-trace", "1"))
+	return &pb.PostURLResponse{ShortUrl: "http://" + s.md.Get(domains.MetadataHost)[0] + "/1"}, nil
+}
+
+func (s *fakeShortURL) GetURL(ctx context.Context, in *pb.GetURLRequest) (*pb.GetURLResponse, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	if in.Id != "1" {
+		return nil, status.Error(codes.NotFound, "not found "+in.Id)
+	}
+	return &pb.GetURLResponse{Url: "http://example.com"}, nil
+}
+
+func TestGateway(t *testing.T) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	fake := &fakeShortURL{}
+	pb.RegisterShortURLServer(srv, fake)
+	go srv.Serve(listen)
+	defer srv.Stop()
+
+	gw, err := MakeGateway(listen.Addr().String(), cookie.DefaultAttributes())
+	require.NoError(t, err)
+	defer gw.Close()
+
+	call := func(method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Host = "sho.rt"
+		r.RemoteAddr = "192.0.2.1:1234"
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call(http.MethodPost, "/urls", `{"url":"http://example.com","unknown":1}`, http.Header{
+		"Grpc-Metadata-X-Client":    {"cli"},
+		"Grpc-Metadata-X-Real-Ip":   {"203.0.113.1"},
+		"X-Forwarded-For":           {"203.0.113.2"},
+		"Authorization":             {"Bearer tok"},
+		"Cookie":                    {cookie.Name + "=old"},
+		"Grpc-Metadata-Traceparent": {"spoofed"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("content-type"))
+	var resp pb.PostURLResponse
+	require.NoError(t, protojson.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "http://sho.rt/1", resp.ShortUrl)
+	// метаданные ответа возвращаются заголовками, кука выдается с атрибутами шлюза
+	assert.Equal(t, "1", w.Header().Get(metadataHeaderPrefix+"x-trace"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, cookie.Name, cookies[0].Name)
+	assert.Equal(t, "signed", cookies[0].Value)
+
+	// заголовки запроса передаются в метаданные, адрес клиента подделать нельзя
+	assert.Equal(t, []string{"cli"}, fake.md.Get("x-client"))
+	assert.Equal(t, []string{"Bearer tok"}, fake.md.Get("authorization"))
+	assert.Equal(t, []string{"old"}, fake.md.Get("cookie_value"))
+	assert.Equal(t, []string{"192.0.2.1"}, fake.md.Get(ipacl.MetadataForwardedFor))
+	assert.Empty(t, fake.md.Get(ipacl.MetadataRealIP))
+	assert.Empty(t, fake.md.Get("traceparent"))
+
+	// запрос от доверенного прокси передает адрес клиента из заголовков
+	p, err := ipacl.New("", "192.0.2.0/24")
+	require.NoError(t, err)
+	gw.SetTrustedPolicy(p)
+	w = call(http.MethodGet, "/urls/1", "", http.Header{"X-Forwarded-For": {"203.0.113.2"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"203.0.113.2"}, fake.md.Get(ipacl.MetadataForwardedFor))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "not found", method: http.MethodGet, target: "/urls/2", want: http.StatusNotFound},
+		{name: "invalid argument", method: http.MethodPost, target: "/urls", body: `{}`, want: http.StatusBadRequest},
+		{name: "invalid json", method: http.MethodPost, target: "/urls", body: `{"url":`, want: http.StatusBadRequest},
+		{name: "unimplemented", method: http.MethodGet, target: "/internal/stats", want: http.StatusNotImplemented},
+		{name: "unknown route", method: http.MethodGet, target: "/other", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call(tt.method, tt.target, tt.body, nil)
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package rpcsrv
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/storage"
+	pb "github.com/jon69/shorturl/proto"
+)
+
+// adminServer реализует сервис модерации ссылок ShortURLAdmin.
+type adminServer struct {
+	pb.UnimplementedShortURLAdminServer
+	// domains - домены кратких ссылок.
+	domains *domains.Registry
+	// urlstorage - хранилище данных.
+	urlstorage *storage.StorageURL
+	// audit - журнал аудита, nil если не ведется.
+	audit *audit.Logger
+	// limits - ограничения на размер запросов.
+	limits limits.Limits
+}
+
+// SearchLinks ищет ссылки по краткой форме, подстроке исходного URL, владельцу или домену,
+// по умолчанию на всех доменах.
+func (h *adminServer) SearchLinks(ctx context.Context, in *pb.SearchLinksRequest) (*pb.SearchLinksResponse, error) {
+	f := storage.URLFilter{Code: in.Code, Destination: in.Destination, Owner: in.Owner, Limit: int(in.Limit), AllDomains: true}
+	if in.Domain != "" {
+		d, err := h.domains.Find(in.Domain, "")
+		if err != nil {
+			return nil, domainError(err)
+		}
+		f.Domain, f.AllDomains = d.Namespace, false
+	}
+	var response pb.SearchLinksResponse
+	for _, u := range h.urlstorage.SearchURLs(f) {
+		d := h.domains.ByNamespace(u.Domain)
+		response.Links = append(response.Links, &pb.AdminLink{Code: u.Code, ShortUrl: d.ShortURL(u.Code), Domain: d.Host,
+			OriginalUrl: u.OriginalURL, Owner: u.Owner, Deleted: u.Deleted, Disabled: u.Disabled, Reason: u.Reason})
+	}
+	return &response, nil
+}
+
+// DisableLink блокирует ссылку с указанием причины.
+func (h *adminServer) DisableLink(ctx context.Context, in *pb.SetLinkStateRequest) (*pb.SetLinkStateResponse, error) {
+	if in.Reason == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "empty reason")
+	}
+	return h.setDisabled(ctx, in.Domain, in.Code, true, in.Reason)
+}
+
+// EnableLink разблокирует ссылку.
+func (h *adminServer) EnableLink(ctx context.Context, in *pb.SetLinkStateRequest) (*pb.SetLinkStateResponse, error) {
+	return h.setDisabled(ctx, in.Domain, in.Code, false, "")
+}
+
+// domain возвращает домен ссылок административного вызова: явно указанный name, иначе домен запроса.
+func (h *adminServer) domain(ctx context.Context, name string) (domains.Domain, error) {
+	d, err := h.domains.Find(name, requestHost(ctx))
+	if err != nil {
+		return domains.Domain{}, domainError(err)
+	}
+	return d, nil
+}
+
+func (h *adminServer) setDisabled(ctx context.Context, name string, code string, disabled bool, reason string) (*pb.SetLinkStateResponse, error) {
+	d, err := h.domain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(h.urlstorage.SearchURLs(storage.URLFilter{Domain: d.Namespace, Code: code})) == 0 {
+		return &pb.SetLinkStateResponse{Stmsg: &pb.StatusMessage{Status: pb.StatusMessage_NOT_FOUND}}, nil
+	}
+	response := pb.SetLinkStateResponse{Stmsg: &pb.StatusMessage{Status: pb.StatusMessage_OK}}
+	if !h.changeLinkState(ctx, d.Namespace, code, disabled, reason) {
+		response.Stmsg.Status = pb.StatusMessage_ERROR
+	}
+	return &response, nil
+}
+
+// changeLinkState меняет состояние блокировки ссылки и фиксирует изменение в журнале аудита.
+func (h *adminServer) changeLinkState(ctx context.Context, ns string, code string, disabled bool, reason string) bool {
+	before := h.urlstorage.SearchURLs(storage.URLFilter{Domain: ns, Code: code})
+	if len(before) == 0 || !h.urlstorage.SetURLDisabledContext(ctx, ns, code, disabled, reason) {
+		return false
+	}
+	if h.audit != nil {
+		op := audit.OpEnable
+		if disabled {
+			op = audit.OpDisable
+		}
+		after := h.urlstorage.SearchURLs(storage.URLFilter{Domain: ns, Code: code})
+		h.audit.Record(ctx, op, domains.Qualify(ns, code), audit.State(before[0]), audit.State(after[0]))
+	}
+	return true
+}
+
+// DeleteLink удаляет произвольную ссылку.
+func (h *adminServer) DeleteLink(ctx context.Context, in *pb.SetLinkStateRequest) (*pb.SetLinkStateResponse, error) {
+	d, err := h.domain(ctx, in.Domain)
+	if err != nil {
+		return nil, err
+	}
+	found := h.urlstorage.SearchURLs(storage.URLFilter{Domain: d.Namespace, Code: in.Code})
+	if len(found) == 0 {
+		return &pb.SetLinkStateResponse{Stmsg: &pb.StatusMessage{Status: pb.StatusMessage_NOT_FOUND}}, nil
+	}
+	response := pb.SetLinkStateResponse{Stmsg: &pb.StatusMessage{Status: pb.StatusMessage_OK}}
+	if found[0].Deleted {
+		return &response, nil
+	}
+	logger.FromContext(ctx).Info("admin deletes link", "domain", d.Host, "code", in.Code)
+	// удаление выполняется в фоне и записывается в журнал аудита хранилищем
+	if !h.urlstorage.DelUserURLContext(ctx, d.Namespace, found[0].Owner, in.Code) {
+		response.Stmsg.Status = pb.StatusMessage_ERROR
+	}
+	return &response, nil
+}
+
+// Takedown массово блокирует ссылки.
+func (h *adminServer) Takedown(ctx context.Context, in *pb.TakedownRequest) (*pb.TakedownResponse, error) {
+	if in.Reason == "" || len(in.Codes) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "codes and reason are required")
+	}
+	if err := h.limits.CheckBatch(len(in.Codes)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	d, err := h.domain(ctx, in.Domain)
+	if err != nil {
+		return nil, err
+	}
+	var response pb.TakedownResponse
+	for _, code := range in.Codes {
+		switch {
+		case len(h.urlstorage.SearchURLs(storage.URLFilter{Domain: d.Namespace, Code: code})) == 0:
+			response.NotFound = append(response.NotFound, code)
+		case h.changeLinkState(ctx, d.Namespace, code, true, in.Reason):
+			response.Disabled = append(response.Disabled, code)
+		default:
+			response.Failed = append(response.Failed, code)
+		}
+	}
+	return &response, nil
+}
+
+// UserLinkCounts возвращает количество ссылок каждого пользователя.
+func (h *adminServer) UserLinkCounts(ctx context.Context, in *pb.UserLinkCountsRequest) (*pb.UserLinkCountsResponse, error) {
+	var response pb.UserLinkCountsResponse
+	for _, c := range h.urlstorage.UserURLCounts() {
+		response.Users = append(response.Users, &pb.UserLinkCount{Uid: c.UID, Count: int64(c.Count)})
+	}
+	return &response, nil
+}
@@ -3,58 +3,196 @@ package rpcsrv
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net"
+	"net/http"
+	"strings"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
 	// импортируем пакет со сгенерированными protobuf-файлами
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/auth"
 	cookie "github.com/jon69/shorturl/internal/app/cookie"
 	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/domains"
+	apphealth "github.com/jon69/shorturl/internal/app/health"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/metrics"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
 	"github.com/jon69/shorturl/internal/app/storage"
+	"github.com/jon69/shorturl/internal/app/titles"
+	"github.com/jon69/shorturl/internal/app/tracing"
 	pb "github.com/jon69/shorturl/proto"
 )
 
+// ListenAddr - адрес, на котором принимает соединения gRPC сервер по умолчанию.
+const ListenAddr = ":8082"
+
 // PRCServer представляет RPC сервер.
 type PRCServer struct {
 	// grpcserver - сервер.
 	grpcserver *grpc.Server
+	// health - сервис проверки состояния grpc.health.v1.
+	health *healthChecker
+	// shorturl - реализация сервиса ShortURL.
+	shorturl *gPRCServer
+	// admin - реализация сервиса ShortURLAdmin.
+	admin *adminServer
+	// addr - адрес, на котором принимаются соединения.
+	addr string
 }
 
 // MakeServer создает ноый RPC сервер.
-func MakeServer(k []byte, baseURL string, conndb string, urlstorage *storage.StorageURL) *PRCServer {
-	srv := &PRCServer{}
+// Размер принимаемого сообщения ограничивается lim.MaxDecodedBytes.
+func MakeServer(keys *keyring.KeyRing, baseURL string, conndb string, urlstorage *storage.StorageURL, lim limits.Limits) *PRCServer {
+	srv := &PRCServer{addr: ListenAddr}
 
 	mygrpcsrv := &gPRCServer{}
 	mygrpcsrv.conndb = conndb
 	mygrpcsrv.urlstorage = urlstorage
-	mygrpcsrv.baseURL = baseURL
-	mygrpcsrv.key = k
+	mygrpcsrv.domains = domains.Single(baseURL)
+	mygrpcsrv.keys = keys
+	mygrpcsrv.limits = lim
 	// 	создаем сервис
-	srv.grpcserver = grpc.NewServer(grpc.UnaryInterceptor(mygrpcsrv.shorturlInterceptor))
+	// журнал доступа, трассировка и метрики ведутся для всех вызовов, ограничение частоты проверяется после идентификации клиента
+	srv.grpcserver = grpc.NewServer(grpc.ChainUnaryInterceptor(logger.UnaryServerInterceptor(logger.Default()),
+		tracing.UnaryServerInterceptor(), metrics.UnaryServerInterceptor(), mygrpcsrv.shorturlInterceptor, mygrpcsrv.rateLimitInterceptor),
+		grpc.MaxRecvMsgSize(int(lim.MaxDecodedBytes)))
 
 	// регистрируем сервис
 	pb.RegisterShortURLServer(srv.grpcserver, mygrpcsrv)
+	srv.shorturl = mygrpcsrv
+
+	// регистрируем сервис модерации
+	srv.admin = &adminServer{domains: mygrpcsrv.domains, urlstorage: urlstorage, limits: lim}
+	pb.RegisterShortURLAdminServer(srv.grpcserver, srv.admin)
+
+	// регистрируем стандартный сервис проверки состояния
+	srv.health = newHealthChecker(conndb)
+	healthpb.RegisterHealthServer(srv.grpcserver, srv.health)
 	return srv
 }
 
-// Shutdown завершает работу
-func (srv *PRCServer) Shutdown() {
-	srv.grpcserver.GracefulStop()
+// SetAdmins устанавливает пользователей с ролью администратора.
+func (srv *PRCServer) SetAdmins(admins auth.Admins) {
+	srv.shorturl.admins = admins
+}
+
+// SetDomains устанавливает домены кратких ссылок вместо единственного домена baseURL.
+func (srv *PRCServer) SetDomains(r *domains.Registry) {
+	srv.shorturl.domains = r
+	srv.admin.domains = r
+}
+
+// SetAuditLog устанавливает журнал аудита изменяющих операций.
+func (srv *PRCServer) SetAuditLog(l *audit.Logger) {
+	srv.shorturl.audit = l
+	srv.admin.audit = l
+}
+
+// SetTitleFetcher устанавливает загрузчик заголовков страниц для новых ссылок без заголовка.
+func (srv *PRCServer) SetTitleFetcher(f *titles.Fetcher) {
+	srv.shorturl.titles = f
+}
+
+// SetTrustedPolicy устанавливает доверенные подсети для внутренних методов.
+// Соединения с локального адреса считаются доверенным прокси, так как от них
+// приходят запросы встроенного HTTP шлюза с адресом клиента в метаданных.
+func (srv *PRCServer) SetTrustedPolicy(p *ipacl.Policy) {
+	srv.shorturl.trusted = p.WithProxies(
+		&net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+		&net.IPNet{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)})
+}
+
+// rateLimitMethods сопоставляет методам имена маршрутов в правилах ограничения частоты.
+var rateLimitMethods = map[string]string{
+	"/shorturl.ShortURL/PostURL": ratelimit.RouteShorten,
+	"/shorturl.ShortURL/GetURL":  ratelimit.RouteRedirect,
+}
+
+// SetRateLimits устанавливает ограничения частоты вызовов.
+// Клиенты различаются по API ключу, токену в заголовке authorization, иначе по адресу.
+// Должен вызываться до Serve.
+func (srv *PRCServer) SetRateLimits(limiter ratelimit.Limiter, rules ratelimit.Source) {
+	h := srv.shorturl
+	h.rateLimit = ratelimit.UnaryServerInterceptor(limiter, rules, rateLimitMethods, func(ctx context.Context) string {
+		if id, ok := auth.FromContext(ctx); ok {
+			switch id.Method {
+			case auth.MethodAPIKey:
+				return "key:" + id.KeyID
+			case auth.MethodBearer:
+				return "uid:" + id.UID
+			}
+		}
+		return "ip:" + ipString(h.trusted.PeerIP(ctx))
+	})
+}
+
+// SetAddr устанавливает адрес (хост:порт), на котором принимаются соединения.
+// Должен вызываться до Serve.
+func (srv *PRCServer) SetAddr(addr string) {
+	srv.addr = addr
+}
+
+// SetReadiness устанавливает проверку готовности, определяющую статус сервиса grpc.health.v1.
+// Должен вызываться до Serve.
+func (srv *PRCServer) SetReadiness(c *apphealth.Checker) {
+	srv.health.readiness = c
+}
+
+// EnableReflection регистрирует сервис рефлексии, позволяющий исследовать API через grpcurl.
+// Должен вызываться до Serve.
+func (srv *PRCServer) EnableReflection() {
+	reflection.Register(srv.grpcserver)
+	logger.Info("gRPC reflection enabled")
+}
+
+// Shutdown завершает работу: перестает принимать соединения и дожидается завершения
+// обрабатываемых вызовов. Если они не завершились до истечения срока ctx, соединения
+// закрываются принудительно.
+func (srv *PRCServer) Shutdown(ctx context.Context) error {
+	srv.health.stop()
+	done := make(chan struct{})
+	go func() {
+		srv.grpcserver.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		srv.grpcserver.Stop()
+		return ctx.Err()
+	}
+}
+
+// ServeHTTP обрабатывает вызов gRPC, полученный HTTP сервером по HTTP/2.
+// Позволяет обслуживать gRPC на порту HTTP сервера вместе с остальными маршрутами.
+func (srv *PRCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.grpcserver.ServeHTTP(w, r)
 }
 
 // Serve запускает сервер на обработку
 func (srv *PRCServer) Serve() error {
 	// определяем порт для сервера
-	listen, err := net.Listen("tcp", ":8082")
+	listen, err := net.Listen("tcp", srv.addr)
 	if err != nil {
 		return err
 	}
-	log.Println("Сервер gRPC начал работу")
+	go srv.health.run()
+	logger.Info("gRPC server started", "addr", srv.addr)
 	// получаем запрос gRPC
 	if err := srv.grpcserver.Serve(listen); err != nil {
 		return err
@@ -64,10 +202,10 @@ func (srv *PRCServer) Serve() error {
 
 // PRCServer поддерживает все необходимые методы сервера.
 type gPRCServer struct {
-	// key - секретный ключ на подписи куки.
-	key []byte
-	// baseURL - адрес (хост:порт) для выдачи сохраненных URL.
-	baseURL string
+	// keys - набор секретных ключей для подписи куки.
+	keys *keyring.KeyRing
+	// domains - домены кратких ссылок.
+	domains *domains.Registry
 	// conndb - параметры подключения к БД.
 	conndb string
 	// нужно встраивать тип pb.Unimplemented<TypeName>
@@ -75,17 +213,74 @@ type gPRCServer struct {
 	pb.UnimplementedShortURLServer
 	// urlstorage - хранилище данных.
 	urlstorage *storage.StorageURL
+	// admins - пользователи с ролью администратора.
+	admins auth.Admins
+	// audit - журнал аудита, nil если не ведется.
+	audit *audit.Logger
+	// trusted - доверенные подсети и прокси.
+	trusted *ipacl.Policy
+	// rateLimit - перехватчик, ограничивающий частоту вызовов, nil если ограничений нет.
+	rateLimit grpc.UnaryServerInterceptor
+	// limits - ограничения на размер запросов.
+	limits limits.Limits
+	// titles - загрузчик заголовков страниц, nil если заголовки не загружаются.
+	titles *titles.Fetcher
+}
+
+// rateLimitInterceptor ограничивает частоту вызовов, если заданы ограничения.
+func (h *gPRCServer) rateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if h.rateLimit == nil {
+		return handler(ctx, req)
+	}
+	return h.rateLimit(ctx, req, info, handler)
 }
 
 // CTXUid структура для хранения конекста запроса с информацией о польльзователе.
 type CTXUid struct {
 }
 
+// internalMethods - методы, доступные только из доверенных подсетей либо по API ключу с правом stats.
+var internalMethods = map[string]bool{
+	"/shorturl.ShortURL/GetStats": true,
+}
+
+// methodScopes - права, необходимые для вызова методов.
+var methodScopes = map[string]auth.Scope{
+	"/shorturl.ShortURL/PostURL": auth.ScopeShorten,
+}
+
+// callWithIdentity назначает клиенту роль, проверяет его права и вызывает обработчик
+// с информацией о клиенте в контексте.
+func (h *gPRCServer) callWithIdentity(ctx context.Context, id auth.Identity, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id = h.admins.AssignRole(id)
+	logger.AddFields(ctx, "uid", id.UID, "auth", id.Method)
+	if strings.HasPrefix(info.FullMethod, "/"+pb.ShortURLAdmin_ServiceDesc.ServiceName+"/") && !id.IsAdmin() {
+		logger.FromContext(ctx).Warn("access denied", "role", auth.RoleAdmin)
+		return nil, status.Errorf(codes.PermissionDenied, "admin role required")
+	}
+	if scope, ok := methodScopes[info.FullMethod]; ok && !id.HasScope(scope) {
+		logger.FromContext(ctx).Warn("access denied", "scope", scope)
+		return nil, status.Errorf(codes.PermissionDenied, "scope %s required", scope)
+	}
+	if internalMethods[info.FullMethod] && !(id.Method == auth.MethodAPIKey && id.HasScope(auth.ScopeStats)) && !h.trusted.AllowPeer(ctx) {
+		logger.FromContext(ctx).Warn("access denied, untrusted address", "ip", h.trusted.PeerIP(ctx))
+		return nil, status.Errorf(codes.PermissionDenied, "untrusted address")
+	}
+	ctx = context.WithValue(ctx, CTXUid{}, id.UID)
+	ctx = audit.WithSource(ctx, audit.Source{IP: ipString(h.trusted.PeerIP(ctx)), Transport: audit.TransportGRPC})
+	return handler(auth.WithIdentity(ctx, id), req)
+}
+
 func (h *gPRCServer) shorturlInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	log.Print("shorturlInterceptor called")
+	// проверки состояния не требуют идентификации пользователя
+	if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, req)
+	}
 
 	var cookieName string
 	var cookieValue string
+	var bearer string
+	var plainKey string
 
 	var newCookieName string
 	var newCookieValue string
@@ -101,60 +296,103 @@ func (h *gPRCServer) shorturlInterceptor(ctx context.Context, req interface{}, i
 		if len(values) > 0 {
 			cookieValue = values[0]
 		}
+		values = md.Get("authorization")
+		if len(values) > 0 && strings.HasPrefix(strings.ToLower(values[0]), "bearer ") {
+			bearer = strings.TrimSpace(values[0][len("bearer "):])
+		}
+		values = md.Get(apikey.MetadataKey)
+		if len(values) > 0 {
+			plainKey = values[0]
+		}
+	}
+
+	// API ключ имеет наивысший приоритет
+	if plainKey != "" {
+		k, ok := h.urlstorage.GetAPIKey(apikey.Hash(plainKey))
+		if !ok {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid api key")
+		}
+		return h.callWithIdentity(ctx, k.Identity(), req, info, handler)
+	}
+
+	// токен, переданный в метаданных authorization, имеет приоритет над кукой
+	if bearer != "" {
+		claims, valid := cookie.Validate(h.keys, bearer)
+		if !valid {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token")
+		}
+		uid = claims.UID
+		if cookie.NeedRefresh(h.keys, claims) {
+			header := metadata.Pairs("authorization", "Bearer "+cookie.SignUID(h.keys, uid))
+			if err := grpc.SetHeader(ctx, header); err != nil {
+				logger.FromContext(ctx).Error("can not send token", "error", err)
+				return nil, status.Errorf(codes.Internal, "unable to send token")
+			}
+		}
+		return h.callWithIdentity(ctx, auth.Identity{UID: uid, Method: auth.MethodBearer, Scopes: auth.UserScopes}, req, info, handler)
 	}
 
 	if len(cookieValue) == 0 || len(cookieName) == 0 {
-		log.Println("cookie empty")
-		newCookieName, newCookieValue, uid = cookie.GetNewSignedCookie(h.key)
+		logger.FromContext(ctx).Debug("cookie empty, issuing new one")
+		newCookieName, newCookieValue, uid = cookie.GetNewSignedCookie(h.keys)
 	} else {
-		var equal bool
-		equal, uid = cookie.ValidateCookie(h.key, cookieName, cookieValue)
-		if !equal {
-			newCookieName, newCookieValue, uid = cookie.GetNewSignedCookie(h.key)
-		} else {
+		claims, valid := cookie.Validate(h.keys, cookieValue)
+		switch {
+		case !valid || cookieName != cookie.Name:
+			newCookieName, newCookieValue, uid = cookie.GetNewSignedCookie(h.keys)
+		case cookie.NeedRefresh(h.keys, claims):
+			uid = claims.UID
+			newCookieName, newCookieValue = cookie.Name, cookie.SignUID(h.keys, uid)
+		default:
+			uid = claims.UID
 			newCookieName = cookieName
 			newCookieValue = cookieValue
 		}
 	}
 
 	header := metadata.New(map[string]string{"cookie_name": newCookieName, "cookie_value": newCookieValue})
-	if err := grpc.SendHeader(ctx, header); err != nil {
-		log.Println("gPRCServer can not send cookie: " + err.Error())
+	// заголовки отправляются вместе с ответом, чтобы следующие перехватчики могли их дополнить
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		logger.FromContext(ctx).Error("can not send cookie", "error", err)
 		return nil, status.Errorf(codes.Internal, "unable to send cookie")
 	}
 
-	ctx2 := context.WithValue(ctx, CTXUid{}, uid)
-	return handler(ctx2, req)
+	return h.callWithIdentity(ctx, auth.Identity{UID: uid, Method: auth.MethodCookie, Scopes: auth.UserScopes}, req, info, handler)
 }
 
 // Ping обрабатывает запрос на проверку подключения к БД
 func (h *gPRCServer) Ping(ctx context.Context, in *pb.PingRequest) (*pb.PingResponse, error) {
-	log.Println("gPRCServer Ping")
 
 	var response pb.PingResponse
 	response.Stmsg = &pb.StatusMessage{Status: pb.StatusMessage_OK}
 
-	if h.conndb != "" {
-		if !dbh.Ping(h.conndb) {
-			response.Stmsg.Status = pb.StatusMessage_ERROR
-		}
+	if !dbh.Ready(h.conndb) {
+		response.Stmsg.Status = pb.StatusMessage_ERROR
 	}
-	log.Println("return from gPRCServer Ping")
 	return &response, nil
 }
 
 // PostURL обрабатывает запрос на создание укороченной ссылки URL
 func (h *gPRCServer) PostURL(ctx context.Context, in *pb.PostURLRequest) (*pb.PostURLResponse, error) {
-	log.Print("gPRCServer PostURL url=" + in.Url)
-
-	var id string
-	var iou int
+	if err := h.limits.CheckURL(in.Url); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	uiduser := "1"
 	if v := ctx.Value(CTXUid{}); v != nil {
-		uiduser := fmt.Sprintf("%v", v)
-		log.Print("gPRCServer PostURL uiduser=" + uiduser)
-		iou, id = h.urlstorage.PutUserURL(uiduser, in.Url)
-	} else {
-		iou, id = h.urlstorage.PutURL(in.Url)
+		uiduser = fmt.Sprintf("%v", v)
+	}
+	meta, err := storage.NormalizeMeta(storage.Meta{Title: in.Title, Note: in.Note, Tags: in.Tags})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	d, err := h.domains.Select(in.Domain, requestHost(ctx), uiduser)
+	if err != nil {
+		return nil, domainError(err)
+	}
+
+	iou, id := h.urlstorage.PutUserURLMetaContext(ctx, d.Namespace, uiduser, in.Url, meta)
+	if iou == 1 && meta.Title == "" && h.titles != nil {
+		h.titles.Enqueue(d.Namespace, id, in.Url)
 	}
 
 	var response pb.PostURLResponse
@@ -162,6 +400,10 @@ func (h *gPRCServer) PostURL(ctx context.Context, in *pb.PostURLRequest) (*pb.Po
 
 	if iou != 1 {
 		response.Stmsg.Status = pb.StatusMessage_ERROR
+	} else if h.audit != nil {
+		if found := h.urlstorage.SearchURLs(storage.URLFilter{Domain: d.Namespace, Code: id}); len(found) > 0 {
+			h.audit.Record(ctx, audit.OpCreate, domains.Qualify(d.Namespace, id), "", audit.State(found[0]))
+		}
 	}
 
 	response.ShortUrl = id
@@ -170,21 +412,72 @@ func (h *gPRCServer) PostURL(ctx context.Context, in *pb.PostURLRequest) (*pb.Po
 
 // GetURL обрабатывает запрос на получение URL
 func (h *gPRCServer) GetURL(ctx context.Context, in *pb.GetURLRequest) (*pb.GetURLResponse, error) {
-	log.Print("gPRCServer GetURL id=" + in.Id)
+	d, err := h.domains.Find(in.Domain, requestHost(ctx))
+	if err != nil {
+		return nil, domainError(err)
+	}
+	logger.FromContext(ctx).Debug("resolving url", "domain", d.Host, "code", in.Id)
 
 	var response pb.GetURLResponse
 	response.Stmsg = &pb.StatusMessage{Status: pb.StatusMessage_OK}
-	val, ok, isDel := h.urlstorage.GetURL(in.Id)
+	val, ok, isDel := h.urlstorage.GetURLContext(ctx, d.Namespace, in.Id)
 
 	if ok {
 		if isDel {
+			metrics.Redirect(metrics.RedirectGone)
 			response.Stmsg.Status = pb.StatusMessage_NOT_FOUND
 		} else {
+			metrics.Redirect(metrics.RedirectHit)
+			h.urlstorage.Click(d.Namespace, in.Id)
 			response.Url = val
 		}
 	} else {
+		metrics.Redirect(metrics.RedirectMiss)
 		response.Stmsg.Status = pb.StatusMessage_NOT_FOUND
 	}
 
 	return &response, nil
 }
+
+// GetStats возвращает количество сокращённых URL и пользователей.
+func (h *gPRCServer) GetStats(ctx context.Context, in *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
+	statJSON, ok := h.urlstorage.GetStat()
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "can not get stat")
+	}
+	var stat storage.Stat
+	if err := json.Unmarshal(statJSON, &stat); err != nil {
+		return nil, status.Errorf(codes.Internal, "can not get stat")
+	}
+	return &pb.GetStatsResponse{Urls: int64(stat.CountURLS), Users: int64(stat.CountUsers)}, nil
+}
+
+// requestHost возвращает домен запроса: переданный шлюзом HTTP/JSON, иначе из псевдозаголовка :authority.
+func requestHost(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{domains.MetadataHost, ":authority"} {
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// domainError преобразует ошибку выбора домена в статус gRPC.
+func domainError(err error) error {
+	if errors.Is(err, domains.ErrForbidden) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// ipString возвращает адрес в текстовом виде либо пустую строку.
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,65 @@
+package rpcsrv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/auth"
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+func TestInterceptorAPIKey(t *testing.T) {
+	st := storage.NewStorage("", "")
+	plainRead, readKey, err := apikey.Generate("reader", "owner-1", []auth.Scope{auth.ScopeRead})
+	require.NoError(t, err)
+	require.True(t, st.PutAPIKey(readKey))
+	plainStats, statsKey, err := apikey.Generate("stats", "owner-2", []auth.Scope{auth.ScopeStats})
+	require.NoError(t, err)
+	require.True(t, st.PutAPIKey(statsKey))
+	plainRevoked, revokedKey, err := apikey.Generate("old", "owner-3", auth.UserScopes)
+	require.NoError(t, err)
+	require.True(t, st.PutAPIKey(revokedKey))
+	require.True(t, st.RevokeAPIKey(revokedKey.ID))
+
+	h := &gPRCServer{urlstorage: st, keys: keyring.NewKeyRing([]byte("secret"))}
+	var got auth.Identity
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got, _ = auth.FromContext(ctx)
+		return nil, nil
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		want   codes.Code
+		uid    string
+	}{
+		{name: "valid key", key: plainRead, method: "/shorturl.ShortURL/GetURL", want: codes.OK, uid: "owner-1"},
+		{name: "missing scope", key: plainRead, method: "/shorturl.ShortURL/PostURL", want: codes.PermissionDenied},
+		{name: "stats key on internal method", key: plainStats, method: "/shorturl.ShortURL/GetStats", want: codes.OK, uid: "owner-2"},
+		{name: "unknown key", key: "sk_unknown", method: "/shorturl.ShortURL/GetURL", want: codes.Unauthenticated},
+		{name: "revoked key", key: plainRevoked, method: "/shorturl.ShortURL/GetURL", want: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = auth.Identity{}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(apikey.MetadataKey, tt.key))
+			_, err := h.shorturlInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			require.Equal(t, tt.want, status.Code(err))
+			assert.Equal(t, tt.uid, got.UID)
+			if tt.want == codes.OK {
+				assert.Equal(t, auth.MethodAPIKey, got.Method)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package rpcsrv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	dbh "github.com/jon69/shorturl/internal/app/db"
+	apphealth "github.com/jon69/shorturl/internal/app/health"
+	"github.com/jon69/shorturl/internal/app/logger"
+	pb "github.com/jon69/shorturl/proto"
+)
+
+// healthCheckInterval - период фоновой проверки готовности для подписчиков Watch.
+const healthCheckInterval = 5 * time.Second
+
+// healthChecker реализует сервис grpc.health.v1.Health.
+// Статус сервиса определяется проверкой готовности, общей с /readyz, а если она не задана -
+// той же логикой готовности БД, что и ServeGetPING.
+type healthChecker struct {
+	*health.Server
+	// conndb - параметры подключения к БД.
+	conndb string
+	// readiness - проверка готовности сервиса.
+	readiness *apphealth.Checker
+	// done - канал остановки фоновой проверки.
+	done chan struct{}
+	// stopOnce - защищает от повторного закрытия done при повторной остановке.
+	stopOnce sync.Once
+}
+
+func newHealthChecker(conndb string) *healthChecker {
+	hc := &healthChecker{}
+	hc.Server = health.NewServer()
+	hc.conndb = conndb
+	hc.done = make(chan struct{})
+	return hc
+}
+
+// update пересчитывает статус готовности сервиса.
+func (hc *healthChecker) update(ctx context.Context) {
+	var ready bool
+	if hc.readiness != nil {
+		ready = hc.readiness.Ready(ctx).OK()
+	} else {
+		ready = dbh.Ready(hc.conndb)
+	}
+	st := healthpb.HealthCheckResponse_SERVING
+	if !ready {
+		st = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	// пустое имя сервиса означает состояние сервера в целом
+	hc.SetServingStatus("", st)
+	hc.SetServingStatus(pb.ShortURL_ServiceDesc.ServiceName, st)
+}
+
+// Check обновляет статус и возвращает его клиенту.
+func (hc *healthChecker) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	hc.update(ctx)
+	return hc.Server.Check(ctx, in)
+}
+
+// run периодически обновляет статус, чтобы подписчики Watch узнавали об изменениях.
+func (hc *healthChecker) run() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		hc.update(context.Background())
+		select {
+		case <-ticker.C:
+		case <-hc.done:
+			logger.Debug("health checker stopped")
+			return
+		}
+	}
+}
+
+// stop переводит все сервисы в состояние NOT_SERVING и останавливает фоновую проверку.
+// Повторный вызов ничего не делает.
+func (hc *healthChecker) stop() {
+	hc.stopOnce.Do(func() {
+		close(hc.done)
+		hc.Shutdown()
+	})
+}
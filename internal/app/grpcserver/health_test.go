@@ -0,0 +1,49 @@
+package rpcsrv
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	apphealth "github.com/jon69/shorturl/internal/app/health"
+	pb "github.com/jon69/shorturl/proto"
+)
+
+func TestHealthChecker(t *testing.T) {
+	var dbErr error
+	readiness := apphealth.NewChecker(0)
+	readiness.Add("db", func(context.Context) error { return dbErr })
+	hc := newHealthChecker("")
+	hc.readiness = readiness
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := hc.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(pb.ShortURL_ServiceDesc.ServiceName))
+
+	dbErr = errors.New("db is down")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(pb.ShortURL_ServiceDesc.ServiceName))
+
+	dbErr = nil
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+
+	// после остановки сервис не обслуживает запросы, повторная остановка допустима
+	done := make(chan struct{})
+	go func() {
+		hc.run()
+		close(done)
+	}()
+	hc.stop()
+	hc.stop()
+	<-done
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+}
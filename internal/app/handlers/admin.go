@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+// MyAdminURL хранит информацию о URL для выдачи администратору.
+type MyAdminURL struct {
+	storage.AdminURL
+	// ShortURL - полная краткая ссылка.
+	ShortURL string `json:"short_url"`
+}
+
+// MyModerationRequest хранит параметры блокировки.
+type MyModerationRequest struct {
+	// Codes - краткие формы URL для массовой блокировки.
+	Codes []string `json:"codes,omitempty"`
+	// Reason - причина блокировки.
+	Reason string `json:"reason"`
+}
+
+// MyTakedownResult хранит результат массовой блокировки.
+type MyTakedownResult struct {
+	// Disabled - заблокированные URL.
+	Disabled []string `json:"disabled"`
+	// NotFound - ненайденные URL.
+	NotFound []string `json:"not_found"`
+	// Failed - URL, блокировку которых не удалось сохранить.
+	Failed []string `json:"failed"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	txBz, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("can not marshal response", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(code)
+	w.Write(txBz)
+}
+
+func (h *MyHandler) readModerationRequest(w http.ResponseWriter, r *http.Request) (MyModerationRequest, bool) {
+	var req MyModerationRequest
+	b, err := h.limits.ReadBody(r)
+	if err != nil {
+		limits.WriteError(w, err)
+		return req, false
+	}
+	if len(b) == 0 {
+		return req, true
+	}
+	if err := json.Unmarshal(b, &req); err != nil {
+		logger.FromContext(r.Context()).Warn("can not unmarshal moderation request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// ServeAdminSearchLinks обрабатывает GET запрос на поиск ссылок по краткой форме (code),
+// подстроке исходного URL (dest), владельцу (owner) или домену (domain), по умолчанию на всех доменах.
+func (h *MyHandler) ServeAdminSearchLinks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := storage.URLFilter{Code: q.Get("code"), Destination: q.Get("dest"), Owner: q.Get("owner"), AllDomains: true}
+	if name := q.Get("domain"); name != "" {
+		d, err := h.domains.Find(name, "")
+		if err != nil {
+			writeDomainError(w, err)
+			return
+		}
+		f.Domain, f.AllDomains = d.Namespace, false
+	}
+	if limit := q.Get("limit"); limit != "" {
+		var err error
+		if f.Limit, err = strconv.Atoi(limit); err != nil || f.Limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	urls := []MyAdminURL{}
+	for _, u := range h.urlstorage.SearchURLs(f) {
+		urls = append(urls, MyAdminURL{AdminURL: u, ShortURL: h.domains.ByNamespace(u.Domain).ShortURL(u.Code)})
+	}
+	writeJSON(w, http.StatusOK, urls)
+}
+
+// ServeAdminDisableLink обрабатывает POST запрос на блокировку ссылки.
+func (h *MyHandler) ServeAdminDisableLink(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.readModerationRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "empty reason", http.StatusBadRequest)
+		return
+	}
+	h.setLinkDisabled(w, r, chi.URLParam(r, "code"), true, req.Reason)
+}
+
+// ServeAdminEnableLink обрабатывает POST запрос на разблокировку ссылки.
+func (h *MyHandler) ServeAdminEnableLink(w http.ResponseWriter, r *http.Request) {
+	h.setLinkDisabled(w, r, chi.URLParam(r, "code"), false, "")
+}
+
+func (h *MyHandler) setLinkDisabled(w http.ResponseWriter, r *http.Request, code string, disabled bool, reason string) {
+	d, ok := h.requestDomain(w, r)
+	if !ok {
+		return
+	}
+	if _, found := h.findURL(d.Namespace, code); !found {
+		http.Error(w, "not found "+code, http.StatusNotFound)
+		return
+	}
+	if !h.changeLinkState(r.Context(), d.Namespace, code, disabled, reason) {
+		http.Error(w, "can not change link state", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeLinkState меняет состояние блокировки ссылки и фиксирует изменение в журнале аудита.
+func (h *MyHandler) changeLinkState(ctx context.Context, ns string, code string, disabled bool, reason string) bool {
+	before, found := h.findURL(ns, code)
+	if !found || !h.urlstorage.SetURLDisabledContext(ctx, ns, code, disabled, reason) {
+		return false
+	}
+	if h.audit != nil {
+		op := audit.OpEnable
+		if disabled {
+			op = audit.OpDisable
+		}
+		after, _ := h.findURL(ns, code)
+		h.audit.Record(ctx, op, domains.Qualify(ns, code), audit.State(before), audit.State(after))
+	}
+	return true
+}
+
+// ServeAdminDeleteLink обрабатывает DELETE запрос на удаление произвольной ссылки.
+func (h *MyHandler) ServeAdminDeleteLink(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	d, ok := h.requestDomain(w, r)
+	if !ok {
+		return
+	}
+	before, found := h.findURL(d.Namespace, code)
+	if !found {
+		http.Error(w, "not found "+code, http.StatusNotFound)
+		return
+	}
+	if before.Deleted {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	// удаление выполняется в фоне и записывается в журнал аудита хранилищем
+	if !h.urlstorage.DelUserURLContext(r.Context(), d.Namespace, before.Owner, code) {
+		http.Error(w, "can not delete "+code, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ServeAdminTakedown обрабатывает POST запрос на массовую блокировку ссылок.
+func (h *MyHandler) ServeAdminTakedown(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.readModerationRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Reason == "" || len(req.Codes) == 0 {
+		http.Error(w, "codes and reason are required", http.StatusBadRequest)
+		return
+	}
+	if err := h.limits.CheckBatch(len(req.Codes)); err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	d, ok := h.requestDomain(w, r)
+	if !ok {
+		return
+	}
+	result := MyTakedownResult{Disabled: []string{}, NotFound: []string{}, Failed: []string{}}
+	for _, code := range req.Codes {
+		switch _, found := h.findURL(d.Namespace, code); {
+		case !found:
+			result.NotFound = append(result.NotFound, code)
+		case h.changeLinkState(r.Context(), d.Namespace, code, true, req.Reason):
+			result.Disabled = append(result.Disabled, code)
+		default:
+			result.Failed = append(result.Failed, code)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ServeAdminUserCounts обрабатывает GET запрос на получение количества ссылок каждого пользователя.
+func (h *MyHandler) ServeAdminUserCounts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.urlstorage.UserURLCounts())
+}
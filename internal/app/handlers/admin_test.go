@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+func TestAdminLinks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.Mkdir(dir, 0700))
+	st := storage.NewStorage(filepath.Join(dir, "urls.json"), "")
+	ctx := context.Background()
+	_, c1 := st.PutUserURLContext(ctx, "", "u1", "http://golang.org/doc")
+	_, c2 := st.PutUserURLContext(ctx, "", "u1", "http://example.com")
+	_, c3 := st.PutUserURLContext(ctx, "", "u2", "http://golang.org/pkg")
+
+	hendl := MakeMyHandler("", st)
+	hendl.SetBaseURL("http://localhost:8080")
+	r := chi.NewRouter()
+	r.Get("/api/admin/links", hendl.ServeAdminSearchLinks)
+	r.Post("/api/admin/links/takedown", hendl.ServeAdminTakedown)
+	r.Post("/api/admin/links/{code}/disable", hendl.ServeAdminDisableLink)
+	r.Post("/api/admin/links/{code}/enable", hendl.ServeAdminEnableLink)
+	r.Delete("/api/admin/links/{code}", hendl.ServeAdminDeleteLink)
+	r.Get("/api/admin/users", hendl.ServeAdminUserCounts)
+	do := func(method string, url string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+	search := func(query string) []MyAdminURL {
+		w := do(http.MethodGet, "/api/admin/links?"+query, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var urls []MyAdminURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &urls))
+		return urls
+	}
+
+	found := search("code=" + c2)
+	require.Len(t, found, 1)
+	assert.Equal(t, "http://localhost:8080/"+c2, found[0].ShortURL)
+	assert.Len(t, search("dest=golang.org"), 2)
+	found = search("owner=u2")
+	require.Len(t, found, 1)
+	assert.Equal(t, c3, found[0].Code)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/admin/links/"+c1+"/disable", `{}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/admin/links/missing/disable", `{"reason": "spam"}`).Code)
+	require.Equal(t, http.StatusNoContent, do(http.MethodPost, "/api/admin/links/"+c1+"/disable", `{"reason": "phishing"}`).Code)
+	found = search("code=" + c1)
+	assert.True(t, found[0].Disabled)
+	assert.Equal(t, "phishing", found[0].Reason)
+	require.Equal(t, http.StatusNoContent, do(http.MethodPost, "/api/admin/links/"+c1+"/enable", "").Code)
+	found = search("code=" + c1)
+	assert.False(t, found[0].Disabled)
+
+	w := do(http.MethodPost, "/api/admin/links/takedown", `{"codes": ["`+c1+`", "missing"], "reason": "spam"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"disabled": ["`+c1+`"], "not_found": ["missing"], "failed": []}`, w.Body.String())
+
+	w = do(http.MethodGet, "/api/admin/users", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"uid": "u1", "count": 2}, {"uid": "u2", "count": 1}]`, w.Body.String())
+
+	// повторное удаление ничего не меняет
+	assert.Equal(t, http.StatusAccepted, do(http.MethodDelete, "/api/admin/links/"+c2, "").Code)
+	require.NoError(t, st.Close(ctx))
+	assert.Equal(t, http.StatusAccepted, do(http.MethodDelete, "/api/admin/links/"+c2, "").Code)
+	assert.Equal(t, 0, st.DeleteQueueDepth())
+	urls, _ := st.Counts()
+	assert.Equal(t, 2, urls)
+
+	// блокировку, которую не удалось сохранить, возвращаем отдельно от ненайденных
+	require.NoError(t, os.RemoveAll(dir))
+	w = do(http.MethodPost, "/api/admin/links/takedown", `{"codes": ["`+c3+`", "missing"], "reason": "spam"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"disabled": [], "not_found": ["missing"], "failed": ["`+c3+`"]}`, w.Body.String())
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/auth"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// MyAPIKeyRequest хранит параметры создаваемого API ключа.
+type MyAPIKeyRequest struct {
+	// Name - описание ключа.
+	Name string `json:"name"`
+	// Owner - идентификатор владельца, если не задан, создается новый.
+	Owner string `json:"owner"`
+	// Scopes - права ключа через запятую.
+	Scopes string `json:"scopes"`
+}
+
+// MyAPIKeyResult хранит созданный API ключ для выдачи.
+type MyAPIKeyResult struct {
+	apikey.Key
+	// APIKey - сам ключ, показывается только один раз.
+	APIKey string `json:"api_key"`
+}
+
+// ServePostAPIKey обрабатывает POST запрос на создание API ключа.
+func (h *MyHandler) ServePostAPIKey(w http.ResponseWriter, r *http.Request) {
+	b, err := h.limits.ReadBody(r)
+	if err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	var req MyAPIKeyRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		logger.FromContext(r.Context()).Warn("can not unmarshal api key request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	owner := strings.TrimSpace(req.Owner)
+	if owner == "" {
+		owner = uuid.NewV4().String()
+	}
+
+	plain, k, err := apikey.Generate(req.Name, owner, scopes)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can not generate api key", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !h.urlstorage.PutAPIKey(k) {
+		http.Error(w, "can not store api key", http.StatusInternalServerError)
+		return
+	}
+	logger.FromContext(r.Context()).Info("created api key", "key_id", k.ID, "owner", k.Owner)
+
+	k.Hash = ""
+	if h.audit != nil {
+		h.audit.Record(r.Context(), audit.OpAPIKeyCreate, k.ID, "", audit.State(k))
+	}
+	txBz, err := json.Marshal(MyAPIKeyResult{Key: k, APIKey: plain})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(txBz)
+}
+
+// ServeGetAPIKeys обрабатывает GET запрос на получение списка API ключей.
+func (h *MyHandler) ServeGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	txBz, err := json.Marshal(h.urlstorage.GetAPIKeys())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(txBz)
+}
+
+// ServeDeleteAPIKey обрабатывает DELETE запрос на отзыв API ключа.
+func (h *MyHandler) ServeDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var before apikey.Key
+	for _, k := range h.urlstorage.GetAPIKeys() {
+		if k.ID == id {
+			before = k
+		}
+	}
+	if !h.urlstorage.RevokeAPIKey(id) {
+		http.Error(w, "not found "+id, http.StatusNotFound)
+		return
+	}
+	logger.FromContext(r.Context()).Info("revoked api key", "key_id", id)
+	if h.audit != nil {
+		after := before
+		after.Revoked = true
+		h.audit.Record(r.Context(), audit.OpAPIKeyRevoke, id, audit.State(before), audit.State(after))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+// SetAuditLog устанавливает журнал аудита изменяющих операций.
+func (h *MyHandler) SetAuditLog(l *audit.Logger) {
+	h.audit = l
+}
+
+// findURL возвращает текущее состояние ссылки по пространству ссылок домена и краткой форме.
+func (h *MyHandler) findURL(ns string, code string) (storage.AdminURL, bool) {
+	found := h.urlstorage.SearchURLs(storage.URLFilter{Domain: ns, Code: code})
+	if len(found) == 0 {
+		return storage.AdminURL{}, false
+	}
+	return found[0], true
+}
+
+// auditCreate фиксирует в журнале создание новой ссылки.
+func (h *MyHandler) auditCreate(ctx context.Context, ns string, code string) {
+	if h.audit == nil {
+		return
+	}
+	if after, ok := h.findURL(ns, code); ok {
+		h.audit.Record(ctx, audit.OpCreate, domains.Qualify(ns, code), "", audit.State(after))
+	}
+}
+
+// ServeAdminAudit обрабатывает GET запрос на получение записей журнала аудита
+// за интервал времени [from, to) в формате RFC3339 и по пользователю (actor).
+func (h *MyHandler) ServeAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if h.audit == nil {
+		http.Error(w, "audit log disabled", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	f := audit.Filter{Actor: q.Get("actor")}
+	var err error
+	if from := q.Get("from"); from != "" {
+		if f.From, err = time.Parse(time.RFC3339, from); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if f.To, err = time.Parse(time.RFC3339, to); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit := q.Get("limit"); limit != "" {
+		if f.Limit, err = strconv.Atoi(limit); err != nil || f.Limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := h.audit.Query(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []audit.Record{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
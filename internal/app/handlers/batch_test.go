@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+func TestShortenBatch(t *testing.T) {
+	st := storage.NewStorage("", "")
+	hendl := MakeMyHandler("", st)
+	hendl.SetBaseURL("http://localhost:8080")
+	batch := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		hendl.ServeShortenPostBatchHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body)))
+		return w
+	}
+
+	// пакет с пустым URL не сохраняется частично
+	w := batch(`[{"correlation_id": "1", "original_url": "http://a.ru"}, {"correlation_id": "2", "original_url": ""}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, st.SearchURLs(storage.URLFilter{AllDomains: true}))
+
+	w = batch(`[{"correlation_id": "1", "original_url": "http://a.ru"}, {"correlation_id": "2", "original_url": "http://b.ru"}]`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.JSONEq(t, `[{"correlation_id": "1", "short_url": "http://localhost:8080/1"},
+		{"correlation_id": "2", "short_url": "http://localhost:8080/2"}]`, w.Body.String())
+}
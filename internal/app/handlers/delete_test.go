@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+func TestDeleteOwnLinksOnly(t *testing.T) {
+	st := storage.NewStorage("", "")
+	ctx := context.Background()
+	_, c1 := st.PutUserURLContext(ctx, "", "u1", "http://golang.org")
+	_, c2 := st.PutUserURLContext(ctx, "", "u2", "http://example.com")
+
+	hendl := MakeMyHandler("", st)
+	hendl.SetBaseURL("http://localhost:8080")
+	r := chi.NewRouter()
+	r.Delete("/api/user/urls", hendl.ServeDeleteBatchHTTP)
+	r.Delete("/api/admin/links/{code}", hendl.ServeAdminDeleteLink)
+	deleted := func(code string) bool {
+		require.NoError(t, st.Close(ctx))
+		found := st.SearchURLs(storage.URLFilter{Code: code})
+		require.Len(t, found, 1)
+		return found[0].Deleted
+	}
+
+	// u2 удаляет свою и чужую ссылку: удаляется только своя
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["`+c1+`", "`+c2+`"]`))
+	req = req.WithContext(context.WithValue(req.Context(), CTXKey{}, "u2"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.False(t, deleted(c1))
+	assert.True(t, deleted(c2))
+
+	// администратор удаляет ссылку от имени ее владельца
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/admin/links/"+c1, nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.True(t, deleted(c1))
+}
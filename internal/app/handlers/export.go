@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+// Форматы выгрузки и загрузки ссылок пользователя.
+const (
+	// FormatCSV - CSV с заголовком из имен полей ExportURL.
+	FormatCSV = "csv"
+	// FormatJSONL - по одному JSON объекту ExportURL в строке.
+	FormatJSONL = "jsonl"
+)
+
+// exportPageSize - количество ссылок, считываемых из хранилища за один раз при выгрузке.
+const exportPageSize = 500
+
+// exportColumns - столбцы CSV выгрузки, теги перечисляются через запятую в одном столбце.
+var exportColumns = []string{"domain", "code", "short_url", "original_url", "clicks", "deleted", "title", "note", "tags"}
+
+// ExportURL - ссылка пользователя в выгрузке.
+type ExportURL struct {
+	// Domain - домен ссылки.
+	Domain string `json:"domain"`
+	// Code - краткая форма URL.
+	Code string `json:"code"`
+	// ShortURL - краткая ссылка.
+	ShortURL string `json:"short_url"`
+	// OriginalURL - исходный URL.
+	OriginalURL string `json:"original_url"`
+	// Clicks - количество переходов по ссылке.
+	Clicks uint64 `json:"clicks"`
+	// Deleted - признак удаления.
+	Deleted bool `json:"deleted"`
+	// Title - заголовок.
+	Title string `json:"title"`
+	// Note - заметка.
+	Note string `json:"note"`
+	// Tags - теги.
+	Tags []string `json:"tags"`
+}
+
+// Состояния строки загрузки.
+const (
+	// ImportCreated - ссылка создана.
+	ImportCreated = "created"
+	// ImportExists - такой URL уже сокращен на домене.
+	ImportExists = "exists"
+	// ImportSkipped - строка пропущена, т.к. ссылка в выгрузке удалена.
+	ImportSkipped = "skipped"
+	// ImportError - строка содержит ошибку.
+	ImportError = "error"
+)
+
+// ImportResult - результат загрузки одной строки.
+type ImportResult struct {
+	// Line - номер строки во входных данных, начиная с 1.
+	Line int `json:"line"`
+	// OriginalURL - исходный URL.
+	OriginalURL string `json:"original_url,omitempty"`
+	// ShortURL - краткая ссылка.
+	ShortURL string `json:"short_url,omitempty"`
+	// Status - состояние строки.
+	Status string `json:"status"`
+	// Error - описание ошибки при Status == ImportError.
+	Error string `json:"error,omitempty"`
+}
+
+// exportFormat возвращает формат из параметра запроса format, иначе из заголовка contentType.
+func exportFormat(r *http.Request, contentType string) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get(contentType))
+		switch mediaType {
+		case "application/x-ndjson", "application/jsonl":
+			format = FormatJSONL
+		default:
+			format = FormatCSV
+		}
+	}
+	return format, format == FormatCSV || format == FormatJSONL
+}
+
+// ServeExportURLs обрабатывает GET запрос на выгрузку ссылок пользователя в формате format (csv или jsonl).
+// Ссылки отбираются и упорядочиваются как в ServeGetAllURLS, но выдаются все сразу потоком.
+func (h *MyHandler) ServeExportURLs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format, ok := exportFormat(r, "Accept")
+	if !ok {
+		http.Error(w, "format must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+	q, ok := h.parseURLQuery(w, r)
+	if !ok {
+		return
+	}
+
+	uid := "1"
+	if v := ctx.Value(CTXKey{}); v != nil {
+		uid = fmt.Sprintf("%v", v)
+	}
+	shortURL := func(ns string, code string) string { return h.domains.ByNamespace(ns).ShortURL(code) }
+
+	cw := csv.NewWriter(w)
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	started := false
+	var writeErr error
+	err := h.urlstorage.EachUserURLPage(ctx, uid, q, exportPageSize, shortURL, func(page storage.URLPage) error {
+		if !started {
+			started = true
+			if format == FormatCSV {
+				w.Header().Set("content-type", "text/csv; charset=utf-8")
+			} else {
+				w.Header().Set("content-type", "application/x-ndjson")
+			}
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"urls.%s\"", format))
+			w.Header().Set(HeaderTotalCount, strconv.Itoa(page.Total))
+			w.WriteHeader(http.StatusOK)
+			if format == FormatCSV {
+				cw.Write(exportColumns)
+			}
+		}
+		for _, u := range page.URLs {
+			e := ExportURL{Domain: h.domains.ByNamespace(u.Domain).Host, Code: u.Code, ShortURL: u.ShortURL,
+				OriginalURL: u.OriginalURL, Clicks: u.Clicks, Deleted: u.Deleted, Title: u.Title, Note: u.Note, Tags: u.Tags}
+			if e.Tags == nil {
+				e.Tags = []string{}
+			}
+			if format == FormatCSV {
+				writeErr = cw.Write([]string{e.Domain, e.Code, e.ShortURL, csvCell(e.OriginalURL),
+					strconv.FormatUint(e.Clicks, 10), strconv.FormatBool(e.Deleted), csvCell(e.Title), csvCell(e.Note),
+					csvCell(strings.Join(e.Tags, ","))})
+			} else {
+				writeErr = enc.Encode(e)
+			}
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+		cw.Flush()
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return ctx.Err()
+	})
+	switch {
+	case err == nil:
+	case !started:
+		logger.FromContext(ctx).Error("can not list urls", "error", err)
+		http.Error(w, "cant export urls", http.StatusInternalServerError)
+	case errors.Is(err, writeErr) || errors.Is(err, ctx.Err()):
+		logger.FromContext(ctx).Warn("can not write export", "error", err)
+	default:
+		// заголовок уже отправлен, выгрузка обрывается
+		logger.FromContext(ctx).Error("can not list urls", "error", err)
+	}
+}
+
+// csvFormulaPrefixes - первые символы ячейки, с которых табличные редакторы начинают формулу.
+// Апостроф также экранируется, чтобы загрузка однозначно снимала экранирование.
+const csvFormulaPrefixes = "=+-@\t\r'"
+
+// csvCell экранирует апострофом значение, которое табличный редактор выполнил бы как формулу.
+func csvCell(v string) string {
+	if v != "" && strings.IndexByte(csvFormulaPrefixes, v[0]) >= 0 {
+		return "'" + v
+	}
+	return v
+}
+
+// csvValue снимает экранирование, добавленное csvCell.
+func csvValue(v string) string {
+	if len(v) > 1 && v[0] == '\'' && strings.IndexByte(csvFormulaPrefixes, v[1]) >= 0 {
+		return v[1:]
+	}
+	return v
+}
+
+// importRow - строка загрузки.
+type importRow struct {
+	line        int
+	domain      string
+	originalURL string
+	deleted     bool
+	meta        storage.Meta
+}
+
+// errNoURLColumn - в заголовке CSV нет столбца original_url.
+var errNoURLColumn = errors.New("csv header must contain original_url")
+
+// readCSVRows разбирает CSV с заголовком, обязателен столбец original_url,
+// учитываются также необязательные domain, deleted, title, note и tags.
+func readCSVRows(b []byte) ([]importRow, error) {
+	cr := csv.NewReader(bytes.NewReader(b))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	urlColumn, ok := columns["original_url"]
+	if !ok {
+		return nil, errNoURLColumn
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		row := importRow{line: line, domain: field(record, "domain")}
+		if urlColumn < len(record) {
+			row.originalURL = csvValue(strings.TrimSpace(record[urlColumn]))
+		}
+		row.deleted, _ = strconv.ParseBool(field(record, "deleted"))
+		row.meta = storage.Meta{Title: csvValue(field(record, "title")), Note: csvValue(field(record, "note"))}
+		if tags := csvValue(field(record, "tags")); tags != "" {
+			row.meta.Tags = strings.Split(tags, ",")
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readJSONLRows разбирает по одному JSON объекту ExportURL в строке, пустые строки пропускаются.
+func readJSONLRows(b []byte) ([]importRow, error) {
+	var rows []importRow
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, len(b)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var e ExportURL
+		if err := json.Unmarshal(text, &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, importRow{line: line, domain: e.Domain, originalURL: e.OriginalURL, deleted: e.Deleted,
+			meta: storage.Meta{Title: e.Title, Note: e.Note, Tags: e.Tags}})
+	}
+	return rows, scanner.Err()
+}
+
+// ServeImportURLs обрабатывает POST запрос на загрузку ссылок в формате выгрузки ServeExportURLs.
+// Формат задается параметром format или заголовком Content-Type. Ссылки создаются как в пакетном
+// сокращении: уже сокращенный на домене URL не дублируется. Ответ содержит результат по каждой строке.
+func (h *MyHandler) ServeImportURLs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format, ok := exportFormat(r, "Content-Type")
+	if !ok {
+		http.Error(w, "format must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+	b, err := h.limits.ReadBody(r)
+	if err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	var rows []importRow
+	if format == FormatCSV {
+		rows, err = readCSVRows(b)
+	} else {
+		rows, err = readJSONLRows(b)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Warn("can not parse import", "format", format, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.limits.CheckBatch(len(rows)); err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+
+	uid := userID(r)
+	results := make([]ImportResult, 0, len(rows))
+	for _, row := range rows {
+		res := ImportResult{Line: row.line, OriginalURL: row.originalURL}
+		if row.deleted {
+			res.Status = ImportSkipped
+			results = append(results, res)
+			continue
+		}
+		if row.originalURL == "" {
+			err = errors.New("empty original_url")
+		} else if err = h.limits.CheckURL(row.originalURL); err == nil {
+			row.meta, err = storage.NormalizeMeta(row.meta)
+		}
+		if err != nil {
+			res.Status, res.Error = ImportError, err.Error()
+			results = append(results, res)
+			continue
+		}
+		d, err := h.domains.Select(row.domain, r.Host, uid)
+		if err != nil {
+			res.Status, res.Error = ImportError, err.Error()
+			results = append(results, res)
+			continue
+		}
+		iou, code := h.shorten(ctx, d, row.originalURL, row.meta)
+		res.ShortURL = d.ShortURL(code)
+		if iou == 1 {
+			res.Status = ImportCreated
+		} else {
+			res.Status = ImportExists
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
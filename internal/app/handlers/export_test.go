@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+func TestExportImport(t *testing.T) {
+	hendl := MakeMyHandler("", storage.NewStorage("", ""))
+	hendl.SetBaseURL("http://localhost:8080")
+
+	importURLs := func(url string, body string) []ImportResult {
+		w := httptest.NewRecorder()
+		hendl.ServeImportURLs(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var results []ImportResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		return results
+	}
+
+	results := importURLs("/api/user/urls/import",
+		"original_url,deleted,tags\nhttp://a.ru,false,\"Go, news\"\nhttp://b.ru,true,\n,false,\n")
+	require.Len(t, results, 3)
+	assert.Equal(t, ImportResult{Line: 2, OriginalURL: "http://a.ru", ShortURL: "http://localhost:8080/1", Status: ImportCreated}, results[0])
+	assert.Equal(t, ImportSkipped, results[1].Status)
+	assert.Equal(t, ImportError, results[2].Status)
+
+	results = importURLs("/api/user/urls/import?format=jsonl",
+		"{\"original_url\":\"http://c.ru\"}\n\n{\"original_url\":\"http://d.ru\",\"domain\":\"other.ru\"}\n")
+	require.Len(t, results, 2)
+	assert.Equal(t, ImportCreated, results[0].Status)
+	assert.Equal(t, 3, results[1].Line)
+	assert.Equal(t, ImportError, results[1].Status)
+
+	w := httptest.NewRecorder()
+	hendl.ServeImportURLs(w, httptest.NewRequest(http.MethodPost, "/api/user/urls/import", strings.NewReader("url\nhttp://e.ru\n")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	hendl.ServeExportURLs(w, httptest.NewRequest(http.MethodGet, "/api/user/urls/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "domain,code,short_url,original_url,clicks,deleted,title,note,tags\n"+
+		"localhost,1,http://localhost:8080/1,http://a.ru,0,false,,,\"go,news\"\n"+
+		"localhost,2,http://localhost:8080/2,http://c.ru,0,false,,,\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	hendl.ServeExportURLs(w, httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format=jsonl", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	// выгрузка загружается обратно на тот же домен
+	results = importURLs("/api/user/urls/import?format=jsonl", w.Body.String())
+	require.Len(t, results, 2)
+	assert.Equal(t, "http://c.ru", results[1].OriginalURL)
+	assert.NotEqual(t, ImportError, results[1].Status)
+
+	w = httptest.NewRecorder()
+	hendl.ServeExportURLs(w, httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportCSVFormulas(t *testing.T) {
+	st := storage.NewStorage("", "")
+	hendl := MakeMyHandler("", st)
+	hendl.SetBaseURL("http://localhost:8080")
+	meta := storage.Meta{Title: "=HYPERLINK(\"http://evil\")", Note: "@SUM(A1)", Tags: []string{"+1", "-x"}}
+	st.PutUserURLMetaContext(context.Background(), "", "1", "http://a.ru", meta)
+	st.PutUserURLMetaContext(context.Background(), "", "1", "http://b.ru", storage.Meta{Title: "'quoted", Note: "\tcmd"})
+
+	w := httptest.NewRecorder()
+	hendl.ServeExportURLs(w, httptest.NewRequest(http.MethodGet, "/api/user/urls/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "domain,code,short_url,original_url,clicks,deleted,title,note,tags\n"+
+		"localhost,1,http://localhost:8080/1,http://a.ru,0,false,\"'=HYPERLINK(\"\"http://evil\"\")\",'@SUM(A1),\"'+1,-x\"\n"+
+		"localhost,2,http://localhost:8080/2,http://b.ru,0,false,''quoted,'\tcmd,\n", w.Body.String())
+
+	// при загрузке экранирование снимается
+	rows, err := readCSVRows(w.Body.Bytes())
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, meta, rows[0].meta)
+	assert.Equal(t, "'quoted", rows[1].meta.Title)
+	assert.Equal(t, "\tcmd", rows[1].meta.Note)
+}
+
+func TestExportPages(t *testing.T) {
+	st := storage.NewStorage("", "")
+	hendl := MakeMyHandler("", st)
+	hendl.SetBaseURL("http://localhost:8080")
+	for i := 0; i < exportPageSize+3; i++ {
+		st.PutUserURLContext(context.Background(), "", "1", fmt.Sprintf("http://example.com/%d", i))
+	}
+
+	var sizes []int
+	shortURL := func(ns string, code string) string { return code }
+	// ссылки выдаются страницами размера выгрузки независимо от limit запроса
+	err := st.EachUserURLPage(context.Background(), "1", storage.URLQuery{Limit: 1}, exportPageSize, shortURL, func(page storage.URLPage) error {
+		sizes = append(sizes, len(page.URLs))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{exportPageSize, 3}, sizes)
+
+	w := httptest.NewRecorder()
+	hendl.ServeExportURLs(w, httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format=jsonl", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, strconv.Itoa(exportPageSize+3), w.Header().Get(HeaderTotalCount))
+	assert.Equal(t, exportPageSize+3, strings.Count(w.Body.String(), "\n"))
+}
@@ -2,15 +2,23 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/jon69/shorturl/internal/app/audit"
 	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/metrics"
 	"github.com/jon69/shorturl/internal/app/storage"
+	"github.com/jon69/shorturl/internal/app/titles"
+	"github.com/jon69/shorturl/internal/app/webui"
 )
 
 // CTXKey структура для хранения конекста HTTP запроса с информацией о польльзователе.
@@ -23,12 +31,16 @@ type MyHandler struct {
 	urlstorage *storage.StorageURL
 	// baseURL - адрес (хост:порт) для выдачи сохраненных URL.
 	baseURL string
+	// domains - домены кратких ссылок.
+	domains *domains.Registry
 	// conndb - параметры подключения к БД.
 	conndb string
-	// trustedSubNet - доверенная подсеть.
-	trustedSubNet string
-	// ipnet - подсеть
-	ipnet *net.IPNet
+	// audit - журнал аудита, nil если не ведется.
+	audit *audit.Logger
+	// limits - ограничения на размер запросов.
+	limits limits.Limits
+	// titles - загрузчик заголовков страниц, nil если заголовки не загружаются.
+	titles *titles.Fetcher
 }
 
 // MyHandler созает новый обработчик.
@@ -36,40 +48,82 @@ func MakeMyHandler(conndb string, urlstorage *storage.StorageURL) MyHandler {
 	h := MyHandler{}
 	h.urlstorage = urlstorage
 	h.conndb = conndb
-	h.trustedSubNet = ""
+	h.limits = limits.Default()
 	return h
 }
 
 // SetBaseURL устанавливает новое значение адреса запуска сервера обработки HTTP запросов.
+// Дополнительные домены при этом сбрасываются, их нужно задать после SetBaseURL.
 func (h *MyHandler) SetBaseURL(url string) {
 	h.baseURL = url
+	h.domains = domains.Single(url)
 }
 
-// SetTrustedSubNet устанавливает доверенную подсеть.
-func (h *MyHandler) SetTrustedSubNet(str string) {
-	if str == "" {
+// SetDomains устанавливает домены кратких ссылок.
+func (h *MyHandler) SetDomains(r *domains.Registry) {
+	h.domains = r
+	h.baseURL = r.Default().BaseURL
+}
+
+// userID возвращает идентификатор пользователя запроса или пустую строку.
+func userID(r *http.Request) string {
+	if v := r.Context().Value(CTXKey{}); v != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return ""
+}
+
+// writeDomainError отвечает клиенту на ошибку выбора домена.
+func writeDomainError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domains.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	_, ipnet, err := net.ParseCIDR(str)
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// createDomain выбирает домен для новой ссылки: явно указанный explicit или параметр запроса
+// domain, иначе по заголовку Host. При ошибке отвечает клиенту и возвращает false.
+func (h *MyHandler) createDomain(w http.ResponseWriter, r *http.Request, explicit string) (domains.Domain, bool) {
+	if explicit == "" {
+		explicit = r.URL.Query().Get("domain")
+	}
+	d, err := h.domains.Select(explicit, r.Host, userID(r))
 	if err != nil {
-		log.Print("error parse CIDR: " + err.Error())
-		return
+		logger.FromContext(r.Context()).Warn("can not select domain", "error", err)
+		writeDomainError(w, err)
+		return domains.Domain{}, false
 	}
-	h.trustedSubNet = str
-	h.ipnet = ipnet
+	return d, true
+}
+
+// requestDomain возвращает домен существующих ссылок: из параметра запроса domain,
+// иначе по заголовку Host. При ошибке отвечает клиенту и возвращает false.
+func (h *MyHandler) requestDomain(w http.ResponseWriter, r *http.Request) (domains.Domain, bool) {
+	d, err := h.domains.Find(r.URL.Query().Get("domain"), r.Host)
+	if err != nil {
+		writeDomainError(w, err)
+		return domains.Domain{}, false
+	}
+	return d, true
+}
+
+// SetLimits устанавливает ограничения на размер запросов.
+func (h *MyHandler) SetLimits(l limits.Limits) {
+	h.limits = l
+}
+
+// SetTitleFetcher устанавливает загрузчик заголовков страниц для новых ссылок без заголовка.
+func (h *MyHandler) SetTitleFetcher(f *titles.Fetcher) {
+	h.titles = f
 }
 
 // ServeGetPING обрабатывает запрос на проверку подключения к БД
 func (h *MyHandler) ServeGetPING(w http.ResponseWriter, r *http.Request) {
-	log.Println("ServeGetPING")
-	if h.conndb != "" {
-		if dbh.Ping(h.conndb) {
-			w.WriteHeader(http.StatusOK)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-	} else {
+	if dbh.Ready(h.conndb) {
 		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
@@ -81,70 +135,127 @@ func (h *MyHandler) ServeGetHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "The query parameter is missing", http.StatusBadRequest)
 		return
 	}
-	log.Print("parsed id = " + id)
 	var val string
 	var ok bool
 
+	// краткая форма ищется в пространстве ссылок домена, к которому пришел запрос
+	d := h.domains.ForHost(r.Host)
 	var isDel bool
-	val, ok, isDel = h.urlstorage.GetURL(id)
+	val, ok, isDel = h.urlstorage.GetURLContext(r.Context(), d.Namespace, id)
 
 	if ok {
-		log.Print("found value = " + val)
 		if isDel {
+			metrics.Redirect(metrics.RedirectGone)
 			w.WriteHeader(http.StatusGone)
 		} else {
+			metrics.Redirect(metrics.RedirectHit)
+			h.urlstorage.Click(d.Namespace, id)
 			w.Header().Set("Location", val)
 			w.WriteHeader(http.StatusTemporaryRedirect)
 		}
 	} else {
-		log.Print("not found id " + id)
+		metrics.Redirect(metrics.RedirectMiss)
+		logger.FromContext(r.Context()).Debug("short url not found", "domain", d.Host, "code", id)
 		http.Error(w, "not found "+id, http.StatusNotFound)
 	}
 }
 
-// ServeGetAllURLS обрабатывает GET запрос за получение всех URL.
-func (h *MyHandler) ServeGetAllURLS(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// MaxPageSize - наибольший размер страницы ссылок пользователя.
+const MaxPageSize = 1000
 
-	var urlsJSON []byte
-	var ok bool
+// Заголовки ответа со ссылками пользователя.
+const (
+	// HeaderTotalCount - количество ссылок, удовлетворяющих условиям, на всех страницах.
+	HeaderTotalCount = "X-Total-Count"
+	// HeaderNextCursor - курсор следующей страницы.
+	HeaderNextCursor = "X-Next-Cursor"
+)
 
-	if v := ctx.Value(CTXKey{}); v != nil {
-		_, urlsJSON, ok = h.urlstorage.GetUserURLS(fmt.Sprintf("%v", v), h.baseURL)
-	} else {
-		_, urlsJSON, ok = h.urlstorage.GetURLS(h.baseURL)
+// parseURLQuery разбирает параметры выдачи ссылок пользователя: limit, cursor, sort (created или clicks),
+// order (asc или desc), dest (подстрока исходного URL), tag и domain. При ошибке отвечает клиенту и возвращает false.
+func (h *MyHandler) parseURLQuery(w http.ResponseWriter, r *http.Request) (storage.URLQuery, bool) {
+	q := r.URL.Query()
+	uq := storage.URLQuery{AllDomains: true, Destination: q.Get("dest"), Sort: q.Get("sort"), Cursor: q.Get("cursor"),
+		Tag: strings.ToLower(strings.TrimSpace(q.Get("tag")))}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > MaxPageSize {
+			http.Error(w, fmt.Sprintf("limit must be from 1 to %d", MaxPageSize), http.StatusBadRequest)
+			return uq, false
+		}
+		uq.Limit = n
+	}
+	switch uq.Sort {
+	case "", storage.SortCreated, storage.SortClicks:
+	default:
+		http.Error(w, "sort must be created or clicks", http.StatusBadRequest)
+		return uq, false
 	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		uq.Desc = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return uq, false
+	}
+	if name := q.Get("domain"); name != "" {
+		d, err := h.domains.Find(name, "")
+		if err != nil {
+			writeDomainError(w, err)
+			return uq, false
+		}
+		uq.Domain, uq.AllDomains = d.Namespace, false
+	}
+	return uq, true
+}
 
+// ServeGetAllURLS обрабатывает GET запрос за получение ссылок пользователя со всех доменов.
+// Без параметров выдает все ссылки в порядке создания, параметры описаны в parseURLQuery.
+// Курсор следующей страницы передается в заголовках X-Next-Cursor и Link.
+func (h *MyHandler) ServeGetAllURLS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q, ok := h.parseURLQuery(w, r)
 	if !ok {
+		return
+	}
+
+	uid := "1"
+	if v := ctx.Value(CTXKey{}); v != nil {
+		uid = fmt.Sprintf("%v", v)
+	}
+	// ссылки пользователя выдаются со всех доменов, каждая со своим базовым URL
+	shortURL := func(ns string, code string) string { return h.domains.ByNamespace(ns).ShortURL(code) }
+	page, err := h.urlstorage.ListUserURLs(ctx, uid, q, shortURL)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.FromContext(ctx).Error("can not list urls", "error", err)
 		http.Error(w, "cant get all urls", http.StatusInternalServerError)
 		return
 	}
 
-	if len(urlsJSON) == 0 {
+	if page.Total == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-
-	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(urlsJSON)
+	w.Header().Set(HeaderTotalCount, strconv.Itoa(page.Total))
+	if page.Next != "" {
+		w.Header().Set(HeaderNextCursor, page.Next)
+		next := *r.URL
+		values := next.Query()
+		values.Set("cursor", page.Next)
+		next.RawQuery = values.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	writeJSON(w, http.StatusOK, page.URLs)
 }
 
 // ServeGetStats обрабатывает GET запрос за получение статистики.
+// Доступ ограничивается на уровне маршрутизации доверенными подсетями.
 func (h *MyHandler) ServeGetStats(w http.ResponseWriter, r *http.Request) {
-	realIP := r.Header.Get("X-Real-IP")
-	ip := net.ParseIP(realIP)
-
-	if h.trustedSubNet == "" || ip == nil {
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
-	if !h.ipnet.Contains(ip) {
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
 	statJSON, ok := h.urlstorage.GetStat()
 
 	if !ok {
@@ -161,30 +272,37 @@ func (h *MyHandler) ServeGetStats(w http.ResponseWriter, r *http.Request) {
 func (h *MyHandler) ServePostHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	// читаем Body
-	b, err := io.ReadAll(r.Body)
+	b, err := h.limits.ReadBody(r)
 	// обрабатываем ошибку
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		limits.WriteError(w, err)
 		return
 	}
 	url := string(b)
-	log.Print("received body = " + url)
+	// браузер отправляет форму веб-интерфейса и ожидает в ответ страницу
+	form := webui.WantsHTML(r)
+	var domain string
+	if form {
+		url, domain = webui.ParseForm(b)
+	}
 	if url == "" {
 		http.Error(w, "empty url in body", http.StatusBadRequest)
 		return
 	}
-	log.Print("url = " + url)
-
-	var id string
-	var iou int
-	if v := ctx.Value(CTXKey{}); v != nil {
-		iou, id = h.urlstorage.PutUserURL(fmt.Sprintf("%v", v), url)
-	} else {
-		iou, id = h.urlstorage.PutURL(url)
+	if err := h.limits.CheckURL(url); err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	d, ok := h.createDomain(w, r, domain)
+	if !ok {
+		return
 	}
 
-	//id = h.urlstorage.PutURL(url)
-
+	iou, id := h.shorten(ctx, d, url, storage.Meta{})
+	if form {
+		webui.Created(w, r, d.ShortURL(id))
+		return
+	}
 	w.Header().Set("content-type", "plain/text")
 	if iou == 1 {
 		w.WriteHeader(http.StatusCreated)
@@ -192,13 +310,17 @@ func (h *MyHandler) ServePostHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusConflict)
 	}
 
-	w.Write([]byte(h.baseURL + "/" + id))
+	w.Write([]byte(d.ShortURL(id)))
 }
 
 // MyURL хранит информацию о URL.
 type MyURL struct {
 	// URL -  URL в формате JSON
 	URL string `json:"url"`
+	// Domain - домен краткой ссылки, по умолчанию домен запроса.
+	Domain string `json:"domain,omitempty"`
+	// Meta - описание ссылки.
+	storage.Meta
 }
 
 // MyURL хранит информацию о URL для выдачи.
@@ -211,40 +333,45 @@ type MyResultURL struct {
 func (h *MyHandler) ServeShortenPostHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	// читаем Body
-	b, err := io.ReadAll(r.Body)
+	b, err := h.limits.ReadBody(r)
 	// обрабатываем ошибку
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		limits.WriteError(w, err)
 		return
 	}
 	var murl MyURL
 	if err := json.Unmarshal(b, &murl); err != nil {
-		log.Print("Unmarshal fail ", err.Error())
+		logger.FromContext(ctx).Warn("can not unmarshal request", "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	url := murl.URL
-	log.Print("received body = " + url)
 	if url == "" {
 		http.Error(w, "empty url in body", http.StatusBadRequest)
 		return
 	}
-	log.Print("url = " + url)
+	if err := h.limits.CheckURL(url); err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	meta, err := storage.NormalizeMeta(murl.Meta)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, ok := h.createDomain(w, r, murl.Domain)
+	if !ok {
+		return
+	}
 	var mrurl MyResultURL
 
-	var iou int
-	var shortURL string
-	if v := ctx.Value(CTXKey{}); v != nil {
-		iou, shortURL = h.urlstorage.PutUserURL(fmt.Sprintf("%v", v), url)
-	} else {
-		iou, shortURL = h.urlstorage.PutURL(url)
-	}
-	mrurl.URL = h.baseURL + "/" + shortURL
+	iou, shortURL := h.shorten(ctx, d, url, meta)
+	mrurl.URL = d.ShortURL(shortURL)
 
 	txBz, err := json.Marshal(mrurl)
 	if err != nil {
-		log.Print("Marshal fail ", err.Error())
+		logger.FromContext(ctx).Error("can not marshal response", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -264,6 +391,8 @@ type MyBatchURL struct {
 	OriginalURL string `json:"original_url"`
 	// CorrelationID - идентификатор соответсвующего URL в формате JSON.
 	CorrelationID string `json:"correlation_id"`
+	// Meta - описание ссылки.
+	storage.Meta
 }
 
 // MyBatchURL хранит информацию о множестве URL для выдачи пользователю.
@@ -278,48 +407,61 @@ type MyBatchResultURL struct {
 func (h *MyHandler) ServeShortenPostBatchHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	// читаем Body
-	b, err := io.ReadAll(r.Body)
+	b, err := h.limits.ReadBody(r)
 	// обрабатываем ошибку
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		limits.WriteError(w, err)
 		return
 	}
 	var murls []MyBatchURL
 	if err := json.Unmarshal(b, &murls); err != nil {
-		log.Print("Unmarshal batch fail ", err.Error())
+		logger.FromContext(ctx).Warn("can not unmarshal batch request", "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := h.limits.CheckBatch(len(murls)); err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	// все URL, их длина и описания проверяются до сохранения, чтобы не сохранять пакет частично
+	for i, url := range murls {
+		if url.OriginalURL == "" {
+			http.Error(w, "empty original_url in body", http.StatusBadRequest)
+			return
+		}
+		if err := h.limits.CheckURL(url.OriginalURL); err != nil {
+			limits.WriteError(w, err)
+			return
+		}
+		if murls[i].Meta, err = storage.NormalizeMeta(url.Meta); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// все ссылки пакета создаются на одном домене
+	d, ok := h.createDomain(w, r, "")
+	if !ok {
+		return
+	}
 
 	var iou int
 	iou = 1
 	var mrurls []MyBatchResultURL
 	for _, url := range murls {
-		log.Println("received original_url=" + url.OriginalURL + " with correlation_id=" + url.CorrelationID)
-		if url.OriginalURL == "" {
-			http.Error(w, "empty original_url in body", http.StatusBadRequest)
-			return
-		}
 		var mrurl MyBatchResultURL
 		mrurl.CorrelationID = url.CorrelationID
 
-		var iouLocal int
-		var shortURL string
-		if v := ctx.Value(CTXKey{}); v != nil {
-			iouLocal, shortURL = h.urlstorage.PutUserURL(fmt.Sprintf("%v", v), url.OriginalURL)
-		} else {
-			iouLocal, shortURL = h.urlstorage.PutURL(url.OriginalURL)
-		}
+		iouLocal, shortURL := h.shorten(ctx, d, url.OriginalURL, url.Meta)
 		if iou != 2 && iouLocal == 2 {
 			iou = 2
 		}
-		mrurl.ShortURL = h.baseURL + "/" + shortURL
+		mrurl.ShortURL = d.ShortURL(shortURL)
 		mrurls = append(mrurls, mrurl)
 	}
 
 	txBz, err := json.Marshal(mrurls)
 	if err != nil {
-		log.Print("Marshal batch urls fail ", err.Error())
+		logger.FromContext(ctx).Error("can not marshal batch response", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -333,6 +475,24 @@ func (h *MyHandler) ServeShortenPostBatchHTTP(w http.ResponseWriter, r *http.Req
 	w.Write(txBz)
 }
 
+// shorten сохраняет URL пользователя запроса с описанием meta на домене d и фиксирует создание
+// в журнале аудита. Для новой ссылки без заголовка в фоне загружается заголовок страницы.
+// Возвращает 1, если ссылка создана, 2, если такой URL уже был сокращен, и краткую форму.
+func (h *MyHandler) shorten(ctx context.Context, d domains.Domain, url string, meta storage.Meta) (int, string) {
+	uid := "1"
+	if v := ctx.Value(CTXKey{}); v != nil {
+		uid = fmt.Sprintf("%v", v)
+	}
+	iou, code := h.urlstorage.PutUserURLMetaContext(ctx, d.Namespace, uid, url, meta)
+	if iou == 1 {
+		h.auditCreate(ctx, d.Namespace, code)
+		if meta.Title == "" && h.titles != nil {
+			h.titles.Enqueue(d.Namespace, code, url)
+		}
+	}
+	return iou, code
+}
+
 // MyURLS тип для представлние множетсва URL.
 type MyURLS []string
 
@@ -340,38 +500,47 @@ type MyURLS []string
 func (h *MyHandler) ServeDeleteBatchHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	// читаем Body
-	b, err := io.ReadAll(r.Body)
+	b, err := h.limits.ReadBody(r)
 	// обрабатываем ошибку
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		limits.WriteError(w, err)
 		return
 	}
 
 	var urls MyURLS
 	if err := json.Unmarshal(b, &urls); err != nil {
-		log.Print("while serve delete unmarshal url fail ", err.Error())
+		logger.FromContext(ctx).Warn("can not unmarshal delete request", "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := h.limits.CheckBatch(len(urls)); err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	d, ok := h.requestDomain(w, r)
+	if !ok {
+		return
+	}
 
 	var accepted bool
 	accepted = true
 
 	for _, url := range urls {
-		log.Println("deleting url=" + url)
 		if url == "" {
 			http.Error(w, "empty url", http.StatusBadRequest)
 			return
 		}
 		if v := ctx.Value(CTXKey{}); v != nil {
-			if !h.urlstorage.DelUserURL(fmt.Sprintf("%v", v), url) {
+			uid := fmt.Sprintf("%v", v)
+			// удаление выполняется в фоне и записывается в журнал аудита хранилищем
+			if !h.urlstorage.DelUserURLContext(ctx, d.Namespace, uid, url) {
 				accepted = false
-				log.Println("can not delete url=", url)
+				logger.FromContext(ctx).Warn("can not delete url", "domain", d.Host, "code", url)
 			}
 		} else {
-			if !h.urlstorage.DelURL(url) {
+			if !h.urlstorage.DelUserURLContext(ctx, d.Namespace, "1", url) {
 				accepted = false
-				log.Println("can not delete url=", url)
+				logger.FromContext(ctx).Warn("can not delete url", "code", url)
 			}
 		}
 	}
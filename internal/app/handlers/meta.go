@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+// MyMetaUpdate хранит изменение описания ссылки, отсутствующие поля не меняются.
+type MyMetaUpdate struct {
+	// Title - новый заголовок.
+	Title *string `json:"title"`
+	// Note - новая заметка.
+	Note *string `json:"note"`
+	// Tags - новый набор тегов.
+	Tags *[]string `json:"tags"`
+}
+
+// ServePatchURL обрабатывает PATCH запрос на изменение описания ссылки пользователя.
+// Домен ссылки задается параметром domain, иначе определяется по заголовку Host.
+// В ответ выдается ссылка с новым описанием.
+func (h *MyHandler) ServePatchURL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := chi.URLParam(r, "code")
+	b, err := h.limits.ReadBody(r)
+	if err != nil {
+		limits.WriteError(w, err)
+		return
+	}
+	var update MyMetaUpdate
+	if err := json.Unmarshal(b, &update); err != nil {
+		logger.FromContext(ctx).Warn("can not unmarshal meta update", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, ok := h.requestDomain(w, r)
+	if !ok {
+		return
+	}
+
+	uid := "1"
+	if v := ctx.Value(CTXKey{}); v != nil {
+		uid = fmt.Sprintf("%v", v)
+	}
+	// чужие ссылки не отличаются от несуществующих
+	before, found := h.findURL(d.Namespace, code)
+	if !found || before.Deleted || before.Owner != uid {
+		http.Error(w, "not found "+code, http.StatusNotFound)
+		return
+	}
+	meta := before.Meta
+	if update.Title != nil {
+		meta.Title = *update.Title
+	}
+	if update.Note != nil {
+		meta.Note = *update.Note
+	}
+	if update.Tags != nil {
+		meta.Tags = *update.Tags
+	}
+	if meta, err = storage.NormalizeMeta(meta); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.urlstorage.SetURLMetaContext(ctx, d.Namespace, code, meta) {
+		http.Error(w, "can not update link", http.StatusInternalServerError)
+		return
+	}
+	if h.audit != nil {
+		after := before
+		after.Meta = meta
+		h.audit.Record(ctx, audit.OpEdit, domains.Qualify(d.Namespace, code), audit.State(before), audit.State(after))
+	}
+	writeJSON(w, http.StatusOK, storage.MyURLS{ShortURL: d.ShortURL(code), OriginalURL: before.OriginalURL,
+		Clicks: h.urlstorage.Clicks(d.Namespace, code), Meta: meta})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+func TestServePatchURL(t *testing.T) {
+	hendl := MakeMyHandler("", storage.NewStorage("", ""))
+	hendl.SetBaseURL("http://localhost:8080")
+	r := chi.NewRouter()
+	r.Post("/api/shorten", hendl.ServeShortenPostHTTP)
+	r.Patch("/api/user/urls/{code}", hendl.ServePatchURL)
+	r.Get("/api/user/urls", hendl.ServeGetAllURLS)
+	do := func(uid string, method string, url string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), CTXKey{}, uid))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("u1", http.MethodPost, "/api/shorten", `{"url": "http://golang.org", "title": "Go", "tags": ["Lang"]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = do("u1", http.MethodPost, "/api/shorten", `{"url": "http://example.com", "tags": ["a,b"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("u1", http.MethodPatch, "/api/user/urls/1", `{"note": "docs", "tags": ["lang", "dev"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var link storage.MyURLS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, storage.Meta{Title: "Go", Note: "docs", Tags: []string{"dev", "lang"}}, link.Meta)
+
+	// чужую ссылку изменить нельзя
+	w = do("u2", http.MethodPatch, "/api/user/urls/1", `{"title": "x"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do("u1", http.MethodGet, "/api/user/urls?tag=DEV", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"short_url": "http://localhost:8080/1", "original_url": "http://golang.org", "clicks": 0,
+		"title": "Go", "note": "docs", "tags": ["dev", "lang"]}]`, w.Body.String())
+	w = do("u1", http.MethodGet, "/api/user/urls?tag=other", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
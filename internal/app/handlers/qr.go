@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"rsc.io/qr"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// qrScale - размер модуля QR кода в пикселях.
+const qrScale = 8
+
+// ServeGetQR обрабатывает GET запрос на получение QR кода краткой ссылки в формате PNG.
+// Домен ссылки задается параметром domain, иначе определяется по заголовку Host.
+func (h *MyHandler) ServeGetQR(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	d, ok := h.requestDomain(w, r)
+	if !ok {
+		return
+	}
+	if link, found := h.findURL(d.Namespace, code); !found || link.Deleted || link.Disabled {
+		http.Error(w, "not found "+code, http.StatusNotFound)
+		return
+	}
+	c, err := qr.Encode(d.ShortURL(code), qr.M)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can not encode qr code", "error", err)
+		http.Error(w, "can not encode qr code", http.StatusInternalServerError)
+		return
+	}
+	c.Scale = qrScale
+	w.Header().Set("Content-Type", "image/png")
+	// краткая ссылка не меняется, поэтому код можно кешировать
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	w.Write(c.PNG())
+}
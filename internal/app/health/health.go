@@ -0,0 +1,177 @@
+// Модуль health реализует проверки живости и готовности сервиса к приему запросов.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Результаты проверок.
+const (
+	// StatusOK - проверка пройдена.
+	StatusOK = "ok"
+	// StatusFail - проверка не пройдена.
+	StatusFail = "fail"
+)
+
+// DefaultTimeout - время, отводимое на одну проверку по умолчанию.
+const DefaultTimeout = 2 * time.Second
+
+// ErrShuttingDown возвращается проверкой готовности после начала остановки сервиса.
+var ErrShuttingDown = errors.New("shutting down")
+
+// CheckFunc проверяет зависимость и возвращает ошибку, если она недоступна.
+type CheckFunc func(ctx context.Context) error
+
+// Result представляет результат одной проверки.
+type Result struct {
+	// Name - имя проверки.
+	Name string `json:"name"`
+	// Status - результат: ok или fail.
+	Status string `json:"status"`
+	// Error - причина неудачи.
+	Error string `json:"error,omitempty"`
+	// DurationMS - длительность проверки в миллисекундах.
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report представляет результат всех проверок.
+type Report struct {
+	// Status - ok, если пройдены все проверки.
+	Status string `json:"status"`
+	// Checks - результаты проверок.
+	Checks []Result `json:"checks"`
+}
+
+// OK проверяет, пройдены ли все проверки.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker выполняет проверки готовности.
+type Checker struct {
+	// mux - мьютекс для синхронизации.
+	mux sync.RWMutex
+	// checks - проверки в порядке добавления.
+	checks []check
+	// timeout - время, отводимое на одну проверку.
+	timeout time.Duration
+	// shuttingDown - признак начала остановки сервиса.
+	shuttingDown int32
+}
+
+// NewChecker создает проверку готовности без зависимостей.
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Add добавляет проверку зависимости name.
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// SetShuttingDown переводит сервис в состояние остановки: проверка готовности больше не проходит.
+func (c *Checker) SetShuttingDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+// ShuttingDown проверяет, началась ли остановка сервиса.
+func (c *Checker) ShuttingDown() bool {
+	return atomic.LoadInt32(&c.shuttingDown) == 1
+}
+
+// Ready выполняет все проверки параллельно, каждую не дольше отведенного времени.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mux.RLock()
+	checks := append([]check{{name: "shutdown", fn: c.checkShutdown}}, c.checks...)
+	c.mux.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, res := range results {
+		if res.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) checkShutdown(context.Context) error {
+	if c.ShuttingDown() {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// run выполняет проверку с ограничением по времени. Проверка, не уложившаяся в срок,
+// считается неудачной, даже если функция проверки не учитывает контекст.
+func (c *Checker) run(ctx context.Context, ch check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- ch.fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res := Result{Name: ch.name, Status: StatusOK, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.OK() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// LiveHandler обрабатывает запрос проверки живости: процесс запущен и обслуживает запросы.
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, Report{Status: StatusOK, Checks: []Result{}})
+}
+
+// ReadyHandler возвращает обработчик запроса проверки готовности, отвечающий 503,
+// если не пройдена хотя бы одна проверка.
+func (c *Checker) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Ready(r.Context()))
+	}
+}
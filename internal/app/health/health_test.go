@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ready(t *testing.T, c *Checker) (int, Report) {
+	w := httptest.NewRecorder()
+	c.ReadyHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	return w.Code, report
+}
+
+func TestReady(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	var dbErr error
+	c.Add("db", func(context.Context) error { return dbErr })
+	c.Add("file", func(context.Context) error { return nil })
+
+	code, report := ready(t, c)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+	require.Len(t, report.Checks, 3)
+	assert.Equal(t, "shutdown", report.Checks[0].Name)
+	assert.Equal(t, "db", report.Checks[1].Name)
+
+	dbErr = errors.New("connection refused")
+	code, report = ready(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusFail, report.Checks[1].Status)
+	assert.Equal(t, "connection refused", report.Checks[1].Error)
+	assert.Equal(t, StatusOK, report.Checks[2].Status)
+}
+
+func TestReadyTimeout(t *testing.T) {
+	c := NewChecker(20 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	c.Add("db", func(context.Context) error { <-block; return nil })
+
+	code, report := ready(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks[1].Error)
+}
+
+func TestShuttingDown(t *testing.T) {
+	c := NewChecker(0)
+	c.SetShuttingDown()
+
+	code, report := ready(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, ErrShuttingDown.Error(), report.Checks[0].Error)
+
+	w := httptest.NewRecorder()
+	LiveHandler(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,91 @@
+package httpsmaker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DefaultACMEDirectory - адрес каталога ACME по умолчанию (Let's Encrypt).
+const DefaultACMEDirectory = autocert.DefaultACMEDirectory
+
+// ACMEOptions хранит параметры автоматического получения сертификатов по протоколу ACME.
+type ACMEOptions struct {
+	// Enabled - признак режима ACME.
+	Enabled bool
+	// DirectoryURL - адрес каталога ACME, например тестового сервера Pebble.
+	DirectoryURL string
+	// CAFile - сертификаты в формате PEM, которым доверять при обращении к серверу ACME.
+	// Нужен для тестовых серверов с собственным корневым сертификатом.
+	CAFile string
+	// CacheDir - каталог для хранения ключа учетной записи и полученных сертификатов.
+	CacheDir string
+	// Email - контактный адрес учетной записи ACME.
+	Email string
+	// Hosts - имена, для которых разрешено получать сертификаты.
+	Hosts []string
+}
+
+// Validate проверяет параметры ACME.
+func (o ACMEOptions) Validate() error {
+	if len(o.Hosts) == 0 {
+		return errors.New("acme requires at least one host")
+	}
+	if o.CacheDir == "" {
+		return errors.New("acme requires a cache directory")
+	}
+	if o.DirectoryURL != "" {
+		u, err := url.Parse(o.DirectoryURL)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("acme directory must be an absolute https url, got %q", o.DirectoryURL)
+		}
+	}
+	return nil
+}
+
+// NewACMEManager создает менеджер, который получает сертификаты для разрешенных имен
+// при первом обращении и продлевает их до истечения срока. Поддерживаются проверки
+// TLS-ALPN-01 (через GetCertificate) и HTTP-01 (через HTTPHandler).
+func NewACMEManager(o ACMEOptions) (*autocert.Manager, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	directory := o.DirectoryURL
+	if directory == "" {
+		directory = DefaultACMEDirectory
+	}
+	client := &acme.Client{DirectoryURL: directory}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", o.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(o.CacheDir),
+		HostPolicy: autocert.HostWhitelist(o.Hosts...),
+		Email:      o.Email,
+		Client:     client,
+	}, nil
+}
+
+// acmeNextProtos - протоколы ALPN сервера в режиме ACME, включая протокол проверки TLS-ALPN-01.
+var acmeNextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
@@ -1,112 +1,149 @@
-// Модуль httpsmaker представляет класс для создания HTTPS.
+// Модуль httpsmaker настраивает HTTPS: загружает сертификат и ключ из файлов с автоматической
+// перезагрузкой при их обновлении или получает сертификаты по протоколу ACME,
+// задает минимальную версию TLS и набор шифров.
+// Для разработки может создавать самоподписанный сертификат.
 package httpsmaker
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
-	"log"
-	"math/big"
-	"net"
-	"os"
-	"time"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jon69/shorturl/internal/app/logger"
 )
 
-// MakeHTTPS создаем сертификат и секретный ключ
-func MakeHTTPS() (string, string, error) {
-	// создаём шаблон сертификата
-	cert := &x509.Certificate{
-		// указываем уникальный номер сертификата
-		SerialNumber: big.NewInt(1658),
-		// заполняем базовую информацию о владельце сертификата
-		Subject: pkix.Name{
-			Organization: []string{"evgeniy.corporation"},
-			Country:      []string{"RU"},
-		},
-		// разрешаем использование сертификата для 127.0.0.1 и ::1
-		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		// сертификат верен, начиная со времени создания
-		NotBefore: time.Now(),
-		// время жизни сертификата — 10 лет
-		NotAfter:     time.Now().AddDate(10, 0, 0),
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		// устанавливаем использование ключа для цифровой подписи,
-		// а также клиентской и серверной авторизации
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature,
-	}
+// Options хранит параметры TLS.
+type Options struct {
+	// CertFile - путь к файлу сертификата в формате PEM, может содержать цепочку.
+	CertFile string
+	// KeyFile - путь к файлу секретного ключа в формате PEM.
+	KeyFile string
+	// MinVersion - минимальная версия TLS: 1.2 или 1.3.
+	MinVersion string
+	// CipherSuites - разрешенные шифры для TLS 1.2, по умолчанию выбирает стандартная библиотека.
+	CipherSuites []string
+	// SelfSigned - режим разработки: создать самоподписанный сертификат вместо загрузки из файлов.
+	SelfSigned bool
+	// SelfSignedHosts - имена и адреса, для которых создается самоподписанный сертификат.
+	SelfSignedHosts []string
+	// ACME - параметры автоматического получения сертификатов.
+	ACME ACMEOptions
+}
 
-	// создаём новый приватный RSA-ключ длиной 4096 бит
-	// обратите внимание, что для генерации ключа и сертификата
-	// используется rand.Reader в качестве источника случайных данных
-	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
-	if err != nil {
-		log.Println("can not GenerateKey " + err.Error())
-		return "", "", err
-	}
+// DefaultSelfSignedHosts - имена и адреса самоподписанного сертификата по умолчанию.
+var DefaultSelfSignedHosts = []string{"localhost", "127.0.0.1", "::1"}
 
-	// создаём сертификат x.509
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, &privateKey.PublicKey, privateKey)
-	if err != nil {
-		log.Println("can not CreateCertificate " + err.Error())
-		return "", "", err
+// ParseMinVersion разбирает минимальную версию TLS. Пустая строка означает TLS 1.2.
+func ParseMinVersion(str string) (uint16, error) {
+	switch strings.TrimSpace(str) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
 	}
+	return 0, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", str)
+}
 
-	// кодируем сертификат и ключ в формате PEM, который
-	// используется для хранения и обмена криптографическими ключами
-	var certPEM bytes.Buffer
-	err = pem.Encode(&certPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: certBytes,
-	})
-
-	if err != nil {
-		log.Println("can not pem.Encode certPEM " + err.Error())
-		return "", "", err
+// ParseCipherSuites разбирает имена шифров, например TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+// Небезопасные шифры не допускаются.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
 	}
-
-	var privateKeyPEM bytes.Buffer
-	err = pem.Encode(&privateKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	})
-
-	if err != nil {
-		log.Println("can not pem.Encode privateKeyPEM " + err.Error())
-		return "", "", err
+	known := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
 	}
+	insecure := make(map[string]bool)
+	for _, cs := range tls.InsecureCipherSuites() {
+		insecure[cs.Name] = true
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if insecure[name] {
+			return nil, fmt.Errorf("insecure cipher suite %q", name)
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
 
-	myCertFile := "./mycert.pem"
-	myKeyFile := "./mykey.pem"
+// Validate проверяет, что задан ровно один источник сертификата и параметры TLS верны.
+func (o Options) Validate() error {
+	files := o.CertFile != "" || o.KeyFile != ""
+	sources := 0
+	for _, on := range []bool{files, o.SelfSigned, o.ACME.Enabled} {
+		if on {
+			sources++
+		}
+	}
+	switch {
+	case sources > 1:
+		return errors.New("certificate files, acme and self-signed mode are mutually exclusive")
+	case o.ACME.Enabled:
+		if err := o.ACME.Validate(); err != nil {
+			return err
+		}
+	case !o.SelfSigned && (o.CertFile == "" || o.KeyFile == ""):
+		return errors.New("certificate and key files are required, or acme, or self-signed mode for development")
+	}
+	if _, err := ParseMinVersion(o.MinVersion); err != nil {
+		return err
+	}
+	_, err := ParseCipherSuites(o.CipherSuites)
+	return err
+}
 
-	fileCERT, err := os.Create(myCertFile)
-	if err != nil {
-		log.Printf("can not Create file %s | %s", myCertFile, err.Error())
-		return "", "", err
+// NewTLSConfig создает настройки TLS сервера. Сертификат из файлов перезагружается
+// при их изменении, без перезапуска сервера. В режиме ACME также возвращается обработчик
+// проверок HTTP-01 для порта 80, в остальных режимах он равен nil.
+func NewTLSConfig(o Options) (*tls.Config, http.Handler, error) {
+	if err := o.Validate(); err != nil {
+		return nil, nil, err
+	}
+	minVersion, _ := ParseMinVersion(o.MinVersion)
+	ciphers, _ := ParseCipherSuites(o.CipherSuites)
+	cfg := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: ciphers,
 	}
-	defer fileCERT.Close()
 
-	_, err = certPEM.WriteTo(fileCERT)
-	if err != nil {
-		log.Printf("can not WriteTo file %s | %s", myCertFile, err.Error())
-		return "", "", err
+	if o.SelfSigned {
+		hosts := o.SelfSignedHosts
+		if len(hosts) == 0 {
+			hosts = DefaultSelfSignedHosts
+		}
+		cert, err := SelfSigned(hosts)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Warn("using self-signed certificate, for development only", "hosts", strings.Join(hosts, ","))
+		cfg.Certificates = []tls.Certificate{cert}
+		return cfg, nil, nil
 	}
 
-	fileKey, err := os.Create(myKeyFile)
-	if err != nil {
-		log.Printf("can not Create file %s | %s", myKeyFile, err.Error())
-		return "", "", err
+	if o.ACME.Enabled {
+		m, err := NewACMEManager(o.ACME)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Info("using ACME certificates", "directory", m.Client.DirectoryURL, "hosts", strings.Join(o.ACME.Hosts, ","))
+		cfg.GetCertificate = m.GetCertificate
+		cfg.NextProtos = acmeNextProtos
+		return cfg, m.HTTPHandler(nil), nil
 	}
-	defer fileKey.Close()
 
-	_, err = privateKeyPEM.WriteTo(fileKey)
+	reloader, err := NewCertReloader(o.CertFile, o.KeyFile)
 	if err != nil {
-		log.Printf("can not WriteTo file %s | %s", myKeyFile, err.Error())
-		return "", "", err
+		return nil, nil, err
 	}
-
-	return myCertFile, myKeyFile, nil
+	cfg.GetCertificate = reloader.GetCertificate
+	return cfg, nil, nil
 }
@@ -0,0 +1,115 @@
+package httpsmaker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair записывает самоподписанный сертификат для host в файлы PEM.
+func writeKeyPair(t *testing.T, dir string, host string) (string, string) {
+	cert, err := SelfSigned([]string{host})
+	require.NoError(t, err)
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600))
+	return certFile, keyFile
+}
+
+func leafNames(t *testing.T, cert *tls.Certificate) []string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.DNSNames
+}
+
+func TestSelfSigned(t *testing.T) {
+	cert, err := SelfSigned([]string{"short.local", "127.0.0.1"})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, x509.ECDSA, leaf.PublicKeyAlgorithm)
+	assert.Equal(t, []string{"short.local"}, leaf.DNSNames)
+	require.Len(t, leaf.IPAddresses, 1)
+	assert.Equal(t, "127.0.0.1", leaf.IPAddresses[0].String())
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "old.local")
+	r, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old.local"}, leafNames(t, cert))
+
+	// обновленные файлы подхватываются после интервала проверки
+	writeKeyPair(t, dir, "new.local")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	r.mux.Lock()
+	r.checked = time.Time{}
+	r.mux.Unlock()
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new.local"}, leafNames(t, cert))
+
+	// испорченный файл не заменяет действующий сертификат
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	r.mux.Lock()
+	r.checked = time.Time{}
+	r.mux.Unlock()
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new.local"}, leafNames(t, cert))
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	_, _, err := NewTLSConfig(Options{})
+	assert.Error(t, err)
+
+	cfg, _, err := NewTLSConfig(Options{SelfSigned: true, MinVersion: "1.3"})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+	require.Len(t, cfg.Certificates, 1)
+
+	_, _, err = NewTLSConfig(Options{SelfSigned: true, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}})
+	assert.Error(t, err)
+	cfg, _, err = NewTLSConfig(Options{SelfSigned: true, CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, cfg.CipherSuites)
+}
+
+func TestACME(t *testing.T) {
+	_, _, err := NewTLSConfig(Options{SelfSigned: true, ACME: ACMEOptions{Enabled: true}})
+	assert.Error(t, err)
+	_, _, err = NewTLSConfig(Options{ACME: ACMEOptions{Enabled: true, CacheDir: t.TempDir()}})
+	assert.Error(t, err)
+	_, _, err = NewTLSConfig(Options{ACME: ACMEOptions{Enabled: true, CacheDir: t.TempDir(), Hosts: []string{"short.example"},
+		DirectoryURL: "http://pebble:14000/dir"}})
+	assert.Error(t, err)
+
+	cfg, challenge, err := NewTLSConfig(Options{ACME: ACMEOptions{Enabled: true, CacheDir: t.TempDir(),
+		Hosts: []string{"short.example"}, DirectoryURL: "https://localhost:14000/dir"}})
+	require.NoError(t, err)
+	assert.NotNil(t, challenge)
+	assert.NotNil(t, cfg.GetCertificate)
+	assert.Contains(t, cfg.NextProtos, "acme-tls/1")
+
+	// сертификат для имени вне списка не запрашивается
+	_, err = cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package httpsmaker
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// reloadCheckInterval - как часто проверяется, изменились ли файлы сертификата и ключа.
+const reloadCheckInterval = 10 * time.Second
+
+// CertReloader отдает сертификат из файлов и перечитывает его, когда файлы обновляются,
+// например после продления сертификата.
+type CertReloader struct {
+	// certFile - путь к файлу сертификата.
+	certFile string
+	// keyFile - путь к файлу ключа.
+	keyFile string
+
+	// mux - мьютекс для синхронизации.
+	mux sync.RWMutex
+	// cert - действующий сертификат.
+	cert *tls.Certificate
+	// modTime - время изменения файлов, из которых загружен сертификат.
+	modTime time.Time
+	// checked - время последней проверки файлов.
+	checked time.Time
+}
+
+// NewCertReloader загружает сертификат из файлов certFile и keyFile.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// filesModTime возвращает наибольшее время изменения файлов сертификата и ключа.
+func (r *CertReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Reload перечитывает сертификат из файлов. При ошибке продолжает действовать прежний сертификат.
+func (r *CertReloader) Reload() error {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.checked = time.Now()
+	logger.Info("loaded TLS certificate", "cert", r.certFile, "key", r.keyFile)
+	return nil
+}
+
+// maybeReload перечитывает сертификат, если файлы изменились с момента загрузки.
+// Файлы проверяются не чаще reloadCheckInterval.
+func (r *CertReloader) maybeReload() {
+	r.mux.Lock()
+	if time.Since(r.checked) < reloadCheckInterval {
+		r.mux.Unlock()
+		return
+	}
+	r.checked = time.Now()
+	loaded := r.modTime
+	r.mux.Unlock()
+
+	modTime, err := r.filesModTime()
+	if err != nil {
+		logger.Error("can not check TLS certificate files, keeping current certificate", "error", err)
+		return
+	}
+	if !modTime.After(loaded) {
+		return
+	}
+	if err := r.Reload(); err != nil {
+		logger.Error("can not reload TLS certificate, keeping current certificate", "error", err)
+	}
+}
+
+// GetCertificate возвращает действующий сертификат, предварительно проверив обновление файлов.
+// Предназначен для tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.cert, nil
+}
@@ -0,0 +1,236 @@
+// Модуль ipacl ограничивает доступ к внутренним обработчикам списком доверенных подсетей.
+// Адрес клиента определяется по адресу соединения, а заголовки X-Forwarded-For и X-Real-IP
+// учитываются только для запросов от доверенных прокси.
+package ipacl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// Заголовки HTTP и ключи метаданных gRPC с адресом клиента, выставляемые прокси.
+const (
+	// HeaderForwardedFor - цепочка адресов, через которые прошел запрос.
+	HeaderForwardedFor = "X-Forwarded-For"
+	// HeaderRealIP - адрес клиента.
+	HeaderRealIP = "X-Real-IP"
+	// MetadataForwardedFor - ключ метаданных gRPC с цепочкой адресов.
+	MetadataForwardedFor = "x-forwarded-for"
+	// MetadataRealIP - ключ метаданных gRPC с адресом клиента.
+	MetadataRealIP = "x-real-ip"
+)
+
+// Policy хранит доверенные подсети и доверенные прокси. Списки можно заменить
+// без перезапуска методом Update, изменения видны во всех производных политиках.
+type Policy struct {
+	// mux - мьютекс для синхронизации.
+	mux sync.RWMutex
+	// subnets - подсети, из которых разрешен доступ.
+	subnets []*net.IPNet
+	// proxies - подсети прокси, которым разрешено передавать адрес клиента.
+	proxies []*net.IPNet
+	// base - политика, от которой получена эта; списки берутся из нее.
+	base *Policy
+	// extra - дополнительные доверенные прокси производной политики.
+	extra []*net.IPNet
+}
+
+// ParseCIDRs разбирает список подсетей IPv4 и IPv6 через запятую.
+// Одиночный адрес означает подсеть из одного адреса.
+func ParseCIDRs(str string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// New создает политику из списков доверенных подсетей и доверенных прокси через запятую.
+func New(subnets string, proxies string) (*Policy, error) {
+	p := &Policy{}
+	var err error
+	if p.subnets, err = ParseCIDRs(subnets); err != nil {
+		return nil, err
+	}
+	if p.proxies, err = ParseCIDRs(proxies); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// WithProxies возвращает политику с дополнительными доверенными прокси, которая следует
+// за изменениями исходной политики.
+func (p *Policy) WithProxies(proxies ...*net.IPNet) *Policy {
+	return &Policy{base: p, extra: proxies}
+}
+
+// Update атомарно заменяет списки доверенных подсетей и прокси списками из q.
+func (p *Policy) Update(q *Policy) {
+	subnets, proxies := q.lists()
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.subnets, p.proxies = subnets, proxies
+}
+
+// lists возвращает действующие списки доверенных подсетей и прокси.
+func (p *Policy) lists() ([]*net.IPNet, []*net.IPNet) {
+	if p == nil {
+		return nil, nil
+	}
+	if p.base != nil {
+		return p.base.lists()
+	}
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	return p.subnets, p.proxies
+}
+
+// Enabled проверяет, задана ли хотя бы одна доверенная подсеть.
+func (p *Policy) Enabled() bool {
+	subnets, _ := p.lists()
+	return len(subnets) > 0
+}
+
+// String возвращает политику в текстовом виде.
+func (p *Policy) String() string {
+	subnets, proxies := p.lists()
+	if p != nil {
+		proxies = append(append([]*net.IPNet{}, proxies...), p.extra...)
+	}
+	return fmt.Sprintf("subnets=%v proxies=%v", subnets, proxies)
+}
+
+// Contains проверяет, принадлежит ли адрес доверенной подсети.
+func (p *Policy) Contains(ip net.IP) bool {
+	subnets, _ := p.lists()
+	return ip != nil && contains(subnets, ip)
+}
+
+func (p *Policy) isProxy(ip net.IP) bool {
+	if p == nil || ip == nil {
+		return false
+	}
+	_, proxies := p.lists()
+	return contains(proxies, ip) || contains(p.extra, ip)
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve определяет адрес клиента по адресу соединения remote и переданным прокси значениям.
+// Цепочка X-Forwarded-For просматривается справа налево до первого адреса, не являющегося доверенным прокси.
+func (p *Policy) resolve(remote net.IP, forwardedFor []string, realIP string) net.IP {
+	if !p.isProxy(remote) {
+		return remote
+	}
+	var chain []string
+	for _, v := range forwardedFor {
+		chain = append(chain, strings.Split(v, ",")...)
+	}
+	var client net.IP
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(chain[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !p.isProxy(ip) {
+			return ip
+		}
+	}
+	if client != nil {
+		return client
+	}
+	if ip := net.ParseIP(strings.TrimSpace(realIP)); ip != nil {
+		return ip
+	}
+	return remote
+}
+
+// ClientIP возвращает адрес клиента HTTP запроса.
+func (p *Policy) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return p.resolve(net.ParseIP(host), r.Header.Values(HeaderForwardedFor), r.Header.Get(HeaderRealIP))
+}
+
+// PeerIP возвращает адрес клиента gRPC запроса.
+func (p *Policy) PeerIP(ctx context.Context) net.IP {
+	pr, ok := peer.FromContext(ctx)
+	if !ok || pr.Addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(pr.Addr.String())
+	if err != nil {
+		host = pr.Addr.String()
+	}
+	var forwardedFor []string
+	var realIP string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		forwardedFor = md.Get(MetadataForwardedFor)
+		if values := md.Get(MetadataRealIP); len(values) > 0 {
+			realIP = values[0]
+		}
+	}
+	return p.resolve(net.ParseIP(host), forwardedFor, realIP)
+}
+
+// AllowRequest проверяет, что HTTP запрос пришел из доверенной подсети.
+func (p *Policy) AllowRequest(r *http.Request) bool {
+	return p.Contains(p.ClientIP(r))
+}
+
+// AllowPeer проверяет, что gRPC запрос пришел из доверенной подсети.
+func (p *Policy) AllowPeer(ctx context.Context) bool {
+	return p.Contains(p.PeerIP(ctx))
+}
+
+// Handle пропускает к обработчику только запросы из доверенных подсетей, остальным отвечает 403.
+func (p *Policy) Handle(nextFunc http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := p.ClientIP(r); !p.Contains(ip) {
+			logger.FromContext(r.Context()).Warn("access denied, untrusted address", "ip", ip, "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		nextFunc(w, r)
+	})
+}
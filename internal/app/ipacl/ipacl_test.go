@@ -0,0 +1,68 @@
+package ipacl
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	p, err := New("192.168.0.0/16, 2001:db8::/32", "10.0.0.1,10.0.1.0/24")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     string
+		realIP  string
+		want    string
+		allowed bool
+	}{
+		{name: "direct", remote: "192.168.1.5:1234", want: "192.168.1.5", allowed: true},
+		{name: "spoofed header ignored", remote: "8.8.8.8:1234", realIP: "192.168.1.5", want: "8.8.8.8"},
+		{name: "real ip from proxy", remote: "10.0.0.1:1234", realIP: "192.168.1.5", want: "192.168.1.5", allowed: true},
+		{name: "forwarded chain", remote: "10.0.0.1:1234", xff: "192.168.1.5, 8.8.8.8, 10.0.1.7", want: "8.8.8.8"},
+		{name: "ipv6", remote: "[2001:db8::1]:1234", want: "2001:db8::1", allowed: true},
+		{name: "proxy without headers", remote: "10.0.0.1:1234", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set(HeaderForwardedFor, tt.xff)
+			}
+			if tt.realIP != "" {
+				r.Header.Set(HeaderRealIP, tt.realIP)
+			}
+			assert.True(t, net.ParseIP(tt.want).Equal(p.ClientIP(r)))
+			assert.Equal(t, tt.allowed, p.AllowRequest(r))
+		})
+	}
+}
+
+func TestParseCIDRsInvalid(t *testing.T) {
+	_, err := ParseCIDRs("10.0.0.0/8,not-an-ip")
+	assert.Error(t, err)
+}
+
+func TestUpdate(t *testing.T) {
+	p, err := New("", "")
+	require.NoError(t, err)
+	derived := p.WithProxies(&net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)})
+	assert.False(t, derived.Enabled())
+
+	q, err := New("192.168.0.0/16", "10.0.0.1")
+	require.NoError(t, err)
+	p.Update(q)
+
+	assert.True(t, p.Enabled())
+	assert.True(t, derived.Contains(net.ParseIP("192.168.1.5")))
+	assert.True(t, derived.isProxy(net.ParseIP("10.0.0.1")))
+	assert.True(t, derived.isProxy(net.ParseIP("127.0.0.1")))
+	assert.False(t, p.isProxy(net.ParseIP("127.0.0.1")))
+}
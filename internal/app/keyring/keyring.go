@@ -0,0 +1,242 @@
+// Модуль keyring хранит набор секретных ключей подписи с поддержкой ротации.
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/token"
+)
+
+// KeySize - размер генерируемого ключа в байтах.
+const KeySize = 32
+
+// ErrEmpty - набор не содержит ни одного ключа.
+var ErrEmpty = errors.New("keyring: no keys")
+
+// KeyRing набор ключей: активный ключ используется для подписи,
+// все ключи набора (включая предыдущие) - для проверки.
+type KeyRing struct {
+	// mux - мьютекс для синхронизации.
+	mux *sync.RWMutex
+	// active - идентификатор активного ключа.
+	active string
+	// keys - ключи по идентификаторам в порядке добавления.
+	keys []Key
+}
+
+// Key хранит информацию о ключе.
+type Key struct {
+	// ID - идентификатор ключа.
+	ID string `json:"id"`
+	// Secret - ключ в шестнадцатеричном виде.
+	Secret string `json:"secret"`
+	// Created - время создания ключа.
+	Created time.Time `json:"created"`
+}
+
+// ringFile формат файла с набором ключей.
+type ringFile struct {
+	// Active - идентификатор активного ключа.
+	Active string `json:"active"`
+	// Keys - все ключи набора.
+	Keys []Key `json:"keys"`
+}
+
+// NewKeyRing создает набор из одного ключа.
+func NewKeyRing(secret []byte) *KeyRing {
+	k := &KeyRing{mux: &sync.RWMutex{}}
+	id := token.KeyID(secret)
+	k.keys = []Key{{ID: id, Secret: hex.EncodeToString(secret), Created: time.Now().UTC()}}
+	k.active = id
+	return k
+}
+
+// Generate создает набор из одного случайного ключа.
+func Generate() (*KeyRing, error) {
+	secret, err := generateRandom(KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyRing(secret), nil
+}
+
+// Parse создает набор ключей из строки вида "id1:hex1,id2:hex2"
+// или из одного ключа в шестнадцатеричном виде. Активным становится первый ключ.
+func Parse(spec string) (*KeyRing, error) {
+	k := &KeyRing{mux: &sync.RWMutex{}}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, secretHEX := "", item
+		if i := strings.Index(item, ":"); i != -1 {
+			id, secretHEX = item[:i], item[i+1:]
+		}
+		secret, err := hex.DecodeString(secretHEX)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("keyring: key %q is not a hex string", id)
+		}
+		if id == "" {
+			id = token.KeyID(secret)
+		}
+		k.keys = append(k.keys, Key{ID: id, Secret: secretHEX})
+	}
+	if len(k.keys) == 0 {
+		return nil, ErrEmpty
+	}
+	k.active = k.keys[0].ID
+	return k, nil
+}
+
+// Load читает набор ключей из файла.
+func Load(path string) (*KeyRing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("can not read keyring file", "path", path, "error", err)
+		return nil, err
+	}
+	var rf ringFile
+	if err := json.Unmarshal(data, &rf); err != nil {
+		logger.Error("can not unmarshal keyring", "error", err)
+		return nil, err
+	}
+	k := &KeyRing{mux: &sync.RWMutex{}, active: rf.Active, keys: rf.Keys}
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Save сохраняет набор ключей в файл, доступный только владельцу.
+func (k *KeyRing) Save(path string) error {
+	k.mux.RLock()
+	rf := ringFile{Active: k.active, Keys: k.keys}
+	data, err := json.MarshalIndent(rf, "", "  ")
+	k.mux.RUnlock()
+	if err != nil {
+		return err
+	}
+	// пишем во временный файл и переименовываем, чтобы не оставить файл частично записанным
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Rotate добавляет новый случайный ключ и делает его активным.
+// Предыдущие ключи остаются в наборе, поэтому выданные ранее токены продолжают действовать.
+func (k *KeyRing) Rotate() (string, error) {
+	secret, err := generateRandom(KeySize)
+	if err != nil {
+		return "", err
+	}
+	id := token.KeyID(secret)
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.keys = append(k.keys, Key{ID: id, Secret: hex.EncodeToString(secret), Created: time.Now().UTC()})
+	k.active = id
+	return id, nil
+}
+
+// Prune удаляет старые неактивные ключи, оставляя не более keep ключей.
+func (k *KeyRing) Prune(keep int) []string {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	var removed []string
+	for len(k.keys) > keep && len(k.keys) > 1 {
+		i := 0
+		if k.keys[0].ID == k.active {
+			i = 1
+		}
+		removed = append(removed, k.keys[i].ID)
+		k.keys = append(k.keys[:i], k.keys[i+1:]...)
+	}
+	return removed
+}
+
+// Replace атомарно заменяет содержимое набора содержимым другого набора.
+func (k *KeyRing) Replace(other *KeyRing) {
+	other.mux.RLock()
+	active, keys := other.active, append([]Key(nil), other.keys...)
+	other.mux.RUnlock()
+	k.mux.Lock()
+	k.active, k.keys = active, keys
+	k.mux.Unlock()
+}
+
+// Active возвращает идентификатор и значение активного ключа.
+func (k *KeyRing) Active() (string, []byte) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	secret, _ := k.lookup(k.active)
+	return k.active, secret
+}
+
+// Key возвращает значение ключа по его идентификатору.
+func (k *KeyRing) Key(id string) ([]byte, bool) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	return k.lookup(id)
+}
+
+// IDs возвращает идентификаторы всех ключей набора.
+func (k *KeyRing) IDs() []string {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	ids := make([]string, 0, len(k.keys))
+	for _, key := range k.keys {
+		ids = append(ids, key.ID)
+	}
+	return ids
+}
+
+func (k *KeyRing) lookup(id string) ([]byte, bool) {
+	for _, key := range k.keys {
+		if key.ID == id {
+			secret, err := hex.DecodeString(key.Secret)
+			return secret, err == nil
+		}
+	}
+	return nil, false
+}
+
+func (k *KeyRing) validate() error {
+	if len(k.keys) == 0 {
+		return ErrEmpty
+	}
+	seen := make(map[string]bool)
+	for _, key := range k.keys {
+		if key.ID == "" || seen[key.ID] {
+			return fmt.Errorf("keyring: empty or duplicate key id %q", key.ID)
+		}
+		seen[key.ID] = true
+		if secret, err := hex.DecodeString(key.Secret); err != nil || len(secret) == 0 {
+			return fmt.Errorf("keyring: key %q is not a hex string", key.ID)
+		}
+	}
+	if !seen[k.active] {
+		return fmt.Errorf("keyring: active key %q not found", k.active)
+	}
+	return nil
+}
+
+func generateRandom(size int) ([]byte, error) {
+	// генерируем случайную последовательность байт
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
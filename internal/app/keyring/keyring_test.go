@@ -0,0 +1,107 @@
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/token"
+)
+
+func TestRotate(t *testing.T) {
+	k, err := Generate()
+	require.NoError(t, err)
+	oldID, oldKey := k.Active()
+	oldTok := token.Issue(oldKey, oldID, "user-1", time.Hour)
+
+	newID, err := k.Rotate()
+	require.NoError(t, err)
+	require.NotEqual(t, oldID, newID)
+
+	// подписывает самый новый ключ
+	id, key := k.Active()
+	assert.Equal(t, newID, id)
+	c, err := token.Parse(token.Issue(key, id, "user-2", time.Hour), k.Key)
+	require.NoError(t, err)
+	assert.Equal(t, newID, c.KeyID)
+
+	// токен, подписанный предыдущим ключом, остается действительным
+	c, err = token.Parse(oldTok, k.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", c.UID)
+	assert.Equal(t, oldID, c.KeyID)
+
+	// токен с неизвестным идентификатором ключа отклоняется
+	_, err = token.Parse(token.Issue([]byte("other"), "other", "user-1", time.Hour), k.Key)
+	assert.ErrorIs(t, err, token.ErrUnknownKey)
+}
+
+func TestPrune(t *testing.T) {
+	k := NewKeyRing([]byte("first"))
+	first, _ := k.Active()
+	second, err := k.Rotate()
+	require.NoError(t, err)
+	third, err := k.Rotate()
+	require.NoError(t, err)
+
+	assert.Empty(t, k.Prune(3))
+	assert.Equal(t, []string{first}, k.Prune(2))
+	assert.Equal(t, []string{second, third}, k.IDs())
+
+	// активный ключ не удаляется, даже если он самый старый
+	k.Replace(mustParse(t, "a:01,b:02,c:03"))
+	assert.Equal(t, []string{"b", "c"}, k.Prune(0))
+	assert.Equal(t, []string{"a"}, k.IDs())
+
+	_, err = token.Parse(token.Issue([]byte{2}, "b", "user-1", time.Hour), k.Key)
+	assert.ErrorIs(t, err, token.ErrUnknownKey)
+}
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	k := mustParse(t, "a:01,b:02")
+	require.NoError(t, k.Save(path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, loaded.IDs())
+	id, key := loaded.Active()
+	assert.Equal(t, "a", id)
+	assert.Equal(t, []byte{1}, key)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: `{"active":"","keys":[]}`},
+		{name: "unknown active", data: `{"active":"x","keys":[{"id":"a","secret":"01"}]}`},
+		{name: "duplicate id", data: `{"active":"a","keys":[{"id":"a","secret":"01"},{"id":"a","secret":"02"}]}`},
+		{name: "not hex", data: `{"active":"a","keys":[{"id":"a","secret":"zz"}]}`},
+		{name: "not json", data: `keys`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0600))
+			_, err := Load(path)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func mustParse(t *testing.T, spec string) *KeyRing {
+	t.Helper()
+	k, err := Parse(spec)
+	require.NoError(t, err)
+	return k
+}
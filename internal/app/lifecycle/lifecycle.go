@@ -0,0 +1,116 @@
+// Модуль lifecycle координирует остановку сервиса: по очереди выполняет зарегистрированные
+// действия остановки в пределах общего срока и определяет код завершения процесса.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// Коды завершения процесса.
+const (
+	// ExitOK - штатная остановка.
+	ExitOK = 0
+	// ExitFailure - сервер аварийно завершил работу.
+	ExitFailure = 1
+	// ExitConfig - неверная конфигурация или ошибка при запуске.
+	ExitConfig = 2
+	// ExitShutdown - остановка не уложилась в срок или завершилась с ошибками.
+	ExitShutdown = 3
+)
+
+// DefaultTimeout - срок остановки по умолчанию.
+const DefaultTimeout = 30 * time.Second
+
+// StopFunc выполняет одно действие остановки, не дольше срока действия ctx.
+type StopFunc func(ctx context.Context) error
+
+type hook struct {
+	name string
+	fn   StopFunc
+}
+
+// Manager хранит действия остановки сервиса.
+type Manager struct {
+	// mux - мьютекс для синхронизации.
+	mux sync.Mutex
+	// hooks - действия остановки в порядке регистрации.
+	hooks []hook
+	// timeout - общий срок остановки.
+	timeout time.Duration
+}
+
+// New создает менеджер остановки со сроком timeout.
+func New(timeout time.Duration) *Manager {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Manager{timeout: timeout}
+}
+
+// OnStop регистрирует действие остановки name. Действия выполняются в порядке регистрации:
+// сначала нужно регистрировать прием запросов, затем то, от чего зависит их обработка.
+func (m *Manager) OnStop(name string, fn StopFunc) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Shutdown выполняет все действия остановки. После истечения срока оставшиеся действия
+// все равно вызываются с истекшим контекстом, чтобы освободить ресурсы без ожидания.
+// Возвращает объединенную ошибку всех неудавшихся действий.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mux.Lock()
+	hooks := m.hooks
+	m.hooks = nil
+	m.mux.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	logger.Info("shutting down", "timeout", m.timeout)
+
+	var errs []error
+	for _, h := range hooks {
+		start := time.Now()
+		err := h.fn(ctx)
+		if err != nil {
+			logger.Error("shutdown step failed", "step", h.name, "error", err, "duration", time.Since(start))
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		logger.Info("shutdown step done", "step", h.name, "duration", time.Since(start))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return stepErrors(errs)
+}
+
+// stepErrors объединяет ошибки действий остановки.
+type stepErrors []error
+
+// Error перечисляет ошибки через точку с запятой.
+func (e stepErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ExitCode возвращает код завершения процесса по ошибке работы сервера serveErr
+// и ошибке остановки shutdownErr.
+func ExitCode(serveErr error, shutdownErr error) int {
+	switch {
+	case shutdownErr != nil:
+		return ExitShutdown
+	case serveErr != nil:
+		return ExitFailure
+	}
+	return ExitOK
+}
@@ -0,0 +1,46 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	m := New(time.Second)
+	var order []string
+	for _, name := range []string{"http", "grpc", "storage"} {
+		name := name
+		m.OnStop(name, func(context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+	require.NoError(t, m.Shutdown(context.Background()))
+	assert.Equal(t, []string{"http", "grpc", "storage"}, order)
+	assert.Equal(t, ExitOK, ExitCode(nil, nil))
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	m := New(20 * time.Millisecond)
+	m.OnStop("http", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	closed := false
+	m.OnStop("storage", func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+
+	err := m.Shutdown(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "http: context deadline exceeded")
+	assert.True(t, closed, "later steps must run after the deadline")
+	assert.Equal(t, ExitShutdown, ExitCode(nil, err))
+	assert.Equal(t, ExitFailure, ExitCode(errors.New("listen"), nil))
+}
@@ -0,0 +1,127 @@
+// Модуль limits задает ограничения на размер запросов, чтобы большой запрос
+// или gzip-бомба не могли исчерпать память сервера.
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ErrTooLarge - запрос превышает ограничение.
+var ErrTooLarge = errors.New("request too large")
+
+// Limits хранит ограничения на размер запросов.
+type Limits struct {
+	// MaxBodyBytes - максимальный размер тела запроса в том виде, в котором оно передано, в том числе сжатого.
+	MaxBodyBytes int64 `json:"max_body_bytes" yaml:"max_body_bytes" toml:"max_body_bytes"`
+	// MaxDecodedBytes - максимальный размер тела запроса после распаковки.
+	MaxDecodedBytes int64 `json:"max_decoded_bytes" yaml:"max_decoded_bytes" toml:"max_decoded_bytes"`
+	// MaxURLLength - максимальная длина сокращаемого URL.
+	MaxURLLength int `json:"max_url_length" yaml:"max_url_length" toml:"max_url_length"`
+	// MaxBatchSize - максимальное количество URL в пакетном запросе.
+	MaxBatchSize int `json:"max_batch_size" yaml:"max_batch_size" toml:"max_batch_size"`
+}
+
+// Default возвращает ограничения по умолчанию.
+func Default() Limits {
+	return Limits{
+		MaxBodyBytes:    1 << 20,
+		MaxDecodedBytes: 8 << 20,
+		MaxURLLength:    8192,
+		MaxBatchSize:    1000,
+	}
+}
+
+// Parse возвращает ограничения по умолчанию, замененные непустыми значениями параметров.
+func Parse(maxBody, maxDecoded, maxURLLength, maxBatchSize string) (Limits, error) {
+	l := Default()
+	var err error
+	if maxBody != "" {
+		if l.MaxBodyBytes, err = strconv.ParseInt(maxBody, 10, 64); err != nil {
+			return l, fmt.Errorf("invalid max body size %q", maxBody)
+		}
+	}
+	if maxDecoded != "" {
+		if l.MaxDecodedBytes, err = strconv.ParseInt(maxDecoded, 10, 64); err != nil {
+			return l, fmt.Errorf("invalid max decoded body size %q", maxDecoded)
+		}
+	}
+	if maxURLLength != "" {
+		if l.MaxURLLength, err = strconv.Atoi(maxURLLength); err != nil {
+			return l, fmt.Errorf("invalid max url length %q", maxURLLength)
+		}
+	}
+	if maxBatchSize != "" {
+		if l.MaxBatchSize, err = strconv.Atoi(maxBatchSize); err != nil {
+			return l, fmt.Errorf("invalid max batch size %q", maxBatchSize)
+		}
+	}
+	return l, l.Validate()
+}
+
+// Validate проверяет, что все ограничения положительны.
+func (l Limits) Validate() error {
+	if l.MaxBodyBytes <= 0 || l.MaxDecodedBytes <= 0 || l.MaxURLLength <= 0 || l.MaxBatchSize <= 0 {
+		return fmt.Errorf("limits must be positive: %+v", l)
+	}
+	return nil
+}
+
+// LimitBody ограничивает размер тела запроса в том виде, в котором оно передано.
+// Должен применяться до распаковки.
+func (l Limits) LimitBody(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, l.MaxBodyBytes)
+}
+
+// ReadBody читает тело запроса после распаковки не более MaxDecodedBytes байт.
+// При превышении любого из ограничений возвращает ErrTooLarge.
+func (l Limits) ReadBody(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, l.MaxDecodedBytes+1))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, ErrTooLarge
+		}
+		return nil, err
+	}
+	if int64(len(b)) > l.MaxDecodedBytes {
+		return nil, ErrTooLarge
+	}
+	return b, nil
+}
+
+// CheckURL проверяет длину сокращаемого URL.
+func (l Limits) CheckURL(url string) error {
+	if len(url) > l.MaxURLLength {
+		return fmt.Errorf("%w: url longer than %d", ErrTooLarge, l.MaxURLLength)
+	}
+	return nil
+}
+
+// CheckBatch проверяет количество URL в пакетном запросе.
+func (l Limits) CheckBatch(n int) error {
+	if n > l.MaxBatchSize {
+		return fmt.Errorf("%w: more than %d urls in batch", ErrTooLarge, l.MaxBatchSize)
+	}
+	return nil
+}
+
+// Handle ограничивает размер тела запроса до его распаковки.
+func (l Limits) Handle(nextFunc http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.LimitBody(w, r)
+		nextFunc(w, r)
+	})
+}
+
+// WriteError отвечает 413 на превышение ограничений, остальные ошибки чтения - 500.
+func WriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
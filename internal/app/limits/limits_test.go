@@ -0,0 +1,60 @@
+package limits
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBody(t *testing.T) {
+	l := Limits{MaxBodyBytes: 100, MaxDecodedBytes: 1000, MaxURLLength: 10, MaxBatchSize: 2}
+
+	tests := []struct {
+		name    string
+		body    []byte
+		gzipped bool
+		wantErr error
+	}{
+		{name: "small", body: []byte("http://a")},
+		{name: "wire too large", body: bytes.Repeat([]byte("a"), 101), wantErr: ErrTooLarge},
+		{name: "gzip bomb", body: bytes.Repeat([]byte{0}, 100000), gzipped: true, wantErr: ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			if tt.gzipped {
+				var buf bytes.Buffer
+				gz := gzip.NewWriter(&buf)
+				gz.Write(body)
+				gz.Close()
+				body = buf.Bytes()
+			}
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			l.LimitBody(w, r)
+			if tt.gzipped {
+				gz, err := gzip.NewReader(r.Body)
+				require.NoError(t, err)
+				r.Body = gz
+			}
+			b, err := l.ReadBody(r)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, b)
+		})
+	}
+
+	assert.NoError(t, l.CheckURL("http://a"))
+	assert.True(t, errors.Is(l.CheckURL(strings.Repeat("a", 11)), ErrTooLarge))
+	assert.True(t, errors.Is(l.CheckBatch(3), ErrTooLarge))
+}
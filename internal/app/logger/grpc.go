@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataRequestID - ключ метаданных gRPC с идентификатором запроса.
+const MetadataRequestID = "x-request-id"
+
+// UnaryServerInterceptor возвращает перехватчик gRPC, который присваивает вызову идентификатор,
+// помещает в контекст журнал с полями вызова и по завершении записывает строку журнала доступа.
+// Должен быть первым в цепочке перехватчиков.
+func UnaryServerInterceptor(l *Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		id := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(MetadataRequestID); len(values) > 0 && len(values[0]) <= 128 {
+				id = values[0]
+			}
+		}
+		if id == "" {
+			id = NewRequestID()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(MetadataRequestID, id))
+
+		ctx = context.WithValue(ctx, CTXLogger{}, &scope{l: l.With("request_id", id, "route", info.FullMethod)})
+		ctx = context.WithValue(ctx, CTXRequestID{}, id)
+		resp, err := handler(ctx, req)
+
+		remote := ""
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			remote = p.Addr.String()
+		}
+		FromContext(ctx).Info("grpc request",
+			"transport", "grpc",
+			"code", status.Code(err).String(),
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote", remote)
+		return resp, err
+	}
+}
@@ -0,0 +1,120 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/jon69/shorturl/internal/app/respwriter"
+)
+
+// HeaderRequestID - заголовок с идентификатором запроса.
+const HeaderRequestID = "X-Request-ID"
+
+// scope хранит журнал запроса, который дополняется полями по мере обработки.
+type scope struct {
+	// mux - мьютекс для синхронизации.
+	mux sync.Mutex
+	// l - журнал с полями запроса.
+	l *Logger
+}
+
+// NewRequestID возвращает новый идентификатор запроса.
+func NewRequestID() string {
+	return uuid.NewV4().String()
+}
+
+// CTXRequestID структура для хранения идентификатора запроса в контексте.
+type CTXRequestID struct {
+}
+
+// RequestID возвращает идентификатор запроса из контекста.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(CTXRequestID{}).(string)
+	return id
+}
+
+// AddFields добавляет пары ключ-значение к журналу запроса, например идентификатор
+// пользователя после аутентификации. Поля попадают во все последующие записи запроса
+// и в запись журнала доступа.
+func AddFields(ctx context.Context, kv ...interface{}) {
+	if s, ok := ctx.Value(CTXLogger{}).(*scope); ok {
+		s.mux.Lock()
+		s.l = s.l.With(kv...)
+		s.mux.Unlock()
+	}
+}
+
+// AccessLog возвращает middleware для chi, которое присваивает запросу идентификатор,
+// помещает в контекст журнал с полями запроса и по завершении записывает строку журнала доступа.
+func AccessLog(l *Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get(HeaderRequestID)
+			if id == "" || len(id) > 128 {
+				id = NewRequestID()
+			}
+			w.Header().Set(HeaderRequestID, id)
+
+			s := &scope{l: l.With("request_id", id)}
+			ctx := context.WithValue(r.Context(), CTXLogger{}, s)
+			ctx = context.WithValue(ctx, CTXRequestID{}, id)
+			sw := respwriter.Wrap(w)
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			route := ""
+			if rctx := chi.RouteContext(ctx); rctx != nil {
+				route = rctx.RoutePattern()
+				// chi отбрасывает завершающий слеш, в том числе у корневого маршрута
+				if route == "" && len(rctx.RoutePatterns) > 0 {
+					route = "/"
+				}
+			}
+			FromContext(ctx).Info("http request",
+				"transport", "http",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", route,
+				"status", sw.Status(),
+				"bytes", sw.Bytes(),
+				"duration_ms", float64(time.Since(start).Microseconds())/1000,
+				"remote", r.RemoteAddr,
+				"user_agent", r.UserAgent())
+		})
+	}
+}
+
+// MyLevel хранит уровень журнала для выдачи и изменения.
+type MyLevel struct {
+	// Level - имя уровня.
+	Level string `json:"level"`
+}
+
+// LevelHandler возвращает обработчик, выдающий (GET) и меняющий (PUT) уровень журнала l.
+func LevelHandler(l *Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut || r.Method == http.MethodPost {
+			var req MyLevel
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level, err := ParseLevel(req.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			old := l.Level()
+			l.SetLevel(level)
+			FromContext(r.Context()).Warn("log level changed", "from", old.String(), "to", level.String())
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(MyLevel{Level: l.Level().String()})
+	}
+}
@@ -0,0 +1,324 @@
+// Модуль logger реализует структурированный журнал с уровнями в формате JSON или logfmt.
+// Уровень можно менять во время работы, значения секретов (куки, токены, ключи) маскируются.
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level - уровень важности записи.
+type Level int32
+
+// Уровни журнала.
+const (
+	// LevelDebug - отладочные сообщения.
+	LevelDebug Level = iota - 1
+	// LevelInfo - информационные сообщения.
+	LevelInfo
+	// LevelWarn - предупреждения.
+	LevelWarn
+	// LevelError - ошибки.
+	LevelError
+)
+
+// String возвращает имя уровня.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel разбирает имя уровня.
+func ParseLevel(str string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", str)
+}
+
+// Format - формат записей журнала.
+type Format string
+
+// Форматы журнала.
+const (
+	// FormatJSON - одна запись в формате JSON на строку.
+	FormatJSON Format = "json"
+	// FormatLogfmt - одна запись в формате key=value на строку.
+	FormatLogfmt Format = "logfmt"
+)
+
+// ParseFormat разбирает имя формата.
+func ParseFormat(str string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(str))) {
+	case "", FormatLogfmt:
+		return FormatLogfmt, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return FormatLogfmt, fmt.Errorf("unknown log format %q", str)
+}
+
+// sink - общий для всех производных журналов приемник записей.
+type sink struct {
+	// mux - мьютекс для синхронизации записи.
+	mux sync.Mutex
+	// out - приемник.
+	out io.Writer
+	// format - формат записей.
+	format Format
+	// level - минимальный записываемый уровень.
+	level int32
+}
+
+// Logger - журнал с набором полей, добавляемых к каждой записи.
+type Logger struct {
+	// sink - приемник записей.
+	sink *sink
+	// fields - пары ключ-значение, добавляемые к каждой записи.
+	fields []interface{}
+}
+
+// New создает журнал, пишущий в out в формате format записи уровня не ниже level.
+func New(out io.Writer, format Format, level Level) *Logger {
+	return &Logger{sink: &sink{out: out, format: format, level: int32(level)}}
+}
+
+// With возвращает журнал, добавляющий к каждой записи пары ключ-значение kv.
+// Уровень производного журнала меняется вместе с исходным.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(append(fields, l.fields...), kv...)
+	return &Logger{sink: l.sink, fields: fields}
+}
+
+// SetLevel меняет минимальный записываемый уровень.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.sink.level, int32(level))
+}
+
+// Level возвращает минимальный записываемый уровень.
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.sink.level))
+}
+
+// Enabled проверяет, будут ли записаны сообщения уровня level.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// Debug записывает отладочное сообщение.
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, msg, kv)
+}
+
+// Info записывает информационное сообщение.
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, msg, kv)
+}
+
+// Warn записывает предупреждение.
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(LevelWarn, msg, kv)
+}
+
+// Error записывает сообщение об ошибке.
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+}
+
+// Fatal записывает сообщение об ошибке и завершает процесс.
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+	exit(1)
+}
+
+// exit завершает процесс, подменяется в тестах.
+var exit = os.Exit
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	fields = append(fields, "time", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	fields = append(append(fields, l.fields...), kv...)
+
+	var buf bytes.Buffer
+	if l.sink.format == FormatJSON {
+		writeJSON(&buf, fields)
+	} else {
+		writeLogfmt(&buf, fields)
+	}
+	buf.WriteByte('\n')
+
+	l.sink.mux.Lock()
+	defer l.sink.mux.Unlock()
+	l.sink.out.Write(buf.Bytes())
+}
+
+// pairs перебирает пары ключ-значение, маскируя секреты.
+// Ключ без значения записывается с ключом "!BADKEY".
+func pairs(fields []interface{}, f func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			f("!BADKEY", fields[i])
+			return
+		}
+		key := fmt.Sprint(fields[i])
+		f(key, redact(key, fields[i+1]))
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	first := true
+	pairs(fields, func(key string, value interface{}) {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buf.Write(v)
+	})
+	buf.WriteByte('}')
+}
+
+func writeLogfmt(buf *bytes.Buffer, fields []interface{}) {
+	first := true
+	pairs(fields, func(key string, value interface{}) {
+		if !first {
+			buf.WriteByte(' ')
+		}
+		first = false
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case error:
+			s = v.Error()
+		case fmt.Stringer:
+			s = v.String()
+		default:
+			s = fmt.Sprint(v)
+		}
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	})
+}
+
+// std - журнал по умолчанию.
+var std atomic.Value
+
+func init() {
+	std.Store(New(os.Stderr, FormatLogfmt, LevelInfo))
+}
+
+// Default возвращает журнал по умолчанию.
+func Default() *Logger {
+	return std.Load().(*Logger)
+}
+
+// SetDefault заменяет журнал по умолчанию.
+func SetDefault(l *Logger) {
+	std.Store(l)
+}
+
+// CTXLogger структура для хранения журнала с полями запроса в контексте.
+type CTXLogger struct {
+}
+
+// WithContext возвращает контекст с журналом l.
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, CTXLogger{}, &scope{l: l})
+}
+
+// FromContext возвращает журнал запроса из контекста либо журнал по умолчанию.
+func FromContext(ctx context.Context) *Logger {
+	if s, ok := ctx.Value(CTXLogger{}).(*scope); ok {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		return s.l
+	}
+	return Default()
+}
+
+// Debug записывает отладочное сообщение в журнал по умолчанию.
+func Debug(msg string, kv ...interface{}) {
+	Default().log(LevelDebug, msg, kv)
+}
+
+// Info записывает информационное сообщение в журнал по умолчанию.
+func Info(msg string, kv ...interface{}) {
+	Default().log(LevelInfo, msg, kv)
+}
+
+// Warn записывает предупреждение в журнал по умолчанию.
+func Warn(msg string, kv ...interface{}) {
+	Default().log(LevelWarn, msg, kv)
+}
+
+// Error записывает сообщение об ошибке в журнал по умолчанию.
+func Error(msg string, kv ...interface{}) {
+	Default().log(LevelError, msg, kv)
+}
+
+// Fatal записывает сообщение об ошибке в журнал по умолчанию и завершает процесс.
+func Fatal(msg string, kv ...interface{}) {
+	Default().Fatal(msg, kv...)
+}
+
+// stdWriter перенаправляет в журнал сообщения стандартного пакета log.
+type stdWriter struct {
+	// l - журнал.
+	l *Logger
+}
+
+// Write записывает строку стандартного журнала как информационное сообщение.
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.l.Info(strings.TrimRight(string(p), "\n"), "source", "stdlog")
+	return len(p), nil
+}
+
+// StdWriter возвращает приемник для log.SetOutput, перенаправляющий сообщения
+// сторонних библиотек в журнал l.
+func StdWriter(l *Logger) io.Writer {
+	return stdWriter{l: l}
+}
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, FormatJSON, LevelInfo)
+
+	l.Debug("hidden")
+	assert.Empty(t, buf.String())
+
+	l.With("uid", "u1").Info("created", "token", "abc", "cookie_value", "def", "error", errors.New("boom"))
+	var rec map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	assert.Equal(t, "info", rec["level"])
+	assert.Equal(t, "created", rec["msg"])
+	assert.Equal(t, "u1", rec["uid"])
+	assert.Equal(t, Redacted, rec["token"])
+	assert.Equal(t, Redacted, rec["cookie_value"])
+	assert.Equal(t, "boom", rec["error"])
+
+	buf.Reset()
+	l.SetLevel(LevelDebug)
+	l.Debug("shown")
+	assert.Contains(t, buf.String(), `"msg":"shown"`)
+}
+
+func TestLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, FormatLogfmt, LevelInfo)
+	l.Warn("access denied", "path", "/a b", "authorization", "Bearer x")
+	line := buf.String()
+	assert.True(t, strings.HasPrefix(line, "time="))
+	assert.Contains(t, line, ` level=warn msg="access denied" path="/a b" authorization=[REDACTED]`)
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, FormatJSON, LevelInfo)
+	h := AccessLog(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddFields(r.Context(), "uid", "u1")
+		assert.NotEmpty(t, RequestID(r.Context()))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	r.Header.Set(HeaderRequestID, "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, "req-1", w.Header().Get(HeaderRequestID))
+	var rec map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	assert.Equal(t, "req-1", rec["request_id"])
+	assert.Equal(t, "u1", rec["uid"])
+	assert.Equal(t, float64(http.StatusCreated), rec["status"])
+	assert.Equal(t, float64(2), rec["bytes"])
+	assert.Equal(t, "/api/shorten", rec["path"])
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, Default(), FromContext(context.Background()))
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"strings"
+)
+
+// Redacted - значение, которым заменяются секреты.
+const Redacted = "[REDACTED]"
+
+// secretKeys - подстроки имен полей, значения которых не попадают в журнал.
+var secretKeys = []string{
+	"authorization",
+	"cookie",
+	"token",
+	"secret",
+	"password",
+	"signature",
+	"api_key",
+	"apikey",
+	"x-api-key",
+	"csrf",
+}
+
+// IsSecret проверяет, является ли поле с именем key секретным.
+func IsSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact заменяет значение секретного поля.
+func redact(key string, value interface{}) interface{} {
+	if IsSecret(key) {
+		return Redacted
+	}
+	return value
+}
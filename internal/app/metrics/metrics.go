@@ -0,0 +1,190 @@
+// Модуль metrics собирает метрики сервиса и отдает их в формате Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Результаты перехода по короткой ссылке.
+const (
+	// RedirectHit - ссылка найдена, клиент перенаправлен.
+	RedirectHit = "hit"
+	// RedirectMiss - ссылка не найдена.
+	RedirectMiss = "miss"
+	// RedirectGone - ссылка удалена или заблокирована.
+	RedirectGone = "gone"
+)
+
+// Хранилища, операции с которыми учитываются.
+const (
+	// BackendMemory - хранилище в памяти.
+	BackendMemory = "memory"
+	// BackendFile - файл.
+	BackendFile = "file"
+	// BackendDB - БД.
+	BackendDB = "db"
+)
+
+// Операции с хранилищем.
+const (
+	// OpPut - сохранение ссылки.
+	OpPut = "put"
+	// OpGet - получение ссылки.
+	OpGet = "get"
+	// OpDelete - удаление ссылки.
+	OpDelete = "delete"
+	// OpDisable - блокировка или разблокировка ссылки.
+	OpDisable = "disable"
+	// OpRestore - восстановление ссылок при запуске.
+	OpRestore = "restore"
+	// OpClicks - запись счетчиков переходов.
+	OpClicks = "clicks"
+	// OpList - выборка страницы ссылок пользователя.
+	OpList = "list"
+	// OpMeta - изменение описания ссылки.
+	OpMeta = "meta"
+)
+
+// Registry - реестр метрик сервиса.
+var Registry = prometheus.NewRegistry()
+
+// contentRegistry - реестр метрик, раскрывающих объем данных сервиса: количество ссылок и пользователей.
+// Отдается только обработчиком Handler.
+var contentRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "Number of gRPC calls by method and status code.",
+	}, []string{"method", "code"})
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "gRPC call latency by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	redirects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Number of short link lookups by result: hit, miss or gone.",
+	}, []string{"result"})
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Storage operation latency by backend and operation.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+	}, []string{"backend", "operation"})
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "errors_total",
+		Help:      "Number of failed storage operations, including file and DB write failures, by backend and operation.",
+	}, []string{"backend", "operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, grpcRequests, grpcDuration, redirects, storageDuration, storageErrors)
+}
+
+// Handler возвращает обработчик, отдающий все метрики в формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.Gatherers{Registry, contentRegistry}, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// PublicHandler возвращает обработчик, отдающий метрики без количества ссылок и пользователей
+// для клиентов, доступ которых к метрикам не проверялся.
+func PublicHandler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Redirect учитывает результат перехода по короткой ссылке.
+func Redirect(result string) {
+	redirects.WithLabelValues(result).Inc()
+}
+
+// ObserveStorage учитывает длительность операции op с хранилищем backend, начатой в start,
+// и ошибку, если операция не удалась.
+func ObserveStorage(backend string, op string, start time.Time, ok bool) {
+	storageDuration.WithLabelValues(backend, op).Observe(time.Since(start).Seconds())
+	if !ok {
+		storageErrors.WithLabelValues(backend, op).Inc()
+	}
+}
+
+// StorageStats предоставляет текущее состояние хранилища.
+type StorageStats interface {
+	// Counts возвращает количество неудаленных ссылок и пользователей.
+	Counts() (int, int)
+	// DeleteQueueDepth возвращает количество ожидающих выполнения удалений.
+	DeleteQueueDepth() int
+}
+
+// RegisterStorage регистрирует метрики, значения которых вычисляются по хранилищу s при каждом запросе метрик.
+func RegisterStorage(s StorageStats) error {
+	content := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "urls",
+			Help:      "Number of live short links.",
+		}, func() float64 {
+			urls, _ := s.Counts()
+			return float64(urls)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "users",
+			Help:      "Number of users who have created links.",
+		}, func() float64 {
+			_, users := s.Counts()
+			return float64(users)
+		}),
+	}
+	for _, g := range content {
+		if err := contentRegistry.Register(g); err != nil {
+			return err
+		}
+	}
+	gauges := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "delete_queue_depth",
+			Help:      "Number of pending asynchronous deletions.",
+		}, func() float64 {
+			return float64(s.DeleteQueueDepth())
+		}),
+	}
+	for _, g := range gauges {
+		if err := Registry.Register(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
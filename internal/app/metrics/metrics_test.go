@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct{}
+
+func (fakeStorage) Counts() (int, int)    { return 7, 3 }
+func (fakeStorage) DeleteQueueDepth() int { return 2 }
+
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	b, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(HTTPMiddleware)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	for _, path := range []string{"/abc", "/def", "/a/b/c"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	Redirect(RedirectMiss)
+	require.NoError(t, RegisterStorage(fakeStorage{}))
+
+	body := scrape(t)
+	assert.Contains(t, body, `shortener_http_requests_total{code="307",method="GET",route="/{id}"} 2`)
+	assert.Contains(t, body, `shortener_http_requests_total{code="404",method="GET",route="unmatched"} 1`)
+	assert.Contains(t, body, `shortener_redirects_total{result="miss"} 1`)
+	assert.Contains(t, body, "shortener_urls 7")
+	assert.Contains(t, body, "shortener_users 3")
+	assert.Contains(t, body, "shortener_storage_delete_queue_depth 2")
+
+	// без проверки клиента количество ссылок и пользователей не отдается
+	w := httptest.NewRecorder()
+	PublicHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "shortener_urls")
+	assert.NotContains(t, w.Body.String(), "shortener_users")
+	assert.Contains(t, w.Body.String(), "shortener_storage_delete_queue_depth 2")
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/jon69/shorturl/internal/app/respwriter"
+)
+
+// unmatchedRoute - маршрут запросов, не подошедших ни к одному обработчику.
+// Путь таких запросов не используется в метках, чтобы их количество было ограничено.
+const unmatchedRoute = "unmatched"
+
+// HTTPMiddleware - middleware для chi, учитывающее количество и длительность запросов по маршрутам.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := respwriter.Wrap(w)
+		next.ServeHTTP(sw, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && len(rctx.RoutePatterns) > 0 {
+			route = rctx.RoutePattern()
+			if route == "" {
+				route = "/"
+			}
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(sw.Status())).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// UnaryServerInterceptor возвращает перехватчик gRPC, учитывающий количество и длительность вызовов по методам.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
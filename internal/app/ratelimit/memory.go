@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval - период удаления давно не используемых корзин.
+const sweepInterval = time.Minute
+
+// bucket корзина токенов одного клиента.
+type bucket struct {
+	// tokens - количество токенов на момент updated.
+	tokens float64
+	// updated - время последнего пересчета.
+	updated time.Time
+	// limit - параметры корзины.
+	limit Limit
+}
+
+// refill пополняет корзину на момент now.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+	b.updated = now
+}
+
+// full проверяет, заполнена ли корзина на момент now.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+// MemoryLimiter хранит корзины в памяти процесса.
+type MemoryLimiter struct {
+	// mux - мьютекс для синхронизации.
+	mux *sync.Mutex
+	// buckets - корзины по ключам.
+	buckets map[string]*bucket
+	// swept - время последнего удаления неиспользуемых корзин.
+	swept time.Time
+	// now - источник текущего времени.
+	now func() time.Time
+}
+
+// NewMemoryLimiter создает ограничитель, хранящий корзины в памяти.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{mux: &sync.Mutex{}, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow расходует один запрос из корзины key.
+func (m *MemoryLimiter) Allow(key string, l Limit) Result {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok || b.limit != l {
+		b = &bucket{tokens: float64(l.Burst), updated: now, limit: l}
+		m.buckets[key] = b
+	}
+	b.refill(now)
+
+	res := Result{Limit: l.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(l.Burst) - b.tokens) / l.Rate * float64(time.Second))
+	return res
+}
+
+// sweep удаляет заполненные корзины: их состояние совпадает с состоянием новой корзины.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.swept) < sweepInterval {
+		return
+	}
+	m.swept = now
+	for key, b := range m.buckets {
+		if b.full(now) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Модуль ratelimit ограничивает частоту запросов клиентов алгоритмом token bucket.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// Заголовки ответа с информацией об ограничении.
+const (
+	// HeaderLimit - размер корзины.
+	HeaderLimit = "RateLimit-Limit"
+	// HeaderRemaining - количество оставшихся запросов.
+	HeaderRemaining = "RateLimit-Remaining"
+	// HeaderReset - через сколько секунд корзина заполнится полностью.
+	HeaderReset = "RateLimit-Reset"
+	// HeaderRetryAfter - через сколько секунд можно повторить отклоненный запрос.
+	HeaderRetryAfter = "Retry-After"
+)
+
+// Headers - заголовки с информацией об ограничении.
+var Headers = []string{HeaderLimit, HeaderRemaining, HeaderReset, HeaderRetryAfter}
+
+// Limit задает параметры корзины.
+type Limit struct {
+	// Rate - скорость пополнения корзины, запросов в секунду.
+	Rate float64
+	// Burst - емкость корзины.
+	Burst int
+}
+
+// ParseLimit разбирает ограничение вида "10/s", "600/m", "1000/h" с необязательной
+// емкостью корзины через двоеточие: "10/s:20". По умолчанию емкость равна количеству запросов.
+func ParseLimit(str string) (Limit, error) {
+	var l Limit
+	str = strings.TrimSpace(str)
+	rate, burst, hasBurst := strings.Cut(str, ":")
+	count, per, ok := strings.Cut(rate, "/")
+	if !ok {
+		return l, fmt.Errorf("invalid rate limit %q", str)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return l, fmt.Errorf("invalid rate limit %q", str)
+	}
+	var period time.Duration
+	switch strings.TrimSpace(per) {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return l, fmt.Errorf("invalid rate limit period %q", per)
+	}
+	l.Rate = float64(n) / period.Seconds()
+	l.Burst = n
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || l.Burst <= 0 {
+			return l, fmt.Errorf("invalid rate limit burst %q", str)
+		}
+	}
+	return l, nil
+}
+
+// Rules задает ограничения по именам маршрутов.
+type Rules map[string]Limit
+
+// Source возвращает действующее ограничение для маршрута.
+type Source interface {
+	// Lookup возвращает ограничение для маршрута route, если оно задано.
+	Lookup(route string) (Limit, bool)
+}
+
+// Lookup возвращает ограничение для маршрута route, если оно задано.
+func (r Rules) Lookup(route string) (Limit, bool) {
+	l, ok := r[route]
+	return l, ok
+}
+
+// Reloadable хранит ограничения, которые можно заменить без перезапуска.
+type Reloadable struct {
+	// rules - действующие ограничения типа Rules.
+	rules atomic.Value
+}
+
+// NewReloadable создает заменяемые ограничения с начальным значением rules.
+func NewReloadable(rules Rules) *Reloadable {
+	r := &Reloadable{}
+	r.Store(rules)
+	return r
+}
+
+// Store атомарно заменяет ограничения.
+func (r *Reloadable) Store(rules Rules) {
+	if rules == nil {
+		rules = Rules{}
+	}
+	r.rules.Store(rules)
+}
+
+// Rules возвращает действующие ограничения.
+func (r *Reloadable) Rules() Rules {
+	return r.rules.Load().(Rules)
+}
+
+// Lookup возвращает действующее ограничение для маршрута route, если оно задано.
+func (r *Reloadable) Lookup(route string) (Limit, bool) {
+	return r.Rules().Lookup(route)
+}
+
+// Маршруты, для которых задаются ограничения.
+const (
+	// RouteRedirect - переход по короткой ссылке.
+	RouteRedirect = "redirect"
+	// RouteShorten - сокращение одного URL.
+	RouteShorten = "shorten"
+	// RouteBatch - пакетное сокращение URL.
+	RouteBatch = "batch"
+	// RouteDelete - удаление URL.
+	RouteDelete = "delete"
+)
+
+// ParseRules разбирает ограничения вида "redirect=100/s:200,shorten=10/s,batch=1/s".
+func ParseRules(str string) (Rules, error) {
+	rules := Rules{}
+	for _, s := range strings.Split(str, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit rule %q", s)
+		}
+		l, err := ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		rules[strings.TrimSpace(route)] = l
+	}
+	return rules, nil
+}
+
+// String возвращает ограничения в текстовом виде.
+func (r Rules) String() string {
+	var parts []string
+	for route, l := range r {
+		parts = append(parts, fmt.Sprintf("%s=%g/s:%d", route, l.Rate, l.Burst))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Result хранит результат проверки ограничения.
+type Result struct {
+	// Allowed - признак того, что запрос разрешен.
+	Allowed bool
+	// Limit - емкость корзины.
+	Limit int
+	// Remaining - количество оставшихся в корзине запросов.
+	Remaining int
+	// RetryAfter - через сколько можно повторить отклоненный запрос.
+	RetryAfter time.Duration
+	// Reset - через сколько корзина заполнится полностью.
+	Reset time.Duration
+}
+
+// Limiter проверяет ограничения. Реализация может хранить корзины в памяти
+// либо во внешнем хранилище, общем для нескольких экземпляров сервиса.
+type Limiter interface {
+	// Allow расходует один запрос из корзины key с параметрами l.
+	Allow(key string, l Limit) Result
+}
+
+// KeyFunc возвращает ключ корзины для HTTP запроса.
+type KeyFunc func(r *http.Request) string
+
+// ContextKeyFunc возвращает ключ корзины для gRPC запроса.
+type ContextKeyFunc func(ctx context.Context) string
+
+// seconds округляет интервал вверх до целых секунд.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// headers возвращает заголовки с информацией об ограничении.
+func (res Result) headers() map[string]string {
+	h := map[string]string{
+		HeaderLimit:     strconv.Itoa(res.Limit),
+		HeaderRemaining: strconv.Itoa(res.Remaining),
+		HeaderReset:     seconds(res.Reset),
+	}
+	if !res.Allowed {
+		h[HeaderRetryAfter] = seconds(res.RetryAfter)
+	}
+	return h
+}
+
+// Handle ограничивает частоту запросов к маршруту route. Ограничение берется из rules
+// при каждом запросе; если оно не задано, запросы пропускаются без проверки.
+// Превысившим ограничение отвечает 429.
+func Handle(limiter Limiter, rules Source, route string, keyFunc KeyFunc, nextFunc http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return nextFunc
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, ok := rules.Lookup(route)
+		if !ok {
+			nextFunc(w, r)
+			return
+		}
+		key := keyFunc(r)
+		res := limiter.Allow(route+"|"+key, l)
+		for name, value := range res.headers() {
+			w.Header().Set(name, value)
+		}
+		if !res.Allowed {
+			logger.FromContext(r.Context()).Warn("rate limit exceeded", "limit_route", route, "key", key)
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		nextFunc(w, r)
+	})
+}
+
+// UnaryServerInterceptor ограничивает частоту вызовов gRPC методов. methods сопоставляет
+// полному имени метода имя маршрута из rules. Превысившим ограничение возвращается ResourceExhausted.
+func UnaryServerInterceptor(limiter Limiter, rules Source, methods map[string]string, keyFunc ContextKeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		route, ok := methods[info.FullMethod]
+		if !ok || limiter == nil {
+			return handler(ctx, req)
+		}
+		l, ok := rules.Lookup(route)
+		if !ok {
+			return handler(ctx, req)
+		}
+		key := keyFunc(ctx)
+		res := limiter.Allow(route+"|"+key, l)
+		md := metadata.MD{}
+		for name, value := range res.headers() {
+			md.Set(strings.ToLower(name), value)
+		}
+		if err := grpc.SetHeader(ctx, md); err != nil {
+			logger.FromContext(ctx).Error("can not set rate limit header", "error", err)
+		}
+		if !res.Allowed {
+			logger.FromContext(ctx).Warn("rate limit exceeded", "limit_route", route, "key", key)
+			return nil, status.Errorf(codes.ResourceExhausted, "too many requests, retry after %ss", seconds(res.RetryAfter))
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("redirect=100/s:200, batch=60/m")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 100, Burst: 200}, rules[RouteRedirect])
+	assert.Equal(t, Limit{Rate: 1, Burst: 60}, rules[RouteBatch])
+
+	_, err = ParseRules("shorten=10/d")
+	assert.Error(t, err)
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	l := Limit{Rate: 1, Burst: 2}
+
+	assert.True(t, m.Allow("a", l).Allowed)
+	assert.True(t, m.Allow("a", l).Allowed)
+	res := m.Allow("a", l)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.True(t, m.Allow("b", l).Allowed)
+
+	now = now.Add(time.Second)
+	assert.True(t, m.Allow("a", l).Allowed)
+}
+
+func TestHandle(t *testing.T) {
+	rules := Rules{RouteShorten: {Rate: 1, Burst: 1}}
+	h := Handle(NewMemoryLimiter(), rules, RouteShorten, func(r *http.Request) string { return "k" },
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) })
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "0", w.Header().Get(HeaderRemaining))
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get(HeaderRetryAfter))
+}
@@ -0,0 +1,79 @@
+// Модуль respwriter содержит обертку http.ResponseWriter, запоминающую код и размер ответа
+// для журнала доступа, метрик и трассировки.
+package respwriter
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// Writer запоминает код и размер ответа. Передает Flush и Hijack исходному http.ResponseWriter
+// и возвращает его методом Unwrap для http.ResponseController.
+type Writer struct {
+	http.ResponseWriter
+	// status - код ответа, 0 пока ответ не начат.
+	status int
+	// bytes - размер тела ответа.
+	bytes int
+}
+
+// Wrap оборачивает w. Если w уже обернут, возвращает ту же обертку, чтобы цепочка
+// middleware не оборачивала ответ несколько раз.
+func Wrap(w http.ResponseWriter) *Writer {
+	if rw, ok := w.(*Writer); ok {
+		return rw
+	}
+	return &Writer{ResponseWriter: w}
+}
+
+// WriteHeader запоминает код ответа.
+func (w *Writer) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write отправляет тело ответа и запоминает его размер, код по умолчанию 200.
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Status возвращает код ответа. Если обработчик ничего не записал, сервер отвечает 200.
+func (w *Writer) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Bytes возвращает размер тела ответа.
+func (w *Writer) Bytes() int {
+	return w.bytes
+}
+
+// Flush передает буферизованные данные клиенту, если это поддерживается.
+func (w *Writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack передает соединение обработчику, если это поддерживается, например для WebSocket.
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap возвращает исходный http.ResponseWriter.
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
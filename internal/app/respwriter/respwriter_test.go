@@ -0,0 +1,54 @@
+package respwriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := Wrap(rec)
+	assert.Equal(t, http.StatusOK, w.Status())
+	assert.Same(t, w, Wrap(w))
+	assert.Equal(t, rec, w.Unwrap())
+
+	w.WriteHeader(http.StatusTeapot)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("hello"))
+	w.Write([]byte(" world"))
+	assert.Equal(t, http.StatusTeapot, w.Status())
+	assert.Equal(t, 11, w.Bytes())
+
+	var _ http.Flusher = w
+	w.Flush()
+	assert.True(t, rec.Flushed)
+
+	// httptest.ResponseRecorder не поддерживает перехват соединения
+	var _ http.Hijacker = w
+	_, _, err := w.Hijack()
+	require.ErrorIs(t, err, http.ErrNotSupported)
+}
+
+func TestHijack(t *testing.T) {
+	hijacked := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, buf, err := Wrap(rw).Hijack()
+		if err == nil {
+			buf.WriteString("HTTP/1.1 204 No Content\r\n\r\n")
+			buf.Flush()
+			conn.Close()
+		}
+		hijacked <- err
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.NoError(t, <-hijacked)
+}
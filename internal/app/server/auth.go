@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/auth"
+	cookie "github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/handlers"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
+)
+
+// apiKeyStore предоставляет доступ к API ключам.
+type apiKeyStore interface {
+	// GetAPIKey возвращает действующий API ключ по его хешу.
+	GetAPIKey(hash string) (apikey.Key, bool)
+}
+
+// authenticator определяет клиента по API ключу, токену в заголовке или куке.
+type authenticator struct {
+	// keys - набор секретных ключей для подписи куки.
+	keys *keyring.KeyRing
+	// attrs - атрибуты выдаваемых кук.
+	attrs cookie.Attributes
+	// apikeys - хранилище API ключей.
+	apikeys apiKeyStore
+	// admins - пользователи с ролью администратора.
+	admins auth.Admins
+	// trusted - доверенные прокси для определения адреса клиента.
+	trusted *ipacl.Policy
+}
+
+// bearerToken возвращает токен из заголовка Authorization вида "Bearer <token>".
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+// withIdentity назначает клиенту роль и передает обработчику запрос с информацией о клиенте в контексте.
+func (a *authenticator) withIdentity(nextFunc http.HandlerFunc, w http.ResponseWriter, r *http.Request, id auth.Identity) {
+	id = a.admins.AssignRole(id)
+	logger.AddFields(r.Context(), "uid", id.UID, "auth", id.Method)
+	ctx := context.WithValue(r.Context(), handlers.CTXKey{}, id.UID)
+	ctx = auth.WithIdentity(ctx, id)
+	ctx = audit.WithSource(ctx, audit.Source{IP: clientIP(a.trusted, r), Transport: audit.TransportHTTP})
+	nextFunc(w, r.WithContext(ctx))
+}
+
+func (a *authenticator) authHandle(nextFunc http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if plain := r.Header.Get(apikey.Header); plain != "" { // API ключ
+			k, ok := a.apikeys.GetAPIKey(apikey.Hash(plain))
+			if !ok {
+				http.Error(w, "invalid api key", http.StatusUnauthorized)
+				return
+			}
+			a.withIdentity(nextFunc, w, r, k.Identity())
+			return
+		}
+
+		if bearer, ok := bearerToken(r); ok { // токен передан в заголовке
+			claims, valid := cookie.Validate(a.keys, bearer)
+			if !valid {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			if cookie.NeedRefresh(a.keys, claims) {
+				w.Header().Set("Authorization", "Bearer "+cookie.SignUID(a.keys, claims.UID))
+			}
+			a.withIdentity(nextFunc, w, r, auth.Identity{UID: claims.UID, Method: auth.MethodBearer, Scopes: auth.UserScopes})
+			return
+		}
+
+		uid := "emptyString"
+		uidCookie, err := r.Cookie(cookie.Name)
+		if err != nil { // куки нет, либо ошибка
+			switch {
+			case errors.Is(err, http.ErrNoCookie): // куки нет
+				logger.FromContext(r.Context()).Debug("cookie not found, issuing new one")
+				var name, value string
+				name, value, uid = cookie.GetNewSignedCookie(a.keys)
+				http.SetCookie(w, a.attrs.New(name, value))
+			default: // ошибка
+				logger.FromContext(r.Context()).Error("can not read cookie", "error", err)
+				http.Error(w, "server error", http.StatusInternalServerError)
+				return
+			}
+		} else { // кука есть
+			claims, valid := cookie.Validate(a.keys, uidCookie.Value)
+			switch {
+			case !valid:
+				var name, value string
+				name, value, uid = cookie.GetNewSignedCookie(a.keys)
+				http.SetCookie(w, a.attrs.New(name, value))
+			case cookie.NeedRefresh(a.keys, claims):
+				uid = claims.UID
+				http.SetCookie(w, a.attrs.New(cookie.Name, cookie.SignUID(a.keys, uid)))
+			default:
+				uid = claims.UID
+			}
+		}
+		a.withIdentity(nextFunc, w, r, auth.Identity{UID: uid, Method: auth.MethodCookie, Scopes: auth.UserScopes})
+	})
+}
+
+// scopeHandle пропускает только клиентов, обладающих правом scope.
+func scopeHandle(scope auth.Scope, nextFunc http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := auth.FromContext(r.Context())
+		if !ok || !id.HasScope(scope) {
+			logger.FromContext(r.Context()).Warn("access denied", "scope", scope)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		nextFunc(w, r)
+	})
+}
+
+// metricsHandle отдает все метрики клиентам из доверенных подсетей и клиентам с API ключом,
+// обладающим правом stats. Если доверенные подсети не заданы, остальным клиентам отдаются
+// метрики public без количества ссылок и пользователей, иначе им отвечает 403.
+func (a *authenticator) metricsHandle(full http.HandlerFunc, public http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := a.trusted.ClientIP(r)
+		switch {
+		case a.trusted.Contains(ip) || a.hasStatsKey(r):
+			full(w, r)
+		case a.trusted.Enabled():
+			logger.FromContext(r.Context()).Warn("access denied, untrusted address", "ip", ip, "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			public(w, r)
+		}
+	})
+}
+
+// hasStatsKey проверяет, передан ли действующий API ключ с правом stats.
+func (a *authenticator) hasStatsKey(r *http.Request) bool {
+	plain := r.Header.Get(apikey.Header)
+	if plain == "" {
+		return false
+	}
+	k, ok := a.apikeys.GetAPIKey(apikey.Hash(plain))
+	return ok && k.Identity().HasScope(auth.ScopeStats)
+}
+
+// trustedHandle пропускает запросы из доверенных подсетей, а также клиентов с API ключом,
+// обладающим правом stats.
+func trustedHandle(policy *ipacl.Policy, nextFunc http.HandlerFunc) http.HandlerFunc {
+	restricted := policy.Handle(nextFunc)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := auth.FromContext(r.Context()); ok && id.Method == auth.MethodAPIKey && id.HasScope(auth.ScopeStats) {
+			nextFunc(w, r)
+			return
+		}
+		restricted(w, r)
+	})
+}
+
+// roleHandle пропускает только клиентов с ролью role.
+func roleHandle(role auth.Role, nextFunc http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := auth.FromContext(r.Context())
+		if !ok || id.Role != role {
+			logger.FromContext(r.Context()).Warn("access denied", "role", role)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		nextFunc(w, r)
+	})
+}
+
+// clientIP возвращает адрес клиента с учетом доверенных прокси.
+func clientIP(policy *ipacl.Policy, r *http.Request) string {
+	if ip := policy.ClientIP(r); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// rateLimitKey возвращает функцию, различающую клиентов для ограничения частоты запросов:
+// по API ключу, по пользователю токена в заголовке, иначе по адресу. Куки выдаются
+// любому клиенту без ограничений, поэтому клиенты с кукой различаются по адресу.
+func rateLimitKey(policy *ipacl.Policy) ratelimit.KeyFunc {
+	return func(r *http.Request) string {
+		if id, ok := auth.FromContext(r.Context()); ok {
+			switch id.Method {
+			case auth.MethodAPIKey:
+				return "key:" + id.KeyID
+			case auth.MethodBearer:
+				return "uid:" + id.UID
+			}
+		}
+		return "ip:" + clientIP(policy, r)
+	}
+}
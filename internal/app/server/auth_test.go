@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/auth"
+	"github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/keyring"
+)
+
+// keyStore - API ключи по хешам.
+type keyStore map[string]apikey.Key
+
+func (s keyStore) GetAPIKey(hash string) (apikey.Key, bool) {
+	k, ok := s[hash]
+	return k, ok && !k.Revoked
+}
+
+func TestAuthHandleAPIKey(t *testing.T) {
+	active := apikey.Key{ID: "k1", Owner: "owner-1", Scopes: []auth.Scope{auth.ScopeRead}}
+	revoked := apikey.Key{ID: "k2", Owner: "owner-2", Scopes: auth.UserScopes, Revoked: true}
+	a := &authenticator{
+		keys:    keyring.NewKeyRing([]byte("secret")),
+		attrs:   cookie.DefaultAttributes(),
+		apikeys: keyStore{apikey.Hash("sk_active"): active, apikey.Hash("sk_revoked"): revoked},
+	}
+	var got auth.Identity
+	h := a.authHandle(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.FromContext(r.Context())
+	})
+
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "valid key", key: "sk_active", want: http.StatusOK},
+		{name: "unknown key", key: "sk_unknown", want: http.StatusUnauthorized},
+		{name: "revoked key", key: "sk_revoked", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = auth.Identity{}
+			r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			r.Header.Set(apikey.Header, tt.key)
+			w := httptest.NewRecorder()
+			h(w, r)
+			require.Equal(t, tt.want, w.Code)
+			// клиенту с API ключом кука не выдается
+			assert.Empty(t, w.Result().Cookies())
+			if tt.want == http.StatusOK {
+				assert.Equal(t, "owner-1", got.UID)
+				assert.Equal(t, auth.MethodAPIKey, got.Method)
+				assert.Equal(t, "k1", got.KeyID)
+				assert.True(t, got.HasScope(auth.ScopeRead))
+				assert.False(t, got.HasScope(auth.ScopeShorten))
+			} else {
+				assert.Empty(t, got.UID)
+			}
+		})
+	}
+}
+
+func TestRoleHandle(t *testing.T) {
+	a := &authenticator{
+		keys:  keyring.NewKeyRing([]byte("secret")),
+		attrs: cookie.DefaultAttributes(),
+		apikeys: keyStore{
+			apikey.Hash("sk_admin"): {ID: "k1", Owner: "admin-uid", Scopes: auth.UserScopes},
+			apikey.Hash("sk_user"):  {ID: "k2", Owner: "user-uid", Scopes: auth.UserScopes},
+		},
+		admins: auth.ParseAdmins("admin-uid"),
+	}
+	h := a.authHandle(roleHandle(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for key, want := range map[string]int{"sk_admin": http.StatusNoContent, "sk_user": http.StatusForbidden, "": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodGet, "/api/admin/links", nil)
+		if key != "" {
+			r.Header.Set(apikey.Header, key)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		assert.Equal(t, want, w.Code, key)
+	}
+}
+
+func TestMetricsHandle(t *testing.T) {
+	keys := keyStore{
+		apikey.Hash("sk_stats"): {ID: "k1", Owner: "ops", Scopes: []auth.Scope{auth.ScopeStats}},
+		apikey.Hash("sk_read"):  {ID: "k2", Owner: "app", Scopes: []auth.Scope{auth.ScopeRead}},
+	}
+	full := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("full")) }
+	public := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("public")) }
+	trusted, err := ipacl.New("10.0.0.0/8", "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		trusted *ipacl.Policy
+		remote  string
+		key     string
+		want    string
+		code    int
+	}{
+		{name: "no subnets", remote: "192.0.2.1:1000", want: "public", code: http.StatusOK},
+		{name: "no subnets, stats key", remote: "192.0.2.1:1000", key: "sk_stats", want: "full", code: http.StatusOK},
+		{name: "no subnets, other key", remote: "192.0.2.1:1000", key: "sk_read", want: "public", code: http.StatusOK},
+		{name: "trusted address", trusted: trusted, remote: "10.1.2.3:1000", want: "full", code: http.StatusOK},
+		{name: "untrusted address", trusted: trusted, remote: "192.0.2.1:1000", code: http.StatusForbidden},
+		{name: "untrusted address, stats key", trusted: trusted, remote: "192.0.2.1:1000", key: "sk_stats", want: "full", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authenticator{apikeys: keys, trusted: tt.trusted}
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			r.RemoteAddr = tt.remote
+			if tt.key != "" {
+				r.Header.Set(apikey.Header, tt.key)
+			}
+			w := httptest.NewRecorder()
+			a.metricsHandle(full, public)(w, r)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	cookie "github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// isSafeMethod проверяет, что метод запроса не изменяет состояние.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// usesHeaderAuth проверяет, передает ли клиент учетные данные в заголовке (токен или API ключ).
+// Такие клиенты не подвержены CSRF и освобождаются от проверки.
+func usesHeaderAuth(r *http.Request) bool {
+	if _, ok := bearerToken(r); ok {
+		return true
+	}
+	return r.Header.Get(apikey.Header) != ""
+}
+
+// usesCookieAuth проверяет, аутентифицирован ли запрос кукой uid.
+func usesCookieAuth(r *http.Request) bool {
+	if usesHeaderAuth(r) {
+		return false
+	}
+	_, err := r.Cookie(cookie.Name)
+	return err == nil
+}
+
+// csrfHandle защищает изменяющие состояние запросы, аутентифицированные кукой,
+// проверкой CSRF токена по схеме double-submit cookie.
+// Клиенту без CSRF куки выдается новый токен.
+func csrfHandle(enabled bool, attrs cookie.Attributes, nextFunc http.HandlerFunc) http.HandlerFunc {
+	if !enabled {
+		return nextFunc
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if usesHeaderAuth(r) {
+			nextFunc(w, r)
+			return
+		}
+		if !isSafeMethod(r.Method) && usesCookieAuth(r) && !cookie.CheckCSRF(r) {
+			logger.FromContext(r.Context()).Warn("CSRF token mismatch")
+			http.Error(w, "CSRF token mismatch", http.StatusForbidden)
+			return
+		}
+		if c, err := r.Cookie(cookie.CSRFCookieName); err != nil || c.Value == "" {
+			tok, err := cookie.NewCSRFToken()
+			if err != nil {
+				logger.FromContext(r.Context()).Error("can not create CSRF token", "error", err)
+				http.Error(w, "server error", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, attrs.CSRFCookie(tok))
+			// страница, отдаваемая в ответе, встраивает токен в форму
+			r = r.WithContext(cookie.WithCSRFToken(r.Context(), tok))
+		}
+		nextFunc(w, r)
+	})
+}
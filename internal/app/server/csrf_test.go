@@ -0,0 +1,97 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/cookie"
+)
+
+func TestCSRFHandle(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	h := csrfHandle(true, cookie.DefaultAttributes(), ok)
+
+	tests := []struct {
+		name    string
+		method  string
+		csrf    string
+		header  string
+		headers map[string]string
+		want    int
+	}{
+		{name: "token matches", method: http.MethodPost, csrf: "tok", header: "tok", want: http.StatusNoContent},
+		{name: "token mismatch", method: http.MethodPost, csrf: "tok", header: "other", want: http.StatusForbidden},
+		{name: "no csrf cookie", method: http.MethodDelete, header: "tok", want: http.StatusForbidden},
+		{name: "no header", method: http.MethodPost, csrf: "tok", want: http.StatusForbidden},
+		{name: "safe method", method: http.MethodGet, want: http.StatusNoContent},
+		{name: "bearer token", method: http.MethodPost, headers: map[string]string{"Authorization": "Bearer x"}, want: http.StatusNoContent},
+		{name: "api key", method: http.MethodPost, headers: map[string]string{apikey.Header: "x"}, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.AddCookie(&http.Cookie{Name: cookie.Name, Value: "signed-uid"})
+			if tt.csrf != "" {
+				r.AddCookie(&http.Cookie{Name: cookie.CSRFCookieName, Value: tt.csrf})
+			}
+			if tt.header != "" {
+				r.Header.Set(cookie.CSRFHeader, tt.header)
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	// клиенту без CSRF куки выдается токен
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, cookie.CSRFCookieName, cookies[0].Name)
+		assert.NotEmpty(t, cookies[0].Value)
+	}
+
+	// токен из поля формы, тело после проверки доступно обработчику
+	form := "url=http%3A%2F%2Fexample.com&csrf_token="
+	echo := csrfHandle(true, cookie.DefaultAttributes(), func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	})
+	for value, want := range map[string]int{"tok": http.StatusOK, "other": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form+value))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: "signed-uid"})
+		r.AddCookie(&http.Cookie{Name: cookie.CSRFCookieName, Value: "tok"})
+		w = httptest.NewRecorder()
+		echo(w, r)
+		assert.Equal(t, want, w.Code, value)
+		if want == http.StatusOK {
+			assert.Equal(t, form+value, w.Body.String())
+		}
+	}
+
+	// выданный токен доступен странице в том же ответе
+	var issued string
+	page := csrfHandle(true, cookie.DefaultAttributes(), func(w http.ResponseWriter, r *http.Request) {
+		issued = cookie.CSRFToken(r)
+	})
+	w = httptest.NewRecorder()
+	page(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, issued)
+	assert.Equal(t, w.Result().Cookies()[0].Value, issued)
+
+	// без куки uid запрос не аутентифицирован кукой и не проверяется
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
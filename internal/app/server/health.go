@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/health"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+// deleteStallTimeout - время без завершенных удалений при непустой очереди,
+// после которого фоновые удаления считаются зависшими.
+const deleteStallTimeout = 30 * time.Second
+
+// newReadiness создает проверку готовности: URL восстановлены при запуске, БД отвечает,
+// файл хранилища доступен для записи, фоновые удаления выполняются.
+func newReadiness(urlstorage *storage.StorageURL) *health.Checker {
+	c := health.NewChecker(health.DefaultTimeout)
+	c.Add("storage", func(context.Context) error {
+		return urlstorage.RestoreError()
+	})
+	c.Add("db", urlstorage.PingDB)
+	c.Add("file", func(context.Context) error {
+		return urlstorage.CheckFile()
+	})
+	c.Add("delete_worker", func(context.Context) error {
+		return urlstorage.CheckDeletes(deleteStallTimeout)
+	})
+	return c
+}
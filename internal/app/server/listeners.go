@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/jon69/shorturl/internal/app/health"
+)
+
+// acmeChallengePrefix - путь проверок ACME HTTP-01.
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// redirectHTTPS перенаправляет запрос с кодом 308 на тот же адрес по HTTPS с портом httpsPort.
+// Код 308 сохраняет метод и тело запроса.
+func redirectHTTPS(httpsPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
+
+// plainRouter обслуживает HTTP без TLS при включенном HTTPS: проверки живости и готовности
+// отвечают как есть, проверки ACME HTTP-01 передаются в challenge (если он задан),
+// остальные запросы перенаправляются на HTTPS.
+func plainRouter(httpsPort string, readiness *health.Checker, challenge http.Handler) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/healthz", health.LiveHandler)
+	r.Get("/readyz", readiness.ReadyHandler())
+	if challenge != nil {
+		r.Handle(acmeChallengePrefix+"*", challenge)
+	}
+	r.NotFound(redirectHTTPS(httpsPort))
+	r.MethodNotAllowed(redirectHTTPS(httpsPort))
+	return r
+}
+
+// isGRPC определяет вызов gRPC по версии протокола и типу содержимого.
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcMux направляет вызовы gRPC в grpcHandler, остальные запросы в httpHandler.
+// Позволяет обслуживать gRPC и HTTP на одном порту, gRPC работает только по HTTP/2.
+func grpcMux(grpcHandler http.Handler, httpHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPC(r) {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
+
+// withH2C включает HTTP/2 без TLS (h2c) для обработчика handler.
+func withH2C(handler http.Handler) http.Handler {
+	return h2c.NewHandler(handler, &http2.Server{})
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/jon69/shorturl/internal/app/config"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
+)
+
+// ConfigLoader повторно собирает конфигурацию из файла, окружения и флагов.
+type ConfigLoader func() (config.Config, error)
+
+// reloadable - параметры, которые применяются без перезапуска.
+var reloadable = map[string]bool{
+	"trusted_subnet":   true,
+	"trusted_proxies":  true,
+	"log_level":        true,
+	"rate_limits":      true,
+	"secret_keys_file": true,
+}
+
+// SetConfigLoader устанавливает действующую конфигурацию cfg и функцию load,
+// которой конфигурация перечитывается по сигналу SIGHUP.
+func (h *MyServer) SetConfigLoader(cfg config.Config, load ConfigLoader) {
+	h.config = cfg
+	h.loadConfig = load
+}
+
+// reload перечитывает конфигурацию и применяет изменившиеся параметры, которые
+// не требуют перезапуска: доверенные подсети и прокси, уровень журнала, ограничения частоты запросов
+// и набор ключей подписи из файла secret_keys_file. Ключи перечитываются при каждой перезагрузке,
+// чтобы после shortener keys rotate на общем файле все реплики принимали токены с новым ключом.
+// Если новая конфигурация неверна, продолжает работать со старой.
+func (h *MyServer) reload() {
+	if h.loadConfig == nil {
+		logger.Warn("config reload is not configured, SIGHUP ignored")
+		return
+	}
+	logger.Info("reloading config")
+	cfg, err := h.loadConfig()
+	if err != nil {
+		logger.Error("config reload failed, keeping current config", "error", err)
+		return
+	}
+
+	// все значения уже проверены при загрузке, поэтому сначала разбираем, затем применяем,
+	// чтобы не применить конфигурацию частично
+	trusted, err := ipacl.New(cfg.TrustedSubnet, strings.Join(cfg.TrustedProxies, ","))
+	if err != nil {
+		logger.Error("config reload failed, keeping current config", "error", err)
+		return
+	}
+	rules, err := ratelimit.ParseRules(cfg.RateLimitsString())
+	if err != nil {
+		logger.Error("config reload failed, keeping current config", "error", err)
+		return
+	}
+	level, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		logger.Error("config reload failed, keeping current config", "error", err)
+		return
+	}
+	var keys *keyring.KeyRing
+	if cfg.SecretKeysFile != "" && h.keys != nil {
+		if keys, err = keyring.Load(cfg.SecretKeysFile); err != nil {
+			logger.Error("config reload failed, keeping current config", "error", err)
+			return
+		}
+	}
+
+	var applied, restart []string
+	for _, key := range config.Diff(h.config, cfg) {
+		if reloadable[key] {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+
+	h.trusted.Update(trusted)
+	h.rateLimits.Store(rules)
+	logger.Default().SetLevel(level)
+	if keys != nil {
+		h.keys.Replace(keys)
+		kid, _ := h.keys.Active()
+		logger.Info("secret keys reloaded", "path", cfg.SecretKeysFile, "active", kid, "ids", h.keys.IDs())
+	}
+	// остальные параметры действуют прежние до перезапуска
+	h.config.TrustedSubnet = cfg.TrustedSubnet
+	h.config.TrustedProxies = cfg.TrustedProxies
+	h.config.RateLimits = cfg.RateLimits
+	h.config.LogLevel = cfg.LogLevel
+	h.config.SecretKeysFile = cfg.SecretKeysFile
+
+	logger.Info("config reloaded", "applied", strings.Join(applied, ","), "restart_required", strings.Join(restart, ","),
+		"trusted", h.trusted.String(), "rate_limits", rules.String(), "log_level", level.String())
+	if len(restart) > 0 {
+		logger.Warn("changed settings require restart", "settings", strings.Join(restart, ","))
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/config"
+	"github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
+)
+
+// logRecords разбирает записи журнала в формате JSON по сообщениям.
+func logRecords(t *testing.T, out string) map[string]map[string]interface{} {
+	records := make(map[string]map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var rec map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &rec), line)
+		records[rec["msg"].(string)] = rec
+	}
+	return records
+}
+
+func TestReload(t *testing.T) {
+	defer logger.SetDefault(logger.Default())
+
+	current := config.Config{BaseURL: "http://localhost:8080", LogLevel: "info",
+		TrustedSubnet: "192.0.2.0/24", RateLimits: map[string]string{ratelimit.RouteShorten: "1/s"}}
+	changed := current
+	changed.TrustedSubnet = "10.0.0.0/8"
+	changed.TrustedProxies = []string{"198.51.100.0/24"}
+	changed.RateLimits = map[string]string{ratelimit.RouteShorten: "10/s:20"}
+	changed.LogLevel = "debug"
+	restart := current
+	restart.BaseURL = "http://sho.rt"
+	restart.DatabaseDSN = "postgres://localhost/shorturl"
+	invalid := changed
+	invalid.TrustedSubnet = "not a subnet"
+
+	tests := []struct {
+		name     string
+		next     config.Config
+		err      error
+		failed   bool
+		reloaded bool
+		applied  string
+		restart  string
+	}{
+		{name: "reloadable settings", next: changed, reloaded: true,
+			applied: "log_level,rate_limits,trusted_proxies,trusted_subnet"},
+		{name: "settings requiring restart", next: restart, restart: "base_url,database_dsn"},
+		{name: "invalid config", next: invalid, failed: true},
+		{name: "load error", err: errors.New("can not read config file"), failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger.SetDefault(logger.New(&out, logger.FormatJSON, logger.LevelInfo))
+			trusted, err := ipacl.New(current.TrustedSubnet, "")
+			require.NoError(t, err)
+			rules, err := ratelimit.ParseRules(current.RateLimitsString())
+			require.NoError(t, err)
+
+			h := MakeMyServer()
+			h.SetTrustedPolicy(trusted)
+			h.rateLimits.Store(rules)
+			h.SetConfigLoader(current, func() (config.Config, error) { return tt.next, tt.err })
+			out.Reset()
+			h.reload()
+
+			records := logRecords(t, out.String())
+			if tt.failed {
+				// конфигурация не применяется даже частично
+				assert.Contains(t, records, "config reload failed, keeping current config")
+				assert.True(t, h.trusted.Contains(net.ParseIP("192.0.2.1")))
+				l, _ := h.rateLimits.Lookup(ratelimit.RouteShorten)
+				assert.Equal(t, 1, l.Burst)
+				assert.Equal(t, logger.LevelInfo, logger.Default().Level())
+				assert.Equal(t, current, h.config)
+				return
+			}
+
+			require.Contains(t, records, "config reloaded")
+			assert.Equal(t, tt.applied, records["config reloaded"]["applied"])
+			assert.Equal(t, tt.restart, records["config reloaded"]["restart_required"])
+			if tt.restart != "" {
+				require.Contains(t, records, "changed settings require restart")
+				assert.Equal(t, tt.restart, records["changed settings require restart"]["settings"])
+			} else {
+				assert.NotContains(t, records, "changed settings require restart")
+			}
+
+			assert.Equal(t, tt.reloaded, h.trusted.Contains(net.ParseIP("10.1.2.3")))
+			assert.Equal(t, !tt.reloaded, h.trusted.Contains(net.ParseIP("192.0.2.1")))
+			l, ok := h.rateLimits.Lookup(ratelimit.RouteShorten)
+			require.True(t, ok)
+			level := logger.LevelInfo
+			burst := 1
+			if tt.reloaded {
+				level, burst = logger.LevelDebug, 20
+			}
+			assert.Equal(t, burst, l.Burst)
+			assert.Equal(t, level, logger.Default().Level())
+			// параметры, требующие перезапуска, остаются прежними
+			assert.Equal(t, current.BaseURL, h.config.BaseURL)
+			assert.Equal(t, current.DatabaseDSN, h.config.DatabaseDSN)
+			assert.Equal(t, tt.next.TrustedSubnet, h.config.TrustedSubnet)
+		})
+	}
+}
+
+func TestReloadKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	initial, err := keyring.Generate()
+	require.NoError(t, err)
+	require.NoError(t, initial.Save(path))
+	keys, err := keyring.Load(path)
+	require.NoError(t, err)
+	oldTok := cookie.SignUID(keys, "user-1")
+
+	cfg := config.Config{SecretKeysFile: path}
+	h := MakeMyServer()
+	h.SetKeyRing(keys)
+	h.SetConfigLoader(cfg, func() (config.Config, error) { return cfg, nil })
+
+	// ключ ротирован другой репликой или командой shortener keys rotate
+	rotated, err := keyring.Load(path)
+	require.NoError(t, err)
+	kid, err := rotated.Rotate()
+	require.NoError(t, err)
+	require.NoError(t, rotated.Save(path))
+	newTok := cookie.SignUID(rotated, "user-2")
+	_, ok := cookie.Validate(keys, newTok)
+	require.False(t, ok)
+
+	h.reload()
+	claims, ok := cookie.Validate(keys, newTok)
+	require.True(t, ok)
+	assert.Equal(t, "user-2", claims.UID)
+	_, ok = cookie.Validate(keys, oldTok)
+	assert.True(t, ok)
+	active, _ := keys.Active()
+	assert.Equal(t, kid, active)
+
+	// поврежденный файл не заменяет действующие ключи
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0600))
+	h.reload()
+	assert.Equal(t, []string{initial.IDs()[0], kid}, keys.IDs())
+}
@@ -4,25 +4,43 @@ package server
 import (
 	"compress/gzip"
 	"context"
-
+	"crypto/tls"
 	"errors"
+	"fmt"
+
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	_ "net/http/pprof"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/auth"
+	"github.com/jon69/shorturl/internal/app/config"
 	cookie "github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/gateway"
 	rpcsrv "github.com/jon69/shorturl/internal/app/grpcserver"
 	"github.com/jon69/shorturl/internal/app/handlers"
-	"github.com/jon69/shorturl/internal/app/httpsmaker"
+	"github.com/jon69/shorturl/internal/app/health"
+	"github.com/jon69/shorturl/internal/app/ipacl"
+	"github.com/jon69/shorturl/internal/app/keyring"
+	"github.com/jon69/shorturl/internal/app/lifecycle"
+	"github.com/jon69/shorturl/internal/app/limits"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/metrics"
+	"github.com/jon69/shorturl/internal/app/ratelimit"
 	"github.com/jon69/shorturl/internal/app/storage"
+	"github.com/jon69/shorturl/internal/app/titles"
+	"github.com/jon69/shorturl/internal/app/tracing"
+	"github.com/jon69/shorturl/internal/app/webui"
 )
 
 // MyServer хранит информацию о сервере.
@@ -31,155 +49,501 @@ type MyServer struct {
 	serverAddress string
 	// baseURL - адрес (хост:порт) для выдачи сохраненных URL.
 	baseURL string
+	// domains - домены кратких ссылок, nil - только домен baseURL.
+	domains *domains.Registry
 	// filePath - путь до файла с информацией о сохраненных URL.
 	filePath string
-	// key - секретный ключ на подписи куки.
-	key []byte
+	// keys - набор секретных ключей для подписи куки.
+	keys *keyring.KeyRing
 	// conndb - параметры подключения к БД.
 	conndb string
 	// enableHTTPS - признак использования HTTPS.
 	enableHTTPS bool
-	// trustedSubNet - доверенная подсеть.
-	trustedSubNet string
+	// tlsConfig - настройки TLS для HTTPS.
+	tlsConfig *tls.Config
+	// acmeAddress - адрес сервера проверок ACME HTTP-01.
+	acmeAddress string
+	// acmeHandler - обработчик проверок ACME HTTP-01.
+	acmeHandler http.Handler
+	// redirectAddress - адрес HTTP сервера, перенаправляющего запросы на HTTPS.
+	redirectAddress string
+	// h2c - признак поддержки HTTP/2 без TLS.
+	h2c bool
+	// grpcOnHTTP - признак обслуживания gRPC на порту HTTP сервера.
+	grpcOnHTTP bool
+	// trusted - доверенные подсети и прокси.
+	trusted *ipacl.Policy
+	// grpcReflection - признак регистрации сервиса рефлексии gRPC.
+	grpcReflection bool
+	// cookieAttrs - атрибуты выдаваемых кук.
+	cookieAttrs cookie.Attributes
+	// csrfProtection - признак проверки CSRF токена.
+	csrfProtection bool
+	// admins - пользователи с ролью администратора.
+	admins auth.Admins
+	// auditLogPath - путь до файла журнала аудита.
+	auditLogPath string
+	// fetchTitles - признак загрузки заголовков страниц для новых ссылок.
+	fetchTitles bool
+	// titleFetchTimeout - время ожидания страницы при загрузке заголовка.
+	titleFetchTimeout time.Duration
+	// rateLimits - ограничения частоты запросов по маршрутам, заменяемые при перезагрузке конфигурации.
+	rateLimits *ratelimit.Reloadable
+	// limits - ограничения на размер запросов.
+	limits limits.Limits
+	// shutdownTimeout - срок остановки сервиса.
+	shutdownTimeout time.Duration
+	// grpcAddress - адрес (хост:порт) gRPC сервера.
+	grpcAddress string
+	// pprofAddress - адрес (хост:порт) сервера pprof.
+	pprofAddress string
+	// config - действующая конфигурация, с которой сравнивается перезагруженная.
+	config config.Config
+	// loadConfig - повторно собирает конфигурацию по сигналу SIGHUP.
+	loadConfig ConfigLoader
 }
 
 // MakeMyServer создает новый сервер.
 func MakeMyServer() MyServer {
 	h := MyServer{}
 	h.enableHTTPS = false
+	h.cookieAttrs = cookie.DefaultAttributes()
+	h.limits = limits.Default()
+	h.trusted = &ipacl.Policy{}
+	h.rateLimits = ratelimit.NewReloadable(nil)
+	h.shutdownTimeout = lifecycle.DefaultTimeout
+	h.titleFetchTimeout = titles.DefaultTimeout
+	h.grpcAddress = rpcsrv.ListenAddr
+	h.pprofAddress = ":6060"
 	return h
 }
 
 // SetServerAddr устанавливает новое значение адреса на котором запускается сервер.
 func (h *MyServer) SetServerAddr(str string) {
 	h.serverAddress = str
-	log.Print("server address=" + h.serverAddress)
+	logger.Info("server address", "addr", h.serverAddress)
 }
 
 // SetBaseURL устанавливает новое значение адреса для выдачи сохраненных URL.
 func (h *MyServer) SetBaseURL(str string) {
 	h.baseURL = str
-	log.Print("base url=" + h.baseURL)
+	logger.Info("base url", "base_url", h.baseURL)
+}
+
+// SetDomains устанавливает домены кратких ссылок вместо единственного домена baseURL.
+func (h *MyServer) SetDomains(r *domains.Registry) {
+	h.domains = r
+	for _, d := range r.All() {
+		logger.Info("short link domain", "domain", d.Host, "base_url", d.BaseURL, "owners", strings.Join(d.Owners(), ","))
+	}
 }
 
 // SetFilePath устанавливает новое значение пути для сохранение URL.
 func (h *MyServer) SetFilePath(str string) {
 	h.filePath = str
-	log.Print("path to file=" + h.filePath)
+	logger.Info("path to file", "path", h.filePath)
 }
 
-// SetSecretKey устанавливает новое значение секретного ключа.
-func (h *MyServer) SetSecretKey(b []byte) {
-	h.key = b
+// SetKeyRing устанавливает набор секретных ключей.
+func (h *MyServer) SetKeyRing(keys *keyring.KeyRing) {
+	h.keys = keys
+	logger.Info("secret keys", "ids", keys.IDs())
 }
 
 // SetConnDB устанавливает новое значение параметров подключения к БД.
 func (h *MyServer) SetConnDB(str string) {
 	h.conndb = str
-	log.Print("connection to db=" + h.conndb)
+	logger.Info("connection to db", "configured", h.conndb != "")
 }
 
-// SetTrustedSubNet устанавливает значение доверенной подсети.
-func (h *MyServer) SetTrustedSubNet(str string) {
-	h.trustedSubNet = str
-	log.Print("trustedSubNet=" + h.trustedSubNet)
+// SetTrustedPolicy устанавливает доверенные подсети и прокси.
+// При перезагрузке конфигурации списки обновляются в этой же политике.
+func (h *MyServer) SetTrustedPolicy(p *ipacl.Policy) {
+	h.trusted = p
+	logger.Info("trusted addresses", "policy", p.String())
 }
 
 // SetEnableHTTPS устанавливает признак использования HTTPS соединения.
-func (h *MyServer) SetEnableHTTPS(str string) {
-	if str != "" {
-		h.enableHTTPS = true
-	} else {
-		h.enableHTTPS = false
+func (h *MyServer) SetEnableHTTPS(enabled bool) {
+	h.enableHTTPS = enabled
+	logger.Info("enable HTTPS", "enabled", h.enableHTTPS)
+}
+
+// SetTLSConfig устанавливает настройки TLS, с которыми запускается HTTPS сервер.
+func (h *MyServer) SetTLSConfig(cfg *tls.Config) {
+	h.tlsConfig = cfg
+}
+
+// SetACMEChallenge устанавливает адрес и обработчик сервера проверок ACME HTTP-01.
+// Пустой адрес или обработчик nil отключают сервер.
+func (h *MyServer) SetACMEChallenge(addr string, handler http.Handler) {
+	h.acmeAddress = addr
+	h.acmeHandler = handler
+	logger.Info("ACME HTTP-01 challenge server", "addr", addr, "enabled", addr != "" && handler != nil)
+}
+
+// SetRedirectAddress устанавливает адрес HTTP сервера, который при включенном HTTPS
+// перенаправляет запросы на HTTPS с кодом 308. Пустой адрес отключает сервер.
+func (h *MyServer) SetRedirectAddress(addr string) {
+	h.redirectAddress = addr
+	logger.Info("HTTPS redirect server", "addr", addr, "enabled", addr != "")
+}
+
+// SetH2C устанавливает признак поддержки HTTP/2 без TLS (h2c), действует только без HTTPS.
+func (h *MyServer) SetH2C(enabled bool) {
+	h.h2c = enabled
+	logger.Info("h2c", "enabled", h.h2c)
+}
+
+// SetGRPCOnHTTP устанавливает признак обслуживания gRPC на порту HTTP сервера
+// вместе с остальными маршрутами. Вызовы gRPC определяются по типу содержимого.
+func (h *MyServer) SetGRPCOnHTTP(enabled bool) {
+	h.grpcOnHTTP = enabled
+	logger.Info("gRPC on HTTP port", "enabled", h.grpcOnHTTP)
+}
+
+// SetGRPCReflection устанавливает признак регистрации сервиса рефлексии gRPC.
+func (h *MyServer) SetGRPCReflection(enabled bool) {
+	h.grpcReflection = enabled
+	logger.Info("gRPC reflection", "enabled", h.grpcReflection)
+}
+
+// SetCookieAttributes устанавливает атрибуты выдаваемых кук.
+func (h *MyServer) SetCookieAttributes(attrs cookie.Attributes) {
+	h.cookieAttrs = attrs
+	logger.Info("cookie attributes", "attrs", fmt.Sprintf("%+v", attrs))
+}
+
+// SetCSRFProtection устанавливает признак проверки CSRF токена.
+func (h *MyServer) SetCSRFProtection(enabled bool) {
+	h.csrfProtection = enabled
+	logger.Info("CSRF protection", "enabled", h.csrfProtection)
+}
+
+// SetAdminUIDs устанавливает список идентификаторов администраторов через запятую.
+func (h *MyServer) SetAdminUIDs(str string) {
+	h.admins = auth.ParseAdmins(str)
+	logger.Info("admin uids", "uids", str)
+}
+
+// SetAuditLogPath устанавливает путь до файла журнала аудита.
+// Если путь не задан, журнал ведется в БД, а при ее отсутствии в памяти.
+func (h *MyServer) SetAuditLogPath(str string) {
+	h.auditLogPath = str
+	logger.Info("audit log path", "path", str)
+}
+
+// SetFetchTitles включает загрузку заголовков страниц для новых ссылок без заголовка.
+func (h *MyServer) SetFetchTitles(enabled bool) {
+	h.fetchTitles = enabled
+	logger.Info("fetch titles", "enabled", enabled)
+}
+
+// SetTitleFetchTimeout устанавливает время ожидания страницы при загрузке заголовка.
+func (h *MyServer) SetTitleFetchTimeout(d time.Duration) {
+	h.titleFetchTimeout = d
+}
+
+// SetRateLimits устанавливает ограничения частоты запросов по маршрутам.
+func (h *MyServer) SetRateLimits(rules ratelimit.Rules) {
+	h.rateLimits.Store(rules)
+	logger.Info("rate limits", "rules", rules.String())
+}
+
+// SetLimits устанавливает ограничения на размер запросов.
+func (h *MyServer) SetLimits(l limits.Limits) {
+	h.limits = l
+	logger.Info("request limits", "limits", l)
+}
+
+// SetGRPCAddress устанавливает адрес gRPC сервера.
+func (h *MyServer) SetGRPCAddress(str string) {
+	h.grpcAddress = str
+	logger.Info("gRPC address", "addr", str)
+}
+
+// SetPprofAddress устанавливает адрес сервера pprof.
+func (h *MyServer) SetPprofAddress(str string) {
+	h.pprofAddress = str
+	logger.Info("pprof address", "addr", str)
+}
+
+// SetShutdownTimeout устанавливает срок остановки сервиса: за это время должны завершиться
+// обрабатываемые запросы и фоновые удаления.
+func (h *MyServer) SetShutdownTimeout(d time.Duration) {
+	if d > 0 {
+		h.shutdownTimeout = d
 	}
-	log.Print("enable HTTPS=" + str)
 }
 
-// RunServers устанавливает обработчки и запускает сервера.
-func (h *MyServer) RunServers() {
+// RunServers устанавливает обработчки и запускает сервера. Работает до сигнала остановки
+// или аварийного завершения сервера, затем останавливает сервис и возвращает код завершения процесса.
+func (h *MyServer) RunServers() int {
 
 	sigs := make(chan os.Signal, 1)
 	// регистрируем перенаправление прерываний
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	// SIGHUP перезагружает конфигурацию
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	defer signal.Stop(hups)
 	// создаем потокобезопасное хранилище общее для HTTP и gRPC
 	urlstorage := storage.NewStorage(h.filePath, h.conndb)
+	urlstorage.StartClickFlush(storage.ClickFlushInterval)
+	// журнал аудита общий для HTTP и gRPC
+	auditLog := audit.NewLogger(audit.Open(h.auditLogPath, h.conndb))
+	urlstorage.SetAuditLog(auditLog)
+	if err := metrics.RegisterStorage(urlstorage); err != nil {
+		logger.Error("can not register storage metrics", "error", err)
+	}
+	// загрузчик заголовков страниц общий для HTTP и gRPC
+	var titleFetcher *titles.Fetcher
+	if h.fetchTitles {
+		titleFetcher = titles.New(titles.NewClient(h.titleFetchTimeout), urlstorage)
+		titleFetcher.Start(titles.Workers)
+	}
+	// ограничитель частоты запросов общий для HTTP и gRPC
+	limiter := ratelimit.NewMemoryLimiter()
+	// проверка готовности общая для /readyz и grpc.health.v1
+	readiness := newReadiness(urlstorage)
 
 	// создаем gRPC сервер для обработки
-	rpcServer := rpcsrv.MakeServer(h.key, h.baseURL, h.conndb, urlstorage)
+	rpcServer := rpcsrv.MakeServer(h.keys, h.baseURL, h.conndb, urlstorage, h.limits)
+	rpcServer.SetAdmins(h.admins)
+	rpcServer.SetAuditLog(auditLog)
+	rpcServer.SetTitleFetcher(titleFetcher)
+	if h.domains != nil {
+		rpcServer.SetDomains(h.domains)
+	}
+	rpcServer.SetTrustedPolicy(h.trusted)
+	rpcServer.SetRateLimits(limiter, h.rateLimits)
+	rpcServer.SetReadiness(readiness)
+	rpcServer.SetAddr(h.grpcAddress)
+	if h.grpcReflection {
+		rpcServer.EnableReflection()
+	}
+
+	// создаем шлюз HTTP/JSON к gRPC API
+	gw, err := gateway.MakeGateway(dialAddress(h.grpcAddress), h.cookieAttrs)
+	if err != nil {
+		logger.Fatal("can not create gateway", "error", err)
+	}
+	gw.SetTrustedPolicy(h.trusted)
+	gw.SetLimits(h.limits)
 
 	// создаем HTTP сервер для обработки
 	handler := handlers.MakeMyHandler(h.conndb, urlstorage)
 	handler.SetBaseURL(h.baseURL)
-	handler.SetTrustedSubNet(h.trustedSubNet)
+	if h.domains != nil {
+		handler.SetDomains(h.domains)
+	}
+	handler.SetAuditLog(auditLog)
+	handler.SetTitleFetcher(titleFetcher)
+	handler.SetLimits(h.limits)
 	r := chi.NewRouter()
+	// журнал доступа присваивает запросу идентификатор и ведется для всех маршрутов,
+	// спан запроса создается после него, чтобы идентификатор трассировки попал в журнал
+	r.Use(logger.AccessLog(logger.Default()), tracing.HTTPMiddleware, metrics.HTTPMiddleware)
 
 	r.Get("/ping", handler.ServeGetPING)
-	r.Get("/{id}", authHandle(h.key, gzipHandle(handler.ServeGetHTTP)))
-	r.Get("/api/user/urls", authHandle(h.key, gzipHandle(handler.ServeGetAllURLS)))
-	r.Get("/api/internal/stats", authHandle(h.key, gzipHandle(handler.ServeGetStats)))
-	r.Post("/", authHandle(h.key, gzipHandle(handler.ServePostHTTP)))
-	r.Post("/api/shorten", authHandle(h.key, gzipHandle(handler.ServeShortenPostHTTP)))
-	r.Post("/api/shorten/batch", authHandle(h.key, gzipHandle(handler.ServeShortenPostBatchHTTP)))
-	r.Delete("/api/user/urls", authHandle(h.key, gzipHandle(handler.ServeDeleteBatchHTTP)))
-
-	var mainsrv = http.Server{Addr: h.serverAddress, Handler: r}
-	var pprofsrv = http.Server{Addr: ":6060"}
-
-	// запускаем горутину обработки пойманных прерываний
-	go func() {
-		// читаем из канала прерываний
-		<-sigs
-		log.Println("interrupted...graceful shutdown")
-		// завершаем работу PRC севера
-		rpcServer.Shutdown()
-		// получили сигнал запускаем процедуру graceful shutdown
-		if err := pprofsrv.Shutdown(context.Background()); err != nil {
-			log.Printf("Pprof HTTP server Shutdown: %v", err)
+	r.Get("/healthz", health.LiveHandler)
+	r.Get("/readyz", readiness.ReadyHandler())
+	authn := &authenticator{keys: h.keys, attrs: h.cookieAttrs, apikeys: urlstorage, admins: h.admins, trusted: h.trusted}
+	// подсети проверяются при каждом запросе, так как могут измениться при перезагрузке конфигурации
+	r.Get("/metrics", authn.metricsHandle(metrics.Handler().ServeHTTP, metrics.PublicHandler().ServeHTTP))
+	// authed объединяет ограничение размера тела, проверку CSRF, аутентификацию и сжатие
+	authed := func(nextFunc http.HandlerFunc) http.HandlerFunc {
+		return h.limits.Handle(csrfHandle(h.csrfProtection, h.cookieAttrs, authn.authHandle(gzipHandle(nextFunc))))
+	}
+	// scoped дополнительно проверяет права клиента
+	scoped := func(scope auth.Scope, nextFunc http.HandlerFunc) http.HandlerFunc {
+		return authed(scopeHandle(scope, nextFunc))
+	}
+
+	// limited ограничивает частоту запросов к маршруту route
+	limitKey := rateLimitKey(h.trusted)
+	limited := func(route string, nextFunc http.HandlerFunc) http.HandlerFunc {
+		return ratelimit.Handle(limiter, h.rateLimits, route, limitKey, nextFunc)
+	}
+
+	// веб-интерфейс для браузеров, куки выдаются уже при загрузке страницы
+	r.Get("/", authed(webui.ServeIndex))
+	r.Handle(webui.AssetsPrefix+"*", webui.Assets())
+	r.Get("/{id}", authed(limited(ratelimit.RouteRedirect, handler.ServeGetHTTP)))
+	r.Get("/api/qr/{code}", scoped(auth.ScopeRead, handler.ServeGetQR))
+	r.Get("/api/user/urls", scoped(auth.ScopeRead, handler.ServeGetAllURLS))
+	r.Get("/api/user/urls/export", scoped(auth.ScopeRead, handler.ServeExportURLs))
+	r.Post("/api/user/urls/import", scoped(auth.ScopeShorten, limited(ratelimit.RouteBatch, handler.ServeImportURLs)))
+	// изменение описания ограничивается вместе с сокращением, так как тоже пишет в хранилище
+	r.Patch("/api/user/urls/{code}", scoped(auth.ScopeShorten, limited(ratelimit.RouteShorten, handler.ServePatchURL)))
+	r.Post("/", scoped(auth.ScopeShorten, limited(ratelimit.RouteShorten, handler.ServePostHTTP)))
+	r.Post("/api/shorten", scoped(auth.ScopeShorten, limited(ratelimit.RouteShorten, handler.ServeShortenPostHTTP)))
+	r.Post("/api/shorten/batch", scoped(auth.ScopeShorten, limited(ratelimit.RouteBatch, handler.ServeShortenPostBatchHTTP)))
+	r.Delete("/api/user/urls", scoped(auth.ScopeDelete, limited(ratelimit.RouteDelete, handler.ServeDeleteBatchHTTP)))
+	r.Route("/api/internal", func(r chi.Router) {
+		// internal дополнительно проверяет адрес клиента по доверенным подсетям
+		internal := func(nextFunc http.HandlerFunc) http.HandlerFunc {
+			return authed(trustedHandle(h.trusted, nextFunc))
 		}
-		// получили сигнал запускаем процедуру graceful shutdown
-		if err := mainsrv.Shutdown(context.Background()); err != nil {
-			log.Printf("Main HTTP server Shutdown: %v", err)
+		r.Get("/stats", internal(handler.ServeGetStats))
+	})
+	r.Route("/api/admin", func(r chi.Router) {
+		// admin дополнительно проверяет роль администратора
+		admin := func(nextFunc http.HandlerFunc) http.HandlerFunc {
+			return authed(roleHandle(auth.RoleAdmin, nextFunc))
 		}
-	}()
+		r.Get("/keys", admin(handler.ServeGetAPIKeys))
+		r.Post("/keys", admin(handler.ServePostAPIKey))
+		r.Delete("/keys/{id}", admin(handler.ServeDeleteAPIKey))
+		r.Get("/links", admin(handler.ServeAdminSearchLinks))
+		r.Post("/links/takedown", admin(handler.ServeAdminTakedown))
+		r.Post("/links/{code}/disable", admin(handler.ServeAdminDisableLink))
+		r.Post("/links/{code}/enable", admin(handler.ServeAdminEnableLink))
+		r.Delete("/links/{code}", admin(handler.ServeAdminDeleteLink))
+		r.Get("/users", admin(handler.ServeAdminUserCounts))
+		r.Get("/audit", admin(handler.ServeAdminAudit))
+		r.Get("/log/level", admin(logger.LevelHandler(logger.Default())))
+		r.Put("/log/level", admin(logger.LevelHandler(logger.Default())))
+	})
+	r.Mount("/v1", h.limits.Handle(csrfHandle(h.csrfProtection, h.cookieAttrs, gzipHandle(gw.ServeHTTP))))
+
+	var mainHandler http.Handler = r
+	if h.grpcOnHTTP {
+		mainHandler = grpcMux(rpcServer, mainHandler)
+	}
+	if !h.enableHTTPS && h.h2c {
+		mainHandler = withH2C(mainHandler)
+	}
+	var mainsrv = http.Server{Addr: h.serverAddress, Handler: mainHandler}
+	var pprofsrv = http.Server{Addr: h.pprofAddress}
+	// серверы без TLS при включенном HTTPS: проверки ACME HTTP-01 и перенаправление на HTTPS
+	plainsrvs := h.plainServers(readiness)
+
+	// serveErrs получает ошибки серверов, завершившихся не по команде остановки
+	serveErrs := make(chan error, 2)
 
 	go func() {
 		err := rpcServer.Serve()
 		if err != nil {
-			log.Printf("rpcServer Serve exited with err: %v", err)
+			logger.Error("gRPC server exited", "error", err)
+			serveErrs <- err
 		} else {
-			log.Printf("rpcServer Serve exited.")
+			logger.Info("gRPC server exited")
 		}
 	}()
 
 	// только для pprof приходится запустить отдельный сервер
 	go func() {
 		err := pprofsrv.ListenAndServe()
-		if err != nil {
-			log.Printf("pprofsrv ListenAndServe exited with err: %v", err)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("pprof server exited", "error", err)
 		} else {
-			log.Printf("pprofsrv ListenAndServe exited.")
+			logger.Info("pprof server exited")
 		}
 	}()
 
-	if h.enableHTTPS {
-		certFile, keyFile, err := httpsmaker.MakeHTTPS()
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = mainsrv.ListenAndServeTLS(certFile, keyFile)
-		if err != nil {
-			log.Printf("mainsrv ListenAndServeTLS exited with err: %v", err)
+	for _, srv := range plainsrvs {
+		go func(srv *http.Server) {
+			err := srv.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("HTTP redirect server exited", "addr", srv.Addr, "error", err)
+				serveErrs <- err
+			} else {
+				logger.Info("HTTP redirect server exited", "addr", srv.Addr)
+			}
+		}(srv)
+	}
+
+	go func() {
+		var err error
+		if h.enableHTTPS {
+			// сертификат берется из TLSConfig, в том числе обновленный после перезагрузки файлов
+			mainsrv.TLSConfig = h.tlsConfig
+			err = mainsrv.ListenAndServeTLS("", "")
 		} else {
-			log.Printf("mainsrv ListenAndServeTLS exited.")
+			err = mainsrv.ListenAndServe()
 		}
-	} else {
-		err := mainsrv.ListenAndServe()
-		if err != nil {
-			log.Printf("mainsrv ListenAndServe exited with err: %v", err)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("main HTTP server exited", "error", err)
+			serveErrs <- err
 		} else {
-			log.Printf("mainsrv ListenAndServe exited.")
+			logger.Info("main HTTP server exited")
 		}
+	}()
+
+	// ждем сигнала остановки или аварийного завершения одного из серверов
+	var serveErr error
+wait:
+	for {
+		select {
+		case <-hups:
+			h.reload()
+			// подхватываем ключи, созданные и отозванные командой shortener apikey
+			urlstorage.ReloadAPIKeys()
+		case sig := <-sigs:
+			logger.Info("interrupted, graceful shutdown", "signal", sig.String())
+			break wait
+		case serveErr = <-serveErrs:
+			logger.Error("server failed, shutting down", "error", serveErr)
+			break wait
+		}
+	}
+	// сразу перестаем считаться готовыми, чтобы балансировщик не направлял новые запросы
+	readiness.SetShuttingDown()
+
+	// HTTP сервер останавливается раньше gRPC, так как запросы шлюза обрабатываются gRPC сервером,
+	// хранилище закрывается последним, после завершения всех запросов
+	lc := lifecycle.New(h.shutdownTimeout)
+	lc.OnStop("http", mainsrv.Shutdown)
+	lc.OnStop("pprof", pprofsrv.Shutdown)
+	for _, srv := range plainsrvs {
+		lc.OnStop("redirect "+srv.Addr, srv.Shutdown)
+	}
+	lc.OnStop("gateway", func(context.Context) error {
+		return gw.Close()
+	})
+	lc.OnStop("grpc", rpcServer.Shutdown)
+	if titleFetcher != nil {
+		lc.OnStop("titles", titleFetcher.Shutdown)
+	}
+	lc.OnStop("storage", urlstorage.Close)
+	shutdownErr := lc.Shutdown(context.Background())
+	if shutdownErr != nil {
+		logger.Error("graceful shutdown failed", "error", shutdownErr)
+	} else {
+		logger.Info("graceful shutdown completed")
 	}
+	return lifecycle.ExitCode(serveErr, shutdownErr)
+}
+
+// plainServers создает серверы без TLS, которые нужны при включенном HTTPS: сервер проверок
+// ACME HTTP-01 и сервер перенаправления на HTTPS. Если адреса совпадают, создается один сервер.
+func (h *MyServer) plainServers(readiness *health.Checker) []*http.Server {
+	if !h.enableHTTPS {
+		return nil
+	}
+	_, httpsPort, _ := net.SplitHostPort(h.serverAddress)
+	var srvs []*http.Server
+	if h.acmeAddress != "" && h.acmeHandler != nil {
+		srvs = append(srvs, &http.Server{Addr: h.acmeAddress, Handler: plainRouter(httpsPort, readiness, h.acmeHandler)})
+	}
+	if h.redirectAddress != "" && (len(srvs) == 0 || h.redirectAddress != h.acmeAddress) {
+		srvs = append(srvs, &http.Server{Addr: h.redirectAddress, Handler: plainRouter(httpsPort, readiness, nil)})
+	}
+	return srvs
+}
+
+// dialAddress возвращает адрес для подключения шлюза к gRPC серверу того же процесса:
+// если сервер слушает все интерфейсы, подключение идет через localhost.
+func dialAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
 }
 
 type gzipWriter struct {
@@ -190,7 +554,6 @@ type gzipWriter struct {
 // Write записывает данные в сжатом формате
 func (w gzipWriter) Write(b []byte) (int, error) {
 	// w.Writer будет отвечать за gzip-сжатие, поэтому пишем в него
-	log.Print("compressing data...", b)
 	return w.Writer.Write(b)
 }
 
@@ -227,38 +590,3 @@ func gzipHandle(nextFunc http.HandlerFunc) http.HandlerFunc {
 		nextFunc(gzipWriter{ResponseWriter: w, Writer: gz}, r)
 	})
 }
-
-func authHandle(secretKey []byte, nextFunc http.HandlerFunc) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Print("received request, method = ", r.Method)
-		log.Print("request, path = ", r.URL.Path)
-		uid := "emptyString"
-		uidCookie, err := r.Cookie("uid")
-		if err != nil { // куки нет, либо ошибка
-			switch {
-			case errors.Is(err, http.ErrNoCookie): // куки нет
-				log.Println("cookie not found")
-				log.Println(err)
-				var newCookie http.Cookie
-				newCookie.Name, newCookie.Value, uid = cookie.GetNewSignedCookie(secretKey)
-				http.SetCookie(w, &newCookie)
-			default: // ошибка
-				log.Println(err)
-				http.Error(w, "server error", http.StatusInternalServerError)
-				return
-			}
-		} else { // кука есть
-			log.Println("found cookie=" + uidCookie.Value)
-			var equal bool
-			equal, uid = cookie.ValidateCookie(secretKey, uidCookie.Name, uidCookie.Value)
-			if !equal {
-				var newCookie http.Cookie
-				newCookie.Name, newCookie.Value, uid = cookie.GetNewSignedCookie(secretKey)
-				http.SetCookie(w, &newCookie)
-			}
-		}
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, handlers.CTXKey{}, uid)
-		nextFunc(w, r.WithContext(ctx))
-	})
-}
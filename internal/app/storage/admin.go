@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/metrics"
+	"github.com/jon69/shorturl/internal/app/tracing"
+)
+
+// AdminURL представляет информацию о URL для администратора.
+type AdminURL struct {
+	// Code - краткая форма URL.
+	Code string `json:"code"`
+	// Domain - пространство ссылок домена, пустое у домена по умолчанию.
+	Domain string `json:"domain,omitempty"`
+	// OriginalURL - исходная длинная форма URL.
+	OriginalURL string `json:"original_url"`
+	// Owner - идентификатор владельца.
+	Owner string `json:"owner"`
+	// Deleted - признак удаления.
+	Deleted bool `json:"deleted"`
+	// Disabled - признак блокировки администратором.
+	Disabled bool `json:"disabled"`
+	// Reason - причина блокировки.
+	Reason string `json:"reason,omitempty"`
+	// Meta - описание ссылки.
+	Meta
+}
+
+// URLFilter задает условия поиска URL.
+type URLFilter struct {
+	// Domain - пространство ссылок домена, пустое у домена по умолчанию.
+	Domain string
+	// AllDomains - искать на всех доменах, Domain не учитывается.
+	AllDomains bool
+	// Code - точное совпадение краткой формы.
+	Code string
+	// Destination - подстрока исходного URL.
+	Destination string
+	// Owner - идентификатор владельца.
+	Owner string
+	// Limit - максимальное количество результатов, 0 - без ограничений.
+	Limit int
+}
+
+// UserCount представляет количество ссылок пользователя.
+type UserCount struct {
+	// UID - идентификатор пользователя.
+	UID string `json:"uid"`
+	// Count - количество неудаленных ссылок.
+	Count int `json:"count"`
+}
+
+func (h *StorageURL) setDisabled(ns string, key string, disabled bool, reason string) {
+	entry, ok := h.urls[ns][key]
+	if !ok {
+		return
+	}
+	entry.disabled = disabled
+	entry.reason = reason
+	h.urls[ns][key] = entry
+}
+
+// appendEvent дописывает событие операции op в файл хранилища.
+func (h *StorageURL) appendEvent(ctx context.Context, event EventDel, op string) bool {
+	if h.filePath == "" {
+		return true
+	}
+	data, err := json.Marshal(&event)
+	if err != nil {
+		logger.Error("can not marshal event", "error", err)
+		return false
+	}
+	return h.writeFile(ctx, append(data, '\n'), op)
+}
+
+// SearchURLs ищет URL всех пользователей по условиям фильтра.
+// Результат упорядочен по времени создания.
+func (h *StorageURL) SearchURLs(f URLFilter) []AdminURL {
+	var urls []AdminURL
+	type keyed struct {
+		id  uint64
+		url AdminURL
+	}
+	var found []keyed
+
+	h.mux.RLock()
+	for ns, nsURLS := range h.urls {
+		if !f.AllDomains && ns != f.Domain {
+			continue
+		}
+		for key, element := range nsURLS {
+			if f.Code != "" && key != f.Code {
+				continue
+			}
+			if f.Owner != "" && element.uid != f.Owner {
+				continue
+			}
+			if f.Destination != "" && !strings.Contains(element.value, f.Destination) {
+				continue
+			}
+			found = append(found, keyed{id: element.uidI, url: element.admin(ns, key)})
+		}
+	}
+	h.mux.RUnlock()
+
+	sort.Slice(found, func(i, j int) bool { return found[i].id < found[j].id })
+	for _, k := range found {
+		if f.Limit > 0 && len(urls) >= f.Limit {
+			break
+		}
+		urls = append(urls, k.url)
+	}
+	return urls
+}
+
+// SetURLDisabled блокирует или разблокирует URL на домене по умолчанию с указанием причины.
+// Возвращает false, если URL не найден или изменение не удалось сохранить.
+func (h *StorageURL) SetURLDisabled(code string, disabled bool, reason string) bool {
+	return h.SetURLDisabledContext(context.Background(), domains.DefaultNamespace, code, disabled, reason)
+}
+
+// SetURLDisabledContext блокирует или разблокирует URL в пространстве ссылок домена domain,
+// трассируя запись в БД и в файл.
+func (h *StorageURL) SetURLDisabledContext(ctx context.Context, domain string, code string, disabled bool, reason string) bool {
+	ctx, span := tracing.Start(ctx, "storage.SetURLDisabled")
+	defer span.End()
+	h.lock(ctx)
+	defer h.mux.Unlock()
+
+	entry, ok := h.urls[domain][code]
+	if !ok {
+		logger.Warn("can not change link state: not found", "domain", domain, "code", code)
+		return false
+	}
+	if !disabled {
+		reason = ""
+	}
+	if h.connDB != "" {
+		start := time.Now()
+		ok := dbh.SetDisabled(ctx, h.connDB, domain, code, disabled, reason)
+		metrics.ObserveStorage(metrics.BackendDB, metrics.OpDisable, start, ok)
+		if !ok {
+			return false
+		}
+	}
+	event := entry.event(domain)
+	event.Disabled, event.Reason = disabled, reason
+	if !h.appendEvent(ctx, event, metrics.OpDisable) {
+		return false
+	}
+	h.setDisabled(domain, code, disabled, reason)
+	logger.Info("link state changed", "domain", domain, "code", code, "disabled", disabled, "reason", reason)
+	return true
+}
+
+// UserURLCounts возвращает количество неудаленных ссылок каждого пользователя
+// в порядке убывания.
+func (h *StorageURL) UserURLCounts() []UserCount {
+	counts := make(map[string]int)
+	h.mux.RLock()
+	for _, nsURLS := range h.urls {
+		for _, element := range nsURLS {
+			if !element.deleted {
+				counts[element.uid]++
+			}
+		}
+	}
+	h.mux.RUnlock()
+
+	result := make([]UserCount, 0, len(counts))
+	for uid, count := range counts {
+		result = append(result, UserCount{UID: uid, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].UID < result[j].UID
+	})
+	return result
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	st := NewStorage(path, "")
+	ctx := context.Background()
+	_, c1 := st.PutUserURLContext(ctx, "", "u1", "http://golang.org/doc")
+	_, c2 := st.PutUserURLContext(ctx, "", "u1", "http://example.com")
+	_, c3 := st.PutUserURLContext(ctx, "", "u2", "http://golang.org/pkg")
+	st.PutUserURLContext(ctx, "sho.rt", "u2", "http://other.com")
+
+	codes := func(urls []AdminURL) []string {
+		var res []string
+		for _, u := range urls {
+			res = append(res, u.Code)
+		}
+		return res
+	}
+	assert.Equal(t, []string{c2}, codes(st.SearchURLs(URLFilter{Code: c2})))
+	assert.Equal(t, []string{c1, c3}, codes(st.SearchURLs(URLFilter{Destination: "golang.org"})))
+	assert.Equal(t, []string{c1, c2}, codes(st.SearchURLs(URLFilter{Owner: "u1"})))
+	assert.Len(t, st.SearchURLs(URLFilter{Owner: "u2", AllDomains: true}), 2)
+	assert.Len(t, st.SearchURLs(URLFilter{AllDomains: true, Limit: 3}), 3)
+
+	require.True(t, st.SetURLDisabledContext(ctx, "", c1, true, "phishing"))
+	found := st.SearchURLs(URLFilter{Code: c1})
+	require.Len(t, found, 1)
+	assert.True(t, found[0].Disabled)
+	assert.Equal(t, "phishing", found[0].Reason)
+	_, ok, unavailable := st.GetURLContext(ctx, "", c1)
+	assert.True(t, ok)
+	assert.True(t, unavailable)
+	assert.False(t, st.SetURLDisabledContext(ctx, "", "missing", true, "spam"))
+
+	// блокировка восстанавливается из файла
+	require.NoError(t, st.Close(ctx))
+	st = NewStorage(path, "")
+	found = st.SearchURLs(URLFilter{Code: c1})
+	require.Len(t, found, 1)
+	assert.Equal(t, "phishing", found[0].Reason)
+	require.True(t, st.SetURLDisabledContext(ctx, "", c1, false, "ignored"))
+	found = st.SearchURLs(URLFilter{Code: c1})
+	assert.False(t, found[0].Disabled)
+	assert.Empty(t, found[0].Reason)
+
+	assert.Equal(t, []UserCount{{UID: "u1", Count: 2}, {UID: "u2", Count: 2}}, st.UserURLCounts())
+
+	// повторное удаление не меняет счетчик ссылок
+	st.DelUserURLContext(ctx, "", "u1", c2)
+	st.DelUserURLContext(ctx, "", "u1", c2)
+	require.NoError(t, st.Close(ctx))
+	urls, _ := st.Counts()
+	assert.Equal(t, 3, urls)
+	assert.Equal(t, []UserCount{{UID: "u2", Count: 2}, {UID: "u1", Count: 1}}, st.UserURLCounts())
+
+	// после восстановления счетчик совпадает
+	st = NewStorage(path, "")
+	urls, _ = st.Counts()
+	assert.Equal(t, 3, urls)
+}
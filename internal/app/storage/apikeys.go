@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/auth"
+	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// apiKeysFileSuffix - суффикс файла с API ключами рядом с файлом URL.
+const apiKeysFileSuffix = ".apikeys"
+
+// APIKeysReloadInterval - как часто ключи перечитываются при поиске неизвестного ключа,
+// чтобы перебор ключей не приводил к чтению файла или БД на каждый запрос.
+var APIKeysReloadInterval = time.Second
+
+func (h *StorageURL) apiKeysFilePath() string {
+	if h.filePath == "" {
+		return ""
+	}
+	return h.filePath + apiKeysFileSuffix
+}
+
+func (h *StorageURL) putAPIKey(k apikey.Key) {
+	h.apikeys[k.ID] = k
+	h.apikeyHashes[k.Hash] = k.ID
+}
+
+// readAPIKeys читает все API ключи из БД или файла. Возвращает false, если ключи
+// хранятся только в памяти или их не удалось прочитать.
+func (h *StorageURL) readAPIKeys() ([]apikey.Key, bool) {
+	if h.connDB != "" {
+		data, ok := dbh.ReadAPIKeys(h.connDB)
+		if ok {
+			keys := make([]apikey.Key, 0, len(data))
+			for _, v := range data {
+				scopes, err := auth.ParseScopes(v.Scopes)
+				if err != nil {
+					logger.Warn("skip api key", "id", v.ID, "error", err)
+					continue
+				}
+				keys = append(keys, apikey.Key{ID: v.ID, Hash: v.Hash, Name: v.Name, Owner: v.Owner,
+					Scopes: scopes, Created: v.Created, Revoked: v.Revoked})
+			}
+			return keys, true
+		}
+		logger.Error("can not read api keys from db")
+	}
+	path := h.apiKeysFilePath()
+	if path == "" {
+		return nil, false
+	}
+	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		logger.Error("can not open api keys file to read", "path", path, "error", err)
+		return nil, false
+	}
+	defer file.Close()
+	var keys []apikey.Key
+	reader := bufio.NewReader(file)
+	// каждая строка - очередное состояние ключа, последнее состояние побеждает
+	for data, err := reader.ReadBytes('\n'); err == nil; data, err = reader.ReadBytes('\n') {
+		var k apikey.Key
+		if err := json.Unmarshal(data, &k); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys, true
+}
+
+func (h *StorageURL) restoreAPIKeys() {
+	keys, _ := h.readAPIKeys()
+	for _, k := range keys {
+		h.putAPIKey(k)
+	}
+	h.apikeysLoaded = time.Now()
+}
+
+// ReloadAPIKeys перечитывает API ключи из БД или файла. Так работающий сервис узнает о ключах,
+// созданных и отозванных командой shortener apikey: новые ключи находятся автоматически
+// при первом обращении, а отзыв применяется по сигналу SIGHUP.
+func (h *StorageURL) ReloadAPIKeys() {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.reloadAPIKeys()
+}
+
+// reloadAPIKeysOnMiss перечитывает ключи, если с прошлого чтения прошло не меньше
+// APIKeysReloadInterval. Возвращает true, если ключи перечитаны.
+func (h *StorageURL) reloadAPIKeysOnMiss() bool {
+	h.mux.RLock()
+	due := time.Since(h.apikeysLoaded) >= APIKeysReloadInterval
+	h.mux.RUnlock()
+	if !due {
+		return false
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	// ключи могли перечитать, пока ожидали блокировку
+	if time.Since(h.apikeysLoaded) < APIKeysReloadInterval {
+		return true
+	}
+	return h.reloadAPIKeys()
+}
+
+// reloadAPIKeys заменяет ключи в памяти прочитанными. Чтение выполняется под блокировкой,
+// чтобы не потерять ключ, созданный или отозванный в это же время через API сервиса.
+func (h *StorageURL) reloadAPIKeys() bool {
+	h.apikeysLoaded = time.Now()
+	keys, ok := h.readAPIKeys()
+	if !ok {
+		return false
+	}
+	h.apikeys = make(map[string]apikey.Key, len(keys))
+	h.apikeyHashes = make(map[string]string, len(keys))
+	for _, k := range keys {
+		h.putAPIKey(k)
+	}
+	logger.Debug("api keys reloaded", "count", len(h.apikeys))
+	return true
+}
+
+func (h *StorageURL) appendAPIKey(k apikey.Key) bool {
+	path := h.apiKeysFilePath()
+	if path == "" {
+		return true
+	}
+	data, err := json.Marshal(&k)
+	if err != nil {
+		logger.Error("can not marshal api key", "error", err)
+		return false
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		logger.Error("can not open api keys file to write", "path", path, "error", err)
+		return false
+	}
+	defer file.Close()
+	// строка дописывается одной записью в режиме O_APPEND, поэтому записи сервиса
+	// и команды shortener apikey в один файл не перемешиваются
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		logger.Error("can not write api key to file", "path", path, "error", err)
+		return false
+	}
+	return true
+}
+
+// PutAPIKey сохраняет API ключ в хранилище.
+func (h *StorageURL) PutAPIKey(k apikey.Key) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.connDB != "" {
+		scopes := make([]string, 0, len(k.Scopes))
+		for _, s := range k.Scopes {
+			scopes = append(scopes, string(s))
+		}
+		ok := dbh.InsertAPIKey(h.connDB, dbh.APIKeyFromDB{ID: k.ID, Hash: k.Hash, Name: k.Name, Owner: k.Owner,
+			Scopes: strings.Join(scopes, ","), Created: k.Created, Revoked: k.Revoked})
+		if !ok {
+			return false
+		}
+	}
+	if !h.appendAPIKey(k) {
+		return false
+	}
+	h.putAPIKey(k)
+	return true
+}
+
+// GetAPIKey возвращает действующий API ключ по его хешу.
+// Неизвестный ключ ищется повторно после перечитывания ключей, так как он мог быть создан
+// командой shortener apikey, пока сервис работал.
+func (h *StorageURL) GetAPIKey(hash string) (apikey.Key, bool) {
+	k, found := h.lookupAPIKey(hash)
+	if !found && h.reloadAPIKeysOnMiss() {
+		k, found = h.lookupAPIKey(hash)
+	}
+	if !found || k.Revoked {
+		return apikey.Key{}, false
+	}
+	return k, true
+}
+
+func (h *StorageURL) lookupAPIKey(hash string) (apikey.Key, bool) {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	id, ok := h.apikeyHashes[hash]
+	if !ok {
+		return apikey.Key{}, false
+	}
+	return h.apikeys[id], true
+}
+
+// RevokeAPIKey отзывает API ключ.
+func (h *StorageURL) RevokeAPIKey(id string) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	k, ok := h.apikeys[id]
+	if !ok {
+		return false
+	}
+	if k.Revoked {
+		return true
+	}
+	k.Revoked = true
+	if h.connDB != "" && !dbh.RevokeAPIKey(h.connDB, id) {
+		return false
+	}
+	if !h.appendAPIKey(k) {
+		return false
+	}
+	h.putAPIKey(k)
+	return true
+}
+
+// GetAPIKeys возвращает все API ключи без хешей, упорядоченные по времени создания.
+func (h *StorageURL) GetAPIKeys() []apikey.Key {
+	h.mux.RLock()
+	keys := make([]apikey.Key, 0, len(h.apikeys))
+	for _, k := range h.apikeys {
+		k.Hash = ""
+		keys = append(keys, k)
+	}
+	h.mux.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+	return keys
+}
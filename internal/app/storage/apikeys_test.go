@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/auth"
+)
+
+func TestAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	st := NewStorage(path, "")
+
+	plain, k, err := apikey.Generate("ci", "owner-1", []auth.Scope{auth.ScopeShorten})
+	require.NoError(t, err)
+	require.True(t, st.PutAPIKey(k))
+
+	got, ok := st.GetAPIKey(apikey.Hash(plain))
+	require.True(t, ok)
+	assert.Equal(t, "owner-1", got.Owner)
+	assert.Equal(t, []auth.Scope{auth.ScopeShorten}, got.Scopes)
+	_, ok = st.GetAPIKey(apikey.Hash("sk_unknown"))
+	assert.False(t, ok)
+	keys := st.GetAPIKeys()
+	require.Len(t, keys, 1)
+	assert.Empty(t, keys[0].Hash)
+
+	// ключ восстанавливается из файла, как в другом процессе
+	other := NewStorage(path, "")
+	_, ok = other.GetAPIKey(apikey.Hash(plain))
+	require.True(t, ok)
+	require.True(t, other.RevokeAPIKey(k.ID))
+	_, ok = other.GetAPIKey(apikey.Hash(plain))
+	assert.False(t, ok)
+	assert.False(t, other.RevokeAPIKey("missing"))
+
+	// отзыв другим процессом применяется после перечитывания ключей
+	_, ok = st.GetAPIKey(apikey.Hash(plain))
+	assert.True(t, ok)
+	st.ReloadAPIKeys()
+	_, ok = st.GetAPIKey(apikey.Hash(plain))
+	assert.False(t, ok)
+
+	// ключ, созданный другим процессом, находится при первом обращении
+	interval := APIKeysReloadInterval
+	APIKeysReloadInterval = 0
+	defer func() { APIKeysReloadInterval = interval }()
+	plain2, k2, err := apikey.Generate("cli", "owner-2", []auth.Scope{auth.ScopeRead})
+	require.NoError(t, err)
+	require.True(t, other.PutAPIKey(k2))
+	got, ok = st.GetAPIKey(apikey.Hash(plain2))
+	require.True(t, ok)
+	assert.Equal(t, k2.ID, got.ID)
+}
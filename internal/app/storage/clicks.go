@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/metrics"
+)
+
+// ClickFlushInterval - период записи накопленных переходов по ссылкам в БД и файл.
+const ClickFlushInterval = 10 * time.Second
+
+// linkKey идентифицирует ссылку пространством ссылок домена и краткой формой.
+type linkKey struct {
+	ns   string
+	code string
+}
+
+// clickCounter считает переходы по ссылкам отдельно от хранилища URL,
+// чтобы перенаправления не захватывали мьютекс хранилища на запись.
+type clickCounter struct {
+	mux sync.Mutex
+	// total - количество переходов по ссылкам.
+	total map[linkKey]uint64
+	// pending - переходы, еще не записанные в БД и файл.
+	pending map[linkKey]uint64
+}
+
+func newClickCounter() *clickCounter {
+	return &clickCounter{total: make(map[linkKey]uint64), pending: make(map[linkKey]uint64)}
+}
+
+func (c *clickCounter) add(k linkKey) {
+	c.mux.Lock()
+	c.total[k]++
+	c.pending[k]++
+	c.mux.Unlock()
+}
+
+// restore устанавливает восстановленное количество переходов. Количество только растет,
+// поэтому из нескольких записей об одной ссылке побеждает наибольшая.
+func (c *clickCounter) restore(k linkKey, n uint64) {
+	c.mux.Lock()
+	c.total[k] = max(c.total[k], n)
+	c.mux.Unlock()
+}
+
+func (c *clickCounter) get(k linkKey) uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.total[k]
+}
+
+// takePending возвращает незаписанные переходы вместе с итоговым количеством и очищает их.
+func (c *clickCounter) takePending() (map[linkKey]uint64, map[linkKey]uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	pending := c.pending
+	totals := make(map[linkKey]uint64, len(pending))
+	for k := range pending {
+		totals[k] = c.total[k]
+	}
+	c.pending = make(map[linkKey]uint64)
+	return pending, totals
+}
+
+// putBack возвращает незаписанные переходы, чтобы записать их при следующей попытке.
+func (c *clickCounter) putBack(pending map[linkKey]uint64) {
+	c.mux.Lock()
+	for k, n := range pending {
+		c.pending[k] += n
+	}
+	c.mux.Unlock()
+}
+
+// Click засчитывает переход по ссылке code в пространстве ссылок домена domain.
+func (h *StorageURL) Click(domain string, code string) {
+	h.clicks.add(linkKey{ns: domain, code: code})
+}
+
+// Clicks возвращает количество переходов по ссылке code в пространстве ссылок домена domain.
+func (h *StorageURL) Clicks(domain string, code string) uint64 {
+	return h.clicks.get(linkKey{ns: domain, code: code})
+}
+
+// StartClickFlush запускает периодическую запись накопленных переходов в БД и файл.
+// Останавливается в Close, где переходы записываются последний раз.
+func (h *StorageURL) StartClickFlush(interval time.Duration) {
+	if h.filePath == "" && h.connDB == "" {
+		return
+	}
+	h.flushStop = make(chan struct{})
+	h.flushDone = make(chan struct{})
+	go func() {
+		defer close(h.flushDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.FlushClicks(context.Background())
+			case <-h.flushStop:
+				return
+			}
+		}
+	}()
+}
+
+// stopClickFlush останавливает периодическую запись переходов, если она запущена.
+func (h *StorageURL) stopClickFlush() {
+	if h.flushStop == nil {
+		return
+	}
+	close(h.flushStop)
+	<-h.flushDone
+	h.flushStop = nil
+}
+
+// FlushClicks записывает накопленные переходы: в БД прибавляет их к счетчикам, в файл
+// дописывает событие с итоговым количеством переходов. При ошибке записи в БД переходы
+// сохраняются до следующей попытки.
+func (h *StorageURL) FlushClicks(ctx context.Context) bool {
+	pending, totals := h.clicks.takePending()
+	if len(pending) == 0 || (h.filePath == "" && h.connDB == "") {
+		return true
+	}
+	if h.connDB != "" {
+		deltas := make([]dbh.ClickDelta, 0, len(pending))
+		for k, n := range pending {
+			deltas = append(deltas, dbh.ClickDelta{Domain: k.ns, Code: k.code, Count: n})
+		}
+		start := time.Now()
+		ok := dbh.AddClicks(ctx, h.connDB, deltas)
+		metrics.ObserveStorage(metrics.BackendDB, metrics.OpClicks, start, ok)
+		if !ok {
+			h.clicks.putBack(pending)
+			return false
+		}
+	}
+	if h.filePath == "" {
+		return true
+	}
+
+	// событие содержит полное состояние ссылки, поэтому собирается и записывается под одной
+	// блокировкой, чтобы не перезаписать при восстановлении более позднее удаление или блокировку
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	var data []byte
+	for k, n := range totals {
+		entry, ok := h.urls[k.ns][k.code]
+		if !ok {
+			continue
+		}
+		event := entry.event(k.ns)
+		event.Clicks = n
+		line, err := json.Marshal(&event)
+		if err != nil {
+			logger.Error("can not marshal event", "error", err)
+			continue
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if len(data) == 0 {
+		return true
+	}
+	return h.writeFile(ctx, data, metrics.OpClicks)
+}
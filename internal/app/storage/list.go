@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/metrics"
+	"github.com/jon69/shorturl/internal/app/tracing"
+)
+
+// Порядок выдачи ссылок пользователя.
+const (
+	// SortCreated - по времени создания.
+	SortCreated = "created"
+	// SortClicks - по количеству переходов.
+	SortClicks = "clicks"
+)
+
+// ErrInvalidCursor - курсор поврежден или получен при другом порядке выдачи.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// URLQuery задает страницу ссылок пользователя.
+type URLQuery struct {
+	// Domain - пространство ссылок домена, учитывается при AllDomains == false.
+	Domain string
+	// AllDomains - выдавать ссылки всех доменов.
+	AllDomains bool
+	// Destination - подстрока исходного URL.
+	Destination string
+	// Tag - тег ссылки, пустой не ограничивает выдачу.
+	Tag string
+	// Sort - порядок выдачи: SortCreated (по умолчанию) или SortClicks.
+	Sort string
+	// Desc - выдавать в порядке убывания.
+	Desc bool
+	// Limit - размер страницы, 0 - без ограничений.
+	Limit int
+	// Cursor - курсор следующей страницы из URLPage.Next, пустой - первая страница.
+	Cursor string
+}
+
+// URLPage - страница ссылок пользователя.
+type URLPage struct {
+	// URLs - ссылки страницы.
+	URLs []MyURLS
+	// Total - количество ссылок, удовлетворяющих условиям, на всех страницах.
+	Total int
+	// Next - курсор следующей страницы, пустой на последней странице.
+	Next string
+}
+
+// position - позиция ссылки в упорядоченной выдаче.
+type position struct {
+	clicks uint64
+	id     int64
+}
+
+// encodeCursor кодирует позицию ссылки вместе с порядком выдачи, для которого она получена.
+func encodeCursor(sortBy string, p position) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d:%d", sortBy, p.clicks, p.id)))
+}
+
+func decodeCursor(sortBy string, cursor string) (*position, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(data), ":")
+	if len(parts) != 3 || parts[0] != sortBy {
+		return nil, ErrInvalidCursor
+	}
+	var p position
+	if p.clicks, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if p.id, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &p, nil
+}
+
+// less сравнивает позиции в порядке выдачи.
+func (q URLQuery) less(a position, b position) bool {
+	if q.Sort == SortClicks && a.clicks != b.clicks {
+		return (a.clicks < b.clicks) != q.Desc
+	}
+	return (a.id < b.id) != q.Desc
+}
+
+// ListUserURLs возвращает страницу ссылок пользователя uid, краткие ссылки строятся функцией shortURL.
+// Если подключена БД, выборка, упорядочивание и разбиение на страницы выполняются в ней;
+// количество переходов в БД обновляется с периодом ClickFlushInterval.
+func (h *StorageURL) ListUserURLs(ctx context.Context, uid string, q URLQuery, shortURL ShortURLFunc) (URLPage, error) {
+	ctx, span := tracing.Start(ctx, "storage.ListUserURLs")
+	defer span.End()
+	if q.Sort == "" {
+		q.Sort = SortCreated
+	}
+	if q.Sort != SortCreated && q.Sort != SortClicks {
+		return URLPage{}, fmt.Errorf("unknown sort %q, expected %s or %s", q.Sort, SortCreated, SortClicks)
+	}
+	after, err := decodeCursor(q.Sort, q.Cursor)
+	if err != nil {
+		return URLPage{}, err
+	}
+	if h.connDB != "" {
+		return h.listUserURLsDB(ctx, uid, q, after, shortURL)
+	}
+
+	type item struct {
+		pos position
+		url MyURLS
+	}
+	var found []item
+	start := time.Now()
+	h.mux.RLock()
+	for ns, nsURLS := range h.urls {
+		if !q.AllDomains && ns != q.Domain {
+			continue
+		}
+		for key, element := range nsURLS {
+			if element.uid != uid || (q.Destination != "" && !strings.Contains(element.value, q.Destination)) {
+				continue
+			}
+			if q.Tag != "" && !element.meta.HasTag(q.Tag) {
+				continue
+			}
+			clicks := h.clicks.get(linkKey{ns: ns, code: key})
+			found = append(found, item{pos: position{clicks: clicks, id: int64(element.uidI)},
+				url: MyURLS{ShortURL: shortURL(ns, key), OriginalURL: element.value, Clicks: clicks, Deleted: element.deleted,
+					Domain: ns, Code: key, Meta: element.meta}})
+		}
+	}
+	h.mux.RUnlock()
+	metrics.ObserveStorage(metrics.BackendMemory, metrics.OpList, start, true)
+
+	sort.Slice(found, func(i, j int) bool { return q.less(found[i].pos, found[j].pos) })
+	page := URLPage{Total: len(found), URLs: []MyURLS{}}
+	i := 0
+	if after != nil {
+		i = sort.Search(len(found), func(i int) bool { return q.less(*after, found[i].pos) })
+	}
+	for ; i < len(found); i++ {
+		if q.Limit > 0 && len(page.URLs) == q.Limit {
+			page.Next = encodeCursor(q.Sort, found[i-1].pos)
+			break
+		}
+		page.URLs = append(page.URLs, found[i].url)
+	}
+	return page, nil
+}
+
+// EachUserURLPage обходит все ссылки пользователя uid, удовлетворяющие q, и вызывает fn для страниц
+// размером pageSize; q.Limit и q.Cursor не учитываются, fn вызывается хотя бы один раз.
+// Ссылки в памяти отбираются и упорядочиваются один раз, в БД запрашиваются постранично.
+// Обход прекращается на первой ошибке fn, она и возвращается.
+func (h *StorageURL) EachUserURLPage(ctx context.Context, uid string, q URLQuery, pageSize int, shortURL ShortURLFunc, fn func(URLPage) error) error {
+	q.Cursor = ""
+	if h.connDB != "" {
+		q.Limit = pageSize
+		for {
+			page, err := h.ListUserURLs(ctx, uid, q, shortURL)
+			if err != nil {
+				return err
+			}
+			if err := fn(page); err != nil {
+				return err
+			}
+			if page.Next == "" {
+				return nil
+			}
+			q.Cursor = page.Next
+		}
+	}
+
+	q.Limit = 0
+	all, err := h.ListUserURLs(ctx, uid, q, shortURL)
+	if err != nil {
+		return err
+	}
+	for start := 0; ; start += pageSize {
+		end := start + pageSize
+		if end > len(all.URLs) {
+			end = len(all.URLs)
+		}
+		if err := fn(URLPage{URLs: all.URLs[start:end], Total: all.Total}); err != nil {
+			return err
+		}
+		if end == len(all.URLs) {
+			return nil
+		}
+	}
+}
+
+// listUserURLsDB выбирает страницу ссылок пользователя в БД. Запрашивается на одну запись больше
+// размера страницы, чтобы узнать, есть ли следующая страница.
+func (h *StorageURL) listUserURLsDB(ctx context.Context, uid string, q URLQuery, after *position, shortURL ShortURLFunc) (URLPage, error) {
+	dq := dbh.UserURLQuery{Owner: uid, Domain: q.Domain, AllDomains: q.AllDomains, Destination: q.Destination, Tag: q.Tag,
+		ByClicks: q.Sort == SortClicks, Desc: q.Desc}
+	if q.Limit > 0 {
+		dq.Limit = q.Limit + 1
+	}
+	if after != nil {
+		dq.After = &dbh.UserURLPosition{Clicks: after.clicks, ID: after.id}
+	}
+	start := time.Now()
+	rows, total, err := dbh.ListUserURLs(ctx, h.connDB, dq)
+	metrics.ObserveStorage(metrics.BackendDB, metrics.OpList, start, err == nil)
+	if err != nil {
+		return URLPage{}, err
+	}
+	page := URLPage{Total: total, URLs: []MyURLS{}}
+	for i, row := range rows {
+		if q.Limit > 0 && i == q.Limit {
+			prev := rows[i-1]
+			page.Next = encodeCursor(q.Sort, position{clicks: prev.Clicks, id: prev.ID})
+			break
+		}
+		page.URLs = append(page.URLs, MyURLS{ShortURL: shortURL(row.Domain, row.Code), OriginalURL: row.OriginalURL,
+			Clicks: row.Clicks, Deleted: row.Deleted, Domain: row.Domain, Code: row.Code,
+			Meta: Meta{Title: row.Title, Note: row.Note, Tags: row.Tags}})
+	}
+	return page, nil
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/metrics"
+	"github.com/jon69/shorturl/internal/app/tracing"
+)
+
+// Ограничения описания ссылки.
+const (
+	// MaxTitleLength - наибольшая длина заголовка в символах.
+	MaxTitleLength = 512
+	// MaxNoteLength - наибольшая длина заметки в символах.
+	MaxNoteLength = 4096
+	// MaxTags - наибольшее количество тегов.
+	MaxTags = 20
+	// MaxTagLength - наибольшая длина тега в символах.
+	MaxTagLength = 64
+)
+
+// ErrInvalidMeta - описание ссылки не соответствует ограничениям.
+var ErrInvalidMeta = errors.New("invalid link metadata")
+
+// Meta - описание ссылки, задаваемое пользователем.
+type Meta struct {
+	// Title - заголовок, если не задан, заполняется заголовком страницы исходного URL.
+	Title string `json:"title,omitempty"`
+	// Note - произвольная заметка.
+	Note string `json:"note,omitempty"`
+	// Tags - теги в нижнем регистре без повторов, упорядоченные по алфавиту.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// NormalizeMeta убирает пробелы по краям значений, приводит теги к нижнему регистру,
+// удаляет пустые и повторяющиеся теги и проверяет ограничения длины.
+func NormalizeMeta(m Meta) (Meta, error) {
+	m.Title = strings.TrimSpace(m.Title)
+	m.Note = strings.TrimSpace(m.Note)
+	if utf8.RuneCountInString(m.Title) > MaxTitleLength {
+		return m, fmt.Errorf("%w: title longer than %d", ErrInvalidMeta, MaxTitleLength)
+	}
+	if utf8.RuneCountInString(m.Note) > MaxNoteLength {
+		return m, fmt.Errorf("%w: note longer than %d", ErrInvalidMeta, MaxNoteLength)
+	}
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range m.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return m, fmt.Errorf("%w: tag longer than %d", ErrInvalidMeta, MaxTagLength)
+		}
+		if strings.Contains(tag, ",") {
+			return m, fmt.Errorf("%w: tag %q contains a comma", ErrInvalidMeta, tag)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > MaxTags {
+		return m, fmt.Errorf("%w: more than %d tags", ErrInvalidMeta, MaxTags)
+	}
+	sort.Strings(tags)
+	m.Tags = tags
+	return m, nil
+}
+
+// HasTag проверяет, отмечена ли ссылка тегом tag.
+func (m Meta) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// dbMeta преобразует описание для записи в БД.
+func (m Meta) dbMeta() dbh.LinkMeta {
+	return dbh.LinkMeta{Title: m.Title, Note: m.Note, Tags: m.Tags}
+}
+
+func (h *StorageURL) setMeta(ns string, key string, meta Meta) {
+	entry, ok := h.urls[ns][key]
+	if !ok {
+		return
+	}
+	entry.meta = meta
+	h.urls[ns][key] = entry
+}
+
+// saveMeta записывает описание ссылки в БД и файл и затем в память. Вызывается под блокировкой.
+func (h *StorageURL) saveMeta(ctx context.Context, ns string, code string, entry MyDelPair, meta Meta) bool {
+	if h.connDB != "" {
+		start := time.Now()
+		ok := dbh.UpdateMeta(ctx, h.connDB, ns, code, meta.dbMeta())
+		metrics.ObserveStorage(metrics.BackendDB, metrics.OpMeta, start, ok)
+		if !ok {
+			return false
+		}
+	}
+	entry.meta = meta
+	if !h.appendEvent(ctx, entry.event(ns), metrics.OpMeta) {
+		return false
+	}
+	h.setMeta(ns, code, meta)
+	return true
+}
+
+// SetURLMetaContext заменяет описание ссылки в пространстве ссылок домена domain.
+// Описание должно быть предварительно приведено NormalizeMeta.
+// Возвращает false, если ссылка не найдена или изменение не удалось сохранить.
+func (h *StorageURL) SetURLMetaContext(ctx context.Context, domain string, code string, meta Meta) bool {
+	ctx, span := tracing.Start(ctx, "storage.SetURLMeta")
+	defer span.End()
+	h.lock(ctx)
+	defer h.mux.Unlock()
+
+	entry, ok := h.urls[domain][code]
+	if !ok {
+		logger.Warn("can not change link metadata: not found", "domain", domain, "code", code)
+		return false
+	}
+	return h.saveMeta(ctx, domain, code, entry, meta)
+}
+
+// FillURLTitle устанавливает заголовок ссылки, только если он еще не задан и ссылка не удалена.
+// Возвращает true, если заголовок установлен.
+func (h *StorageURL) FillURLTitle(ctx context.Context, domain string, code string, title string) bool {
+	ctx, span := tracing.Start(ctx, "storage.FillURLTitle")
+	defer span.End()
+	h.lock(ctx)
+	defer h.mux.Unlock()
+
+	entry, ok := h.urls[domain][code]
+	if !ok || entry.deleted || entry.meta.Title != "" || title == "" {
+		return false
+	}
+	meta := entry.meta
+	meta.Title = title
+	return h.saveMeta(ctx, domain, code, entry, meta)
+}
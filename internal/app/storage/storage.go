@@ -3,14 +3,24 @@ package storage
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/jon69/shorturl/internal/app/apikey"
+	"github.com/jon69/shorturl/internal/app/audit"
 	dbh "github.com/jon69/shorturl/internal/app/db"
+	"github.com/jon69/shorturl/internal/app/domains"
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/metrics"
+	"github.com/jon69/shorturl/internal/app/tracing"
 )
 
 // MyDelPair храние информацию о URL для удаления.
@@ -23,11 +33,29 @@ type MyDelPair struct {
 	deleted bool
 	// uid - идентификатор.
 	uidI uint64
+	// disabled - признак блокировки администратором.
+	disabled bool
+	// reason - причина блокировки.
+	reason string
+	// meta - описание ссылки.
+	meta Meta
+}
+
+// admin возвращает состояние ссылки code из пространства ссылок ns для администратора.
+func (e MyDelPair) admin(ns string, code string) AdminURL {
+	return AdminURL{Code: code, Domain: ns, OriginalURL: e.value, Owner: e.uid,
+		Deleted: e.deleted, Disabled: e.disabled, Reason: e.reason, Meta: e.meta}
+}
+
+// event возвращает событие с полным состоянием ссылки в пространстве ссылок ns.
+func (e MyDelPair) event(ns string) EventDel {
+	return EventDel{User: legacyUser, Domain: ns, Key: e.uidI, Value: e.value, UID: e.uid, DEL: e.deleted,
+		Disabled: e.disabled, Reason: e.reason, Title: e.meta.Title, Note: e.meta.Note, Tags: e.meta.Tags}
 }
 
 // StorageURL хранилище URL.
 type StorageURL struct {
-	// urls - множество URL.
+	// urls - множество URL по пространствам ссылок доменов и кратким формам.
 	urls map[string]map[string]MyDelPair
 	// mux - мьютекс для синхронизации.
 	mux *sync.RWMutex
@@ -44,8 +72,37 @@ type StorageURL struct {
 	users map[string]bool
 	// countURLS - количество сокращенных ссылок в сервисе
 	countURLS int
+
+	// apikeys - API ключи по идентификаторам
+	apikeys map[string]apikey.Key
+	// apikeyHashes - идентификаторы API ключей по хешам
+	apikeyHashes map[string]string
+	// apikeysLoaded - время последнего чтения API ключей из БД или файла
+	apikeysLoaded time.Time
+
+	// pendingDeletes - количество ожидающих выполнения удалений
+	pendingDeletes int64
+	// deletes - фоновые удаления, которые нужно дождаться при закрытии хранилища
+	deletes sync.WaitGroup
+	// deleteProgress - время (в наносекундах) последнего завершенного удаления или
+	// появления удалений в пустой очереди
+	deleteProgress int64
+	// restoreErr - ошибка восстановления URL при запуске
+	restoreErr error
+
+	// clicks - счетчики переходов по ссылкам
+	clicks *clickCounter
+	// flushStop, flushDone - остановка и завершение периодической записи переходов
+	flushStop chan struct{}
+	flushDone chan struct{}
+
+	// audit - журнал аудита, в который записываются выполненные удаления
+	audit *audit.Logger
 }
 
+// legacyUser - значение поля User событий, оставленное для совместимости файла хранилища.
+const legacyUser = "1"
+
 // NewStorage создает новое хранилище.
 func NewStorage(filePath string, conndb string) *StorageURL {
 	s := &StorageURL{}
@@ -57,45 +114,48 @@ func NewStorage(filePath string, conndb string) *StorageURL {
 	s.restored = false
 	s.countURLS = 0
 	s.users = make(map[string]bool)
+	s.apikeys = make(map[string]apikey.Key)
+	s.apikeyHashes = make(map[string]string)
+	s.clicks = newClickCounter()
 	if conndb != "" {
 		dbh.CreateIfNotExist(conndb)
 	}
 	s.restoreFromDB()
 	s.restoreFromFile()
+	s.restoreAPIKeys()
 	return s
 }
 
-func (h *StorageURL) put(user string, key string, v string, u string, del bool, uidi uint64) {
-	_, ok := h.urls[user]
+func (h *StorageURL) put(ns string, key string, v string, u string, del bool, uidi uint64) {
+	_, ok := h.urls[ns]
 	if !ok {
-		h.urls[user] = make(map[string]MyDelPair)
+		h.urls[ns] = make(map[string]MyDelPair)
 	}
 	h.users[u] = true
 
-	_, isExist := h.urls[user][key]
-	if !isExist && !del {
+	prev, isExist := h.urls[ns][key]
+	switch {
+	case (!isExist || prev.deleted) && !del:
 		h.countURLS += 1
+	case isExist && !prev.deleted && del:
+		h.countURLS -= 1
 	}
-	h.urls[user][key] = MyDelPair{value: v, uid: u, deleted: del, uidI: uidi}
+	h.urls[ns][key] = MyDelPair{value: v, uid: u, deleted: del, uidI: uidi}
 }
 
-func (h *StorageURL) del(user string, key string, u string) (bool, string, uint64) {
-	_, ok := h.urls[user]
-	if !ok {
-		return false, "", 0
-	}
-	entry, ok2 := h.urls[user][key]
-	if !ok2 {
-		return false, "", 0
+// del помечает ссылку удаленной. Удалить ссылку может только ее владелец u.
+func (h *StorageURL) del(ns string, key string, u string) bool {
+	entry, ok := h.urls[ns][key]
+	if !ok || entry.deleted || entry.uid != u {
+		return false
 	}
 	entry.deleted = true
 	h.countURLS -= 1
-	h.urls[user][key] = entry
-	return true, entry.value, entry.uidI
+	h.urls[ns][key] = entry
+	return true
 }
 
 func (h *StorageURL) getNewID() uint64 {
-	log.Print(h.counter)
 	for {
 		val := atomic.LoadUint64(&h.counter)
 		if atomic.CompareAndSwapUint64(&h.counter, val, val+1) {
@@ -108,6 +168,8 @@ func (h *StorageURL) getNewID() uint64 {
 type EventDel struct {
 	// User - идентификатор пользователя.
 	User string `json:"user"`
+	// Domain - пространство ссылок домена, пустое у домена по умолчанию.
+	Domain string `json:"domain,omitempty"`
 	// Key - ключ.
 	Key uint64 `json:"key"`
 	// Value - удаляемое значение.
@@ -116,6 +178,23 @@ type EventDel struct {
 	UID string `json:"uid"`
 	// DEL - признак удаления.
 	DEL bool `json:"del"`
+	// Disabled - признак блокировки администратором.
+	Disabled bool `json:"disabled,omitempty"`
+	// Reason - причина блокировки.
+	Reason string `json:"reason,omitempty"`
+	// Clicks - количество переходов по ссылке на момент записи события.
+	Clicks uint64 `json:"clicks,omitempty"`
+	// Title - заголовок ссылки.
+	Title string `json:"title,omitempty"`
+	// Note - заметка к ссылке.
+	Note string `json:"note,omitempty"`
+	// Tags - теги ссылки.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// meta возвращает описание ссылки из события.
+func (e EventDel) meta() Meta {
+	return Meta{Title: e.Title, Note: e.Note, Tags: e.Tags}
 }
 
 func max(value1 uint64, value2 uint64) uint64 {
@@ -131,9 +210,11 @@ func (h *StorageURL) restoreFromDB() {
 	}
 
 	if h.connDB != "" {
-		log.Print("reading urls from db...")
+		logger.Debug("reading urls from db")
 
+		start := time.Now()
 		data, ok := dbh.ReadURLS(h.connDB)
+		metrics.ObserveStorage(metrics.BackendDB, metrics.OpRestore, start, ok)
 		if ok {
 			h.restored = true
 			var maxKey uint64
@@ -142,26 +223,27 @@ func (h *StorageURL) restoreFromDB() {
 				event := EventDel{}
 				err := json.Unmarshal(url.DumpJSONURL, &event)
 				event.DEL = url.Deleted
+				event.Disabled = url.Disabled
+				event.Reason = url.Reason
+				event.Clicks = url.Clicks
+				// описание могло измениться после создания записи
+				event.Title, event.Note, event.Tags = url.Title, url.Note, url.Tags
 				if err == nil {
 					maxKey = max(maxKey, event.Key)
 					keyStr := fmt.Sprint(event.Key)
-					log.Print("user  = " + event.User)
-					log.Print("key   = " + keyStr)
-					log.Print("value = " + event.Value)
-					log.Print("uid   = " + event.UID)
-					delStr := "false"
-					if event.DEL {
-						delStr = "true"
-					}
-					log.Print("del   = " + delStr)
-					h.put(event.User, keyStr, event.Value, event.UID, event.DEL, event.Key)
+					logger.Debug("restored url", "domain", event.Domain, "key", keyStr, "uid", event.UID, "del", event.DEL)
+					h.put(event.Domain, keyStr, event.Value, event.UID, event.DEL, event.Key)
+					h.setDisabled(event.Domain, keyStr, event.Disabled, event.Reason)
+					h.setMeta(event.Domain, keyStr, event.meta())
+					h.clicks.restore(linkKey{ns: event.Domain, code: keyStr}, event.Clicks)
 				} else {
-					log.Println("error unmarshal: " + err.Error())
+					logger.Error("can not unmarshal url from db", "error", err)
 				}
 			}
 			h.counter = max(h.counter, maxKey)
 		} else {
-			log.Println("can restore from db")
+			logger.Error("can not restore urls from db")
+			h.restoreErr = errors.New("can not restore urls from db")
 		}
 	}
 }
@@ -171,11 +253,12 @@ func (h *StorageURL) restoreFromFile() {
 		return
 	}
 	if h.filePath != "" {
-		log.Print("opening file...")
+		start := time.Now()
 		file, err := os.OpenFile(h.filePath, os.O_RDONLY|os.O_CREATE, 0777)
 		if err == nil {
 			defer file.Close()
-			log.Print("readin from file...")
+			defer metrics.ObserveStorage(metrics.BackendFile, metrics.OpRestore, start, true)
+			logger.Debug("reading urls from file", "path", h.filePath)
 			reader := bufio.NewReader(file)
 			var maxKey uint64
 			maxKey = 0
@@ -185,151 +268,188 @@ func (h *StorageURL) restoreFromFile() {
 				if err == nil {
 					maxKey = max(maxKey, event.Key)
 					keyStr := fmt.Sprint(event.Key)
-					log.Print("user  = " + event.User)
-					log.Print("key   = " + keyStr)
-					log.Print("value = " + event.Value)
-					log.Print("uid   = " + event.UID)
-					delStr := "false"
-					if event.DEL {
-						delStr = "true"
-					}
-					log.Print("del   = " + delStr)
-					h.put(event.User, keyStr, event.Value, event.UID, event.DEL, event.Key)
+					logger.Debug("restored url", "domain", event.Domain, "key", keyStr, "uid", event.UID, "del", event.DEL)
+					h.put(event.Domain, keyStr, event.Value, event.UID, event.DEL, event.Key)
+					h.setDisabled(event.Domain, keyStr, event.Disabled, event.Reason)
+					h.setMeta(event.Domain, keyStr, event.meta())
+					h.clicks.restore(linkKey{ns: event.Domain, code: keyStr}, event.Clicks)
 				}
 			}
 			h.counter = max(h.counter, maxKey)
 		} else {
-			log.Print("can not open file to read: " + err.Error())
+			logger.Error("can not open file to read", "path", h.filePath, "error", err)
+			h.restoreErr = err
+			metrics.ObserveStorage(metrics.BackendFile, metrics.OpRestore, start, false)
 		}
 	}
 }
 
-// PutUserURL сохраняет URL в хранилище.
+// PutUserURL сохраняет URL в хранилище на домене по умолчанию.
 func (h *StorageURL) PutUserURL(uid string, value string) (int, string) {
-	user := "1"
-	log.Print("StorageURL.PutURL user=", user)
+	return h.PutUserURLContext(context.Background(), domains.DefaultNamespace, uid, value)
+}
+
+// PutUserURLContext сохраняет URL в пространстве ссылок домена domain, трассируя ожидание
+// блокировки, запись в БД и в файл.
+func (h *StorageURL) PutUserURLContext(ctx context.Context, domain string, uid string, value string) (int, string) {
+	return h.PutUserURLMetaContext(ctx, domain, uid, value, Meta{})
+}
+
+// PutUserURLMetaContext сохраняет URL с описанием meta в пространстве ссылок домена domain.
+// Описание должно быть предварительно приведено NormalizeMeta. Если URL уже сокращен на домене,
+// существующая ссылка и ее описание не меняются.
+func (h *StorageURL) PutUserURLMetaContext(ctx context.Context, domain string, uid string, value string, meta Meta) (int, string) {
+	ctx, span := tracing.Start(ctx, "storage.PutUserURL")
+	defer span.End()
 	key := h.getNewID()
 
 	var data []byte
 	var errMarshal error
 
-	event := EventDel{User: user, Key: key, Value: value, UID: uid, DEL: false}
+	event := EventDel{User: legacyUser, Domain: domain, Key: key, Value: value, UID: uid, DEL: false,
+		Title: meta.Title, Note: meta.Note, Tags: meta.Tags}
 	data, errMarshal = json.Marshal(&event)
 	if errMarshal != nil {
-		log.Print("can not json.marshal")
+		logger.Error("can not marshal event", "error", errMarshal)
 	} else {
 		data = append(data, '\n')
 	}
 
 	strKey := fmt.Sprint(key)
 
-	h.mux.Lock()
+	h.lock(ctx)
 	defer h.mux.Unlock()
 
 	iou := 1
 	if h.connDB != "" && errMarshal == nil {
-		log.Println("inserting into db...")
 		var ok bool
 		var su string
-		ok, iou, su = dbh.InsertURL(h.connDB, data, value, strKey)
+		start := time.Now()
+		ok, iou, su = dbh.InsertURL(ctx, h.connDB, data, domain, uid, value, strKey, meta.dbMeta())
+		metrics.ObserveStorage(metrics.BackendDB, metrics.OpPut, start, ok)
 		if !ok {
-			log.Println("eror insert into db")
+			logger.Error("can not insert url into db")
 		} else {
 			strKey = su
 		}
 	}
 
-	h.put(user, strKey, value, uid, false, key)
+	h.putInserted(domain, strKey, value, uid, key, meta, iou)
 
 	if h.filePath != "" && errMarshal == nil && iou == 1 {
-		log.Print("opening file...")
-		file, err := os.OpenFile(h.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
-		if err == nil {
-			defer file.Close()
-			log.Print("writing to file...")
-			log.Print(data)
-			_, err = file.Write(data)
-			if err != nil {
-				log.Print("can not write to file")
-			}
-		} else {
-			log.Print("can not open file to write: " + err.Error())
-		}
+		h.writeFile(ctx, data, metrics.OpPut)
 	}
 
 	return iou, strKey
 }
 
-// DelUserURL удаляет URL из хранилища.
+// putInserted сохраняет в памяти ссылку после вставки в БД. Если URL уже сокращен на домене
+// (iou != 1), БД возвращает код существующей ссылки, и ссылка в памяти не меняется: иначе
+// повторное сокращение чужого URL передало бы ссылку новому пользователю и сбросило бы ее
+// удаление, блокировку и описание. Вызывается под блокировкой хранилища.
+func (h *StorageURL) putInserted(domain string, strKey string, value string, uid string, key uint64, meta Meta, iou int) {
+	if _, exists := h.urls[domain][strKey]; iou != 1 && exists {
+		return
+	}
+	start := time.Now()
+	h.put(domain, strKey, value, uid, false, key)
+	h.setMeta(domain, strKey, meta)
+	metrics.ObserveStorage(metrics.BackendMemory, metrics.OpPut, start, true)
+}
+
+// DelUserURL удаляет URL из хранилища на домене по умолчанию.
 func (h *StorageURL) DelUserURL(uid string, strKey string) bool {
-	user := "1"
-	log.Print("StorageURL.DelUserURL user=", user)
+	return h.DelUserURLContext(context.Background(), domains.DefaultNamespace, uid, strKey)
+}
 
+// SetAuditLog устанавливает журнал аудита. Удаление записывается в журнал после того,
+// как оно сохранено в БД и файле, поэтому журнал не содержит удалений, которые не состоялись.
+func (h *StorageURL) SetAuditLog(l *audit.Logger) {
+	h.audit = l
+}
+
+// DelUserURLContext удаляет URL из пространства ссылок домена domain в фоне. Спан удаления
+// продолжает трассировку из ctx, но удаление не отменяется вместе с ctx. Удаляется только
+// ссылка, владельцем которой является uid; чужие ссылки удаляет администратор, передавая их владельца.
+// Автор и источник запроса для журнала аудита берутся из ctx.
+func (h *StorageURL) DelUserURLContext(ctx context.Context, domain string, uid string, strKey string) bool {
+	reqCtx := ctx
+	ctx = tracing.Detach(ctx)
+
+	h.deletes.Add(1)
+	if atomic.AddInt64(&h.pendingDeletes, 1) == 1 {
+		atomic.StoreInt64(&h.deleteProgress, time.Now().UnixNano())
+	}
 	go func() {
+		defer func() {
+			atomic.StoreInt64(&h.deleteProgress, time.Now().UnixNano())
+			atomic.AddInt64(&h.pendingDeletes, -1)
+			h.deletes.Done()
+		}()
+		ctx, span := tracing.Start(ctx, "storage.DelUserURL")
+		defer span.End()
 
 		var data []byte
 		var errMarshal error
 
-		h.mux.Lock()
+		h.lock(ctx)
 		defer h.mux.Unlock()
 
-		ok, value, key := h.del(user, strKey, uid)
+		before := h.urls[domain][strKey].admin(domain, strKey)
+		ok := h.del(domain, strKey, uid)
 		if !ok {
-			log.Print("err DelUserURL can not find uid=" + uid + " strKey=" + strKey)
+			logger.Warn("can not delete url: not found, not owned or already deleted", "uid", uid, "domain", domain, "code", strKey)
 			return
 		}
 
-		event := EventDel{User: user, Key: key, Value: value, UID: uid, DEL: true}
+		// событие содержит полное состояние, чтобы при восстановлении не потерять блокировку и описание
+		event := h.urls[domain][strKey].event(domain)
 		data, errMarshal = json.Marshal(&event)
 		if errMarshal != nil {
-			log.Print("can not json.marshal")
+			logger.Error("can not marshal event", "error", errMarshal)
 		} else {
 			data = append(data, '\n')
 		}
 		if h.connDB != "" && errMarshal == nil {
-			log.Println("deleting into db...")
-			ok := dbh.DeleteURL(h.connDB, strKey)
+			start := time.Now()
+			ok := dbh.DeleteURL(ctx, h.connDB, domain, uid, strKey)
+			metrics.ObserveStorage(metrics.BackendDB, metrics.OpDelete, start, ok)
 			if !ok {
-				log.Println("eror delete into db")
+				logger.Error("can not delete url in db", "code", strKey)
 				return
 			}
 		}
-		if h.filePath != "" && errMarshal == nil {
-			log.Print("opening file...")
-			file, err := os.OpenFile(h.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
-			if err == nil {
-				defer file.Close()
-				log.Print("writing to file...")
-				log.Print(data)
-				_, err = file.Write(data)
-				if err != nil {
-					log.Print("can not write to file")
-				}
-			} else {
-				log.Print("can not open file to write: " + err.Error())
-				return
-			}
+		if h.filePath != "" && errMarshal == nil && !h.writeFile(ctx, data, metrics.OpDelete) {
+			return
 		}
+		after := h.urls[domain][strKey].admin(domain, strKey)
+		h.audit.Record(reqCtx, audit.OpDelete, domains.Qualify(domain, strKey), audit.State(before), audit.State(after))
 	}()
 
 	return true
 }
 
-// GetUserURL возвращает URL из хранилища на основе идентификатора.
+// GetUserURL возвращает URL из хранилища на домене по умолчанию на основе идентификатора.
 func (h *StorageURL) GetUserURL(uid string, id string) (string, bool, bool) {
-	user := "1"
-	log.Print("StorageURL.GetURL user=", user)
+	return h.get(domains.DefaultNamespace, id)
+}
+
+// get возвращает URL из пространства ссылок ns, признак наличия и признак недоступности.
+func (h *StorageURL) get(ns string, id string) (string, bool, bool) {
 	var val MyDelPair
 	var ok bool
 	ok = false
 
+	start := time.Now()
 	h.mux.RLock()
-	userURLS, isExist := h.urls[user]
+	userURLS, isExist := h.urls[ns]
 	if isExist {
 		val, ok = userURLS[id]
 	}
 	h.mux.RUnlock()
-	return val.value, ok, val.deleted
+	metrics.ObserveStorage(metrics.BackendMemory, metrics.OpGet, start, true)
+	// заблокированная администратором ссылка недоступна так же, как удаленная
+	return val.value, ok, val.deleted || val.disabled
 }
 
 // MyURLS представляет информацию о URL
@@ -338,23 +458,40 @@ type MyURLS struct {
 	ShortURL string `json:"short_url"`
 	// OriginalURL - исходная длинная форма URL
 	OriginalURL string `json:"original_url"`
+	// Clicks - количество переходов по ссылке
+	Clicks uint64 `json:"clicks"`
+	// Deleted - признак удаления
+	Deleted bool `json:"deleted,omitempty"`
+	// Meta - описание ссылки.
+	Meta
+	// Domain - пространство ссылок домена, заполняется в ListUserURLs
+	Domain string `json:"-"`
+	// Code - краткая форма URL, заполняется в ListUserURLs
+	Code string `json:"-"`
 }
 
-// GetUserURLS возвращает множество URL из хранилища.
+// ShortURLFunc строит краткую ссылку по пространству ссылок домена и краткой форме.
+type ShortURLFunc func(domain string, code string) string
+
+// GetUserURLS возвращает множество URL пользователя со всех доменов, краткие ссылки строятся от url.
 func (h *StorageURL) GetUserURLS(uid string, url string) ([]MyURLS, []byte, bool) {
-	user := "1"
-	log.Print("StorageURL.GetURLS user=", user)
+	return h.GetUserDomainURLS(uid, func(_ string, code string) string { return url + "/" + code })
+}
+
+// GetUserDomainURLS возвращает множество URL пользователя со всех доменов,
+// краткие ссылки строятся функцией shortURL.
+func (h *StorageURL) GetUserDomainURLS(uid string, shortURL ShortURLFunc) ([]MyURLS, []byte, bool) {
 	h.mux.RLock()
 
 	var urls []MyURLS
 	var urlsJSON []byte
 	retOK := true
 
-	userURLS, ok := h.urls[user]
-	if ok {
-		for key, element := range userURLS {
+	for ns, nsURLS := range h.urls {
+		for key, element := range nsURLS {
 			if uid == element.uid {
-				urls = append(urls, MyURLS{ShortURL: url + "/" + key, OriginalURL: element.value})
+				urls = append(urls, MyURLS{ShortURL: shortURL(ns, key), OriginalURL: element.value,
+					Clicks: h.clicks.get(linkKey{ns: ns, code: key}), Deleted: element.deleted})
 			}
 		}
 	}
@@ -365,7 +502,7 @@ func (h *StorageURL) GetUserURLS(uid string, url string) ([]MyURLS, []byte, bool
 		var err error
 		urlsJSON, err = json.Marshal(urls)
 		if err != nil {
-			log.Print("Marshal all urls fail ", err.Error())
+			logger.Error("can not marshal urls", "error", err)
 			retOK = false
 		}
 	}
@@ -387,19 +524,132 @@ func (h *StorageURL) GetStat() ([]byte, bool) {
 	var stat Stat
 	retOK := true
 
-	h.mux.RLock()
-	stat.CountURLS = h.countURLS
-	stat.CountUsers = len(h.users)
-	h.mux.RUnlock()
+	stat.CountURLS, stat.CountUsers = h.Counts()
 
 	statJSON, err := json.Marshal(stat)
 	if err != nil {
-		log.Print("Marshal stat fail ", err.Error())
+		logger.Error("can not marshal stat", "error", err)
 		retOK = false
 	}
 	return statJSON, retOK
 }
 
+// Counts возвращает количество неудаленных ссылок и пользователей сервиса.
+func (h *StorageURL) Counts() (int, int) {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	return h.countURLS, len(h.users)
+}
+
+// DeleteQueueDepth возвращает количество ожидающих выполнения удалений.
+func (h *StorageURL) DeleteQueueDepth() int {
+	return int(atomic.LoadInt64(&h.pendingDeletes))
+}
+
+// RestoreError возвращает ошибку восстановления URL из БД или файла при запуске.
+func (h *StorageURL) RestoreError() error {
+	return h.restoreErr
+}
+
+// PingDB проверяет, что БД отвечает, не дольше срока действия ctx.
+// Если подключение к БД не задано, проверка считается пройденной.
+func (h *StorageURL) PingDB(ctx context.Context) error {
+	if h.connDB == "" {
+		return nil
+	}
+	return dbh.PingContext(ctx, h.connDB)
+}
+
+// CheckFile проверяет, что файл хранилища доступен для записи.
+func (h *StorageURL) CheckFile() error {
+	if h.filePath == "" {
+		return nil
+	}
+	file, err := os.OpenFile(h.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// CheckDeletes проверяет, что фоновые удаления выполняются: если очередь не пуста,
+// то хотя бы одно удаление должно завершиться не позднее stall назад.
+func (h *StorageURL) CheckDeletes(stall time.Duration) error {
+	pending := atomic.LoadInt64(&h.pendingDeletes)
+	if pending == 0 {
+		return nil
+	}
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&h.deleteProgress)))
+	if idle > stall {
+		return fmt.Errorf("%d pending deletes, no progress for %s", pending, idle.Round(time.Second))
+	}
+	return nil
+}
+
+// Close дожидается завершения фоновых удалений, записывает накопленные переходы по ссылкам
+// и сбрасывает файл хранилища на диск. Должен вызываться после остановки приема запросов.
+// Если удаления не завершились до истечения срока ctx, возвращает ошибку с количеством
+// незавершенных удалений.
+func (h *StorageURL) Close(ctx context.Context) error {
+	h.stopClickFlush()
+	done := make(chan struct{})
+	go func() {
+		h.deletes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("%d pending deletes not finished: %w", h.DeleteQueueDepth(), ctx.Err())
+	}
+	if !h.FlushClicks(ctx) {
+		logger.Error("can not save clicks")
+	}
+
+	if h.filePath == "" {
+		return nil
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	file, err := os.OpenFile(h.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// lock захватывает мьютекс хранилища, трассируя время ожидания.
+func (h *StorageURL) lock(ctx context.Context) {
+	_, span := tracing.Start(ctx, "storage.lock")
+	h.mux.Lock()
+	span.End()
+}
+
+// writeFile дописывает в файл хранилища данные операции op.
+func (h *StorageURL) writeFile(ctx context.Context, data []byte, op string) (ok bool) {
+	_, span := tracing.Start(ctx, "file.append", attribute.String("file.path", h.filePath))
+	defer func() { tracing.End(span, ok) }()
+	start := time.Now()
+	file, err := os.OpenFile(h.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		logger.Error("can not open file to write", "path", h.filePath, "error", err)
+		metrics.ObserveStorage(metrics.BackendFile, op, start, false)
+		return false
+	}
+	defer file.Close()
+	if _, err = file.Write(data); err != nil {
+		logger.Error("can not write to file", "path", h.filePath, "error", err)
+		metrics.ObserveStorage(metrics.BackendFile, op, start, false)
+		return false
+	}
+	metrics.ObserveStorage(metrics.BackendFile, op, start, true)
+	return true
+}
+
 // PutURL сохраняет URL в хранилище.
 func (h *StorageURL) PutURL(value string) (int, string) {
 	return h.PutUserURL("1", value)
@@ -410,6 +660,13 @@ func (h *StorageURL) GetURL(id string) (string, bool, bool) {
 	return h.GetUserURL("1", id)
 }
 
+// GetURLContext возвращает URL из пространства ссылок домена domain, трассируя поиск.
+func (h *StorageURL) GetURLContext(ctx context.Context, domain string, id string) (string, bool, bool) {
+	_, span := tracing.Start(ctx, "storage.GetURL")
+	defer span.End()
+	return h.get(domain, id)
+}
+
 // DelURL удаляет URL из хранилища.
 func (h *StorageURL) DelURL(id string) bool {
 	return h.DelUserURL("1", id)
@@ -1,13 +1,19 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/audit"
+	"github.com/jon69/shorturl/internal/app/auth"
 )
 
 func TestNewStorage(t *testing.T) {
@@ -97,6 +103,119 @@ func TestGetURL(t *testing.T) {
 	}
 }
 
+func TestDomainNamespaces(t *testing.T) {
+	st := NewStorage("", "")
+	ctx := context.Background()
+
+	_, code := st.PutUserURLContext(ctx, "", "u1", "http://yandex.ru")
+	iou, other := st.PutUserURLContext(ctx, "sho.rt", "u1", "http://yandex.ru")
+	assert.Equal(t, 1, iou)
+
+	_, ok, _ := st.GetURLContext(ctx, "sho.rt", code)
+	assert.False(t, ok)
+	url, ok, _ := st.GetURLContext(ctx, "sho.rt", other)
+	assert.True(t, ok)
+	assert.Equal(t, "http://yandex.ru", url)
+
+	urls, _, ok := st.GetUserDomainURLS("u1", func(ns string, code string) string { return "http://" + ns + "/" + code })
+	require.True(t, ok)
+	assert.Len(t, urls, 2)
+}
+
+func TestClicks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	st := NewStorage(path, "")
+	_, code := st.PutURL("http://yandex.ru")
+	st.Click("", code)
+	st.Click("", code)
+	assert.Equal(t, uint64(2), st.Clicks("", code))
+	require.True(t, st.FlushClicks(context.Background()))
+	st.Click("", code)
+	require.NoError(t, st.Close(context.Background()))
+
+	// переходы восстанавливаются из файла вместе со ссылками
+	st = NewStorage(path, "")
+	assert.Equal(t, uint64(3), st.Clicks("", code))
+	urls, _, ok := st.GetURLS("http://localhost")
+	require.True(t, ok)
+	require.Len(t, urls, 1)
+	assert.Equal(t, uint64(3), urls[0].Clicks)
+}
+
+func TestListUserURLs(t *testing.T) {
+	st := NewStorage("", "")
+	ctx := context.Background()
+	shortURL := func(ns string, code string) string { return "http://" + ns + "/" + code }
+	for i := 0; i < 5; i++ {
+		st.PutUserURLContext(ctx, "", "u1", fmt.Sprintf("http://example.com/%d", i))
+	}
+	st.PutUserURLContext(ctx, "sho.rt", "u1", "http://other.com")
+	st.PutUserURLContext(ctx, "", "u2", "http://example.com/u2")
+	st.Click("", "2")
+	st.Click("", "2")
+	st.Click("", "4")
+
+	var codes []string
+	q := URLQuery{AllDomains: true, Limit: 2}
+	for {
+		page, err := st.ListUserURLs(ctx, "u1", q, shortURL)
+		require.NoError(t, err)
+		assert.Equal(t, 6, page.Total)
+		for _, u := range page.URLs {
+			codes = append(codes, u.ShortURL)
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	assert.Equal(t, []string{"http:///1", "http:///2", "http:///3", "http:///4", "http:///5", "http://sho.rt/6"}, codes)
+
+	page, err := st.ListUserURLs(ctx, "u1", URLQuery{Destination: "example.com", Sort: SortClicks, Desc: true, Limit: 2}, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 5, page.Total)
+	require.Len(t, page.URLs, 2)
+	assert.Equal(t, uint64(2), page.URLs[0].Clicks)
+	assert.Equal(t, uint64(1), page.URLs[1].Clicks)
+
+	// курсор действует только при том же порядке выдачи
+	_, err = st.ListUserURLs(ctx, "u1", URLQuery{Cursor: page.Next}, shortURL)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestLinkMeta(t *testing.T) {
+	meta, err := NormalizeMeta(Meta{Title: " Go ", Tags: []string{"News", " go ", "news", ""}})
+	require.NoError(t, err)
+	assert.Equal(t, Meta{Title: "Go", Tags: []string{"go", "news"}}, meta)
+	_, err = NormalizeMeta(Meta{Tags: []string{"a,b"}})
+	assert.ErrorIs(t, err, ErrInvalidMeta)
+
+	path := filepath.Join(t.TempDir(), "urls.json")
+	st := NewStorage(path, "")
+	ctx := context.Background()
+	_, tagged := st.PutUserURLMetaContext(ctx, "", "u1", "http://golang.org", meta)
+	_, plain := st.PutUserURLContext(ctx, "", "u1", "http://example.com")
+	assert.True(t, st.FillURLTitle(ctx, "", plain, "Example"))
+	// заданный пользователем заголовок не перезаписывается
+	assert.False(t, st.FillURLTitle(ctx, "", tagged, "The Go Programming Language"))
+	require.True(t, st.SetURLMetaContext(ctx, "", tagged, Meta{Title: "Go", Note: "docs", Tags: []string{"go"}}))
+	require.NoError(t, st.Close(ctx))
+
+	// описание восстанавливается из файла
+	st = NewStorage(path, "")
+	shortURL := func(ns string, code string) string { return code }
+	page, err := st.ListUserURLs(ctx, "u1", URLQuery{AllDomains: true}, shortURL)
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 2)
+	assert.Equal(t, Meta{Title: "Go", Note: "docs", Tags: []string{"go"}}, page.URLs[0].Meta)
+	assert.Equal(t, Meta{Title: "Example"}, page.URLs[1].Meta)
+
+	page, err = st.ListUserURLs(ctx, "u1", URLQuery{AllDomains: true, Tag: "go"}, shortURL)
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, tagged, page.URLs[0].Code)
+}
+
 func BenchmarkGetURL(b *testing.B) {
 	storage := NewStorage("", "")
 	for i := 0; i < b.N; i++ {
@@ -112,3 +231,65 @@ func Example() {
 	url, _, _ := storage.GetURL(id)
 	log.Printf("url = %s", url)
 }
+
+func TestPutInsertedKeepsOwner(t *testing.T) {
+	st := NewStorage("", "")
+	ctx := context.Background()
+	_, code := st.PutUserURLMetaContext(ctx, "", "u1", "http://golang.org", Meta{Title: "Go"})
+	require.True(t, st.SetURLDisabledContext(ctx, "", code, true, "spam"))
+
+	// БД вернула код уже сокращенного URL при вставке другим пользователем
+	st.mux.Lock()
+	st.putInserted("", code, "http://golang.org", "u2", st.getNewID(), Meta{Title: "Other"}, 2)
+	st.mux.Unlock()
+	found := st.SearchURLs(URLFilter{Code: code})
+	require.Len(t, found, 1)
+	assert.Equal(t, "u1", found[0].Owner)
+	assert.True(t, found[0].Disabled)
+	assert.Equal(t, "Go", found[0].Title)
+	urls, _ := st.Counts()
+	assert.Equal(t, 1, urls)
+
+	// ссылка, которой еще нет в памяти, сохраняется
+	st.mux.Lock()
+	st.putInserted("", "42", "http://example.com", "u2", st.getNewID(), Meta{}, 2)
+	st.mux.Unlock()
+	found = st.SearchURLs(URLFilter{Code: "42"})
+	require.Len(t, found, 1)
+	assert.Equal(t, "u2", found[0].Owner)
+}
+
+func TestDeleteAudit(t *testing.T) {
+	dir := t.TempDir()
+	st := NewStorage(filepath.Join(dir, "urls.json"), "")
+	auditLog := audit.NewLogger(audit.Open("", ""))
+	st.SetAuditLog(auditLog)
+	st.PutUserURLContext(context.Background(), "", "owner", "http://a.ru")
+	st.PutUserURLContext(context.Background(), "", "owner", "http://b.ru")
+
+	ctx := audit.WithSource(auth.WithIdentity(context.Background(), auth.Identity{UID: "owner"}), audit.Source{IP: "192.0.2.1", Transport: audit.TransportHTTP})
+	ctx, cancel := context.WithCancel(ctx)
+	require.True(t, st.DelUserURLContext(ctx, "", "owner", "1"))
+	// удаление выполняется в фоне и не отменяется вместе с запросом
+	cancel()
+	st.deletes.Wait()
+
+	records, err := auditLog.Query(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, audit.OpDelete, records[0].Operation)
+	assert.Equal(t, "1", records[0].Code)
+	assert.Equal(t, "owner", records[0].Actor)
+	assert.Equal(t, audit.TransportHTTP, records[0].Transport)
+	assert.Contains(t, records[0].Before, `"deleted":false`)
+	assert.Contains(t, records[0].After, `"deleted":true`)
+
+	// повторное удаление и удаление, которое не удалось сохранить, в журнал не попадают
+	require.True(t, st.DelUserURLContext(ctx, "", "owner", "1"))
+	require.NoError(t, os.RemoveAll(dir))
+	require.True(t, st.DelUserURLContext(ctx, "", "owner", "2"))
+	st.deletes.Wait()
+	records, err = auditLog.Query(audit.Filter{})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
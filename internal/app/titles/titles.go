@@ -0,0 +1,264 @@
+// Модуль titles в фоне заполняет заголовки ссылок заголовками страниц исходных URL.
+package titles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+	"github.com/jon69/shorturl/internal/app/storage"
+)
+
+const (
+	// DefaultTimeout - время ожидания страницы по умолчанию.
+	DefaultTimeout = 10 * time.Second
+	// MaxPageBytes - наибольший считываемый объем страницы, заголовок обычно в самом начале.
+	MaxPageBytes = 1 << 20
+	// QueueSize - размер очереди ссылок, при переполнении новые ссылки пропускаются.
+	QueueSize = 1000
+	// Workers - количество одновременно загружаемых страниц.
+	Workers = 4
+)
+
+var (
+	// ErrNoTitle - страница не содержит заголовка.
+	ErrNoTitle = errors.New("page has no title")
+	// ErrForbiddenAddress - адрес страницы находится в локальной сети.
+	ErrForbiddenAddress = errors.New("address is not public")
+)
+
+// Store - хранилище, в котором заполняются заголовки ссылок.
+type Store interface {
+	// FillURLTitle устанавливает заголовок ссылки, если он еще не задан.
+	FillURLTitle(ctx context.Context, domain string, code string, title string) bool
+}
+
+// NewClient возвращает HTTP клиент с таймаутом timeout, который подключается только к публичным
+// адресам, чтобы через сокращение ссылок нельзя было обращаться к внутренним ресурсам.
+// Адрес проверяется при каждом подключении, в том числе при перенаправлениях.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: func(network string, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !public(ip) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+		}
+		return nil
+	}}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// прокси подключался бы к странице сам, в обход проверки адреса
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// reserved - специальные диапазоны, не покрытые методами net.IP, через которые можно
+// обратиться к внутренней сети или которые не маршрутизируются в интернете.
+var reserved = mustParseCIDRs(
+	"0.0.0.0/8",      // "эта" сеть
+	"100.64.0.0/10",  // CGNAT
+	"192.0.0.0/24",   // служебные адреса IETF
+	"198.18.0.0/15",  // тестирование производительности
+	"240.0.0.0/4",    // зарезервировано, включая широковещательный адрес
+	"64:ff9b::/96",   // NAT64 с встроенным IPv4 адресом
+	"64:ff9b:1::/48", // локальный NAT64
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// public проверяет, что адрес не относится к локальной сети и специальным диапазонам.
+func public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range reserved {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch загружает страницу rawURL клиентом client и возвращает ее заголовок без лишних пробелов,
+// обрезанный до storage.MaxTitleLength символов.
+func Fetch(ctx context.Context, client *http.Client, rawURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q", req.URL.Scheme)
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); contentType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", fmt.Errorf("%w: content type %s", ErrNoTitle, mediaType)
+	}
+	body, err := charset.NewReader(io.LimitReader(resp.Body, MaxPageBytes), contentType)
+	if err != nil {
+		return "", err
+	}
+	return parseTitle(body)
+}
+
+// parseTitle возвращает текст первого элемента title.
+func parseTitle(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+	inTitle := false
+	var b strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return "", ErrNoTitle
+			}
+			return "", z.Err()
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			inTitle = string(name) == "title"
+		case html.TextToken:
+			if inTitle {
+				b.Write(z.Text())
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); inTitle && string(name) == "title" {
+				title := strings.Join(strings.Fields(b.String()), " ")
+				if title == "" {
+					return "", ErrNoTitle
+				}
+				return truncate(title, storage.MaxTitleLength), nil
+			}
+		}
+	}
+}
+
+// truncate обрезает s до n символов.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// job - ссылка, для которой нужно получить заголовок.
+type job struct {
+	domain string
+	code   string
+	url    string
+}
+
+// Fetcher загружает заголовки страниц в фоне и записывает их в хранилище.
+type Fetcher struct {
+	// client - клиент для загрузки страниц.
+	client *http.Client
+	// store - хранилище ссылок.
+	store Store
+	// jobs - очередь ссылок.
+	jobs chan job
+	// ctx отменяется при остановке, прерывая загрузку страниц.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// workers - работающие обработчики очереди.
+	workers sync.WaitGroup
+}
+
+// New создает загрузчик заголовков, использующий клиент client, например из NewClient.
+func New(client *http.Client, store Store) *Fetcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Fetcher{client: client, store: store, jobs: make(chan job, QueueSize), ctx: ctx, cancel: cancel}
+}
+
+// Start запускает workers обработчиков очереди.
+func (f *Fetcher) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		f.workers.Add(1)
+		go func() {
+			defer f.workers.Done()
+			for {
+				select {
+				case j := <-f.jobs:
+					f.fetch(j)
+				case <-f.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (f *Fetcher) fetch(j job) {
+	title, err := Fetch(f.ctx, f.client, j.url)
+	if err != nil {
+		logger.Debug("can not fetch title", "domain", j.domain, "code", j.code, "error", err)
+		return
+	}
+	if f.store.FillURLTitle(f.ctx, j.domain, j.code, title) {
+		logger.Debug("title fetched", "domain", j.domain, "code", j.code, "title", title)
+	}
+}
+
+// Enqueue ставит в очередь получение заголовка страницы url для ссылки code в пространстве
+// ссылок домена domain. Возвращает false, если загрузчик остановлен или очередь переполнена.
+func (f *Fetcher) Enqueue(domain string, code string, url string) bool {
+	if f.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case f.jobs <- job{domain: domain, code: code, url: url}:
+		return true
+	default:
+		logger.Warn("title queue is full, skipping", "domain", domain, "code", code)
+		return false
+	}
+}
+
+// Shutdown останавливает загрузчик: прерывает загрузку страниц и дожидается завершения
+// обработчиков, но не дольше срока действия ctx. Ссылки, оставшиеся в очереди, пропускаются.
+func (f *Fetcher) Shutdown(ctx context.Context) error {
+	f.cancel()
+	done := make(chan struct{})
+	go func() {
+		f.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
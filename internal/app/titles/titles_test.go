@@ -0,0 +1,124 @@
+package titles
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore запоминает установленные заголовки.
+type memoryStore struct {
+	mu     sync.Mutex
+	titles map[string]string
+}
+
+func (s *memoryStore) FillURLTitle(ctx context.Context, domain string, code string, title string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.titles[domain+"/"+code] = title
+	return true
+}
+
+func (s *memoryStore) get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.titles[key]
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=windows-1251")
+			// "Привет" в кодировке windows-1251
+			w.Write([]byte("<html><head><title>\n  \xcf\xf0\xe8\xe2\xe5\xf2,\n  mir </title></head><body><title>x</title></body></html>"))
+		case "/empty":
+			w.Write([]byte("<html><body>no title</body></html>"))
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"title": "x"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	title, err := Fetch(ctx, srv.Client(), srv.URL+"/page")
+	require.NoError(t, err)
+	assert.Equal(t, "Привет, mir", title)
+
+	_, err = Fetch(ctx, srv.Client(), srv.URL+"/empty")
+	assert.ErrorIs(t, err, ErrNoTitle)
+	_, err = Fetch(ctx, srv.Client(), srv.URL+"/json")
+	assert.ErrorIs(t, err, ErrNoTitle)
+	_, err = Fetch(ctx, srv.Client(), srv.URL+"/missing")
+	assert.Error(t, err)
+	_, err = Fetch(ctx, srv.Client(), "ftp://example.com/")
+	assert.Error(t, err)
+
+	// клиент по умолчанию не обращается к адресам локальной сети
+	_, err = Fetch(ctx, NewClient(time.Second), srv.URL+"/page")
+	assert.True(t, errors.Is(err, ErrForbiddenAddress), "got %v", err)
+}
+
+func TestFetcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<title>Example</title>"))
+	}))
+	defer srv.Close()
+
+	store := &memoryStore{titles: map[string]string{}}
+	f := New(srv.Client(), store)
+	f.Start(2)
+	require.True(t, f.Enqueue("sho.rt", "1", srv.URL))
+	assert.Eventually(t, func() bool { return store.get("sho.rt/1") == "Example" }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, f.Shutdown(context.Background()))
+	assert.False(t, f.Enqueue("", "2", srv.URL))
+}
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "::1"},
+		{ip: "10.1.2.3"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"},
+		{ip: "fe80::1"},
+		{ip: "fc00::1"},
+		{ip: "0.0.0.0"},
+		{ip: "0.1.2.3"},
+		{ip: "100.64.0.1"},
+		{ip: "100.127.255.254"},
+		{ip: "100.128.0.1", want: true},
+		{ip: "192.0.0.8"},
+		{ip: "198.18.0.1"},
+		{ip: "198.19.255.254"},
+		{ip: "198.20.0.1", want: true},
+		{ip: "240.0.0.1"},
+		{ip: "255.255.255.255"},
+		{ip: "224.0.0.1"},
+		{ip: "::ffff:127.0.0.1"},
+		{ip: "64:ff9b::7f00:1"},
+		{ip: "64:ff9b::a00:1"},
+		{ip: "64:ff9b:1::1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, public(net.ParseIP(tt.ip)), tt.ip)
+	}
+}
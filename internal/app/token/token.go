@@ -0,0 +1,132 @@
+// Модуль token выпускает и проверяет компактные подписанные токены в формате JWT (HS256).
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Ошибки проверки токена.
+var (
+	// ErrMalformed - токен имеет неверный формат.
+	ErrMalformed = errors.New("token: malformed")
+	// ErrUnknownKey - токен подписан неизвестным ключом.
+	ErrUnknownKey = errors.New("token: unknown key id")
+	// ErrSignature - подпись токена не совпадает.
+	ErrSignature = errors.New("token: invalid signature")
+	// ErrExpired - срок действия токена истек.
+	ErrExpired = errors.New("token: expired")
+)
+
+// algorithm - алгоритм подписи токена.
+const algorithm = "HS256"
+
+// now возвращает текущее время, переопределяется в тестах.
+var now = time.Now
+
+var encoding = base64.RawURLEncoding
+
+// Claims хранит информацию, содержащуюся в токене.
+type Claims struct {
+	// UID - идентификатор пользователя.
+	UID string `json:"uid"`
+	// IssuedAt - время выпуска токена (unix).
+	IssuedAt int64 `json:"iat"`
+	// ExpiresAt - время окончания действия токена (unix).
+	ExpiresAt int64 `json:"exp"`
+	// KeyID - идентификатор ключа подписи, передается в заголовке токена.
+	KeyID string `json:"-"`
+}
+
+// ExpiresWithin проверяет, истекает ли срок действия токена в течение d.
+func (c Claims) ExpiresWithin(d time.Duration) bool {
+	return now().Add(d).Unix() >= c.ExpiresAt
+}
+
+// header заголовок токена.
+type header struct {
+	// Alg - алгоритм подписи.
+	Alg string `json:"alg"`
+	// Typ - тип токена.
+	Typ string `json:"typ"`
+	// Kid - идентификатор ключа подписи.
+	Kid string `json:"kid"`
+}
+
+// KeyFunc возвращает ключ подписи по его идентификатору.
+type KeyFunc func(kid string) ([]byte, bool)
+
+// KeyID вычисляет идентификатор ключа по его содержимому.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// Issue выпускает новый токен для пользователя uid, подписанный ключом key с идентификатором kid.
+func Issue(key []byte, kid string, uid string, ttl time.Duration) string {
+	issued := now()
+	h, _ := json.Marshal(header{Alg: algorithm, Typ: "JWT", Kid: kid})
+	c, _ := json.Marshal(Claims{UID: uid, IssuedAt: issued.Unix(), ExpiresAt: issued.Add(ttl).Unix()})
+
+	signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(c)
+	return signingInput + "." + encoding.EncodeToString(sign(key, signingInput))
+}
+
+// Parse проверяет токен и возвращает содержащуюся в нем информацию.
+// Ключ подписи выбирается функцией keyFunc по идентификатору из заголовка токена.
+func Parse(tok string, keyFunc KeyFunc) (Claims, error) {
+	var c Claims
+
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return c, ErrMalformed
+	}
+
+	hb, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	var h header
+	if err := json.Unmarshal(hb, &h); err != nil || h.Alg != algorithm {
+		return c, ErrMalformed
+	}
+
+	key, ok := keyFunc(h.Kid)
+	if !ok {
+		return c, ErrUnknownKey
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if !hmac.Equal(signature, sign(key, parts[0]+"."+parts[1])) {
+		return c, ErrSignature
+	}
+
+	cb, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if err := json.Unmarshal(cb, &c); err != nil || c.UID == "" {
+		return c, ErrMalformed
+	}
+	c.KeyID = h.Kid
+
+	if now().Unix() >= c.ExpiresAt {
+		return c, ErrExpired
+	}
+	return c, nil
+}
+
+func sign(key []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
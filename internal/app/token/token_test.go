@@ -0,0 +1,46 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueParse(t *testing.T) {
+	key := []byte("secret")
+	kid := KeyID(key)
+	keys := func(id string) ([]byte, bool) {
+		if id == kid {
+			return key, true
+		}
+		return nil, false
+	}
+
+	tok := Issue(key, kid, "user-1", time.Hour)
+	c, err := Parse(tok, keys)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", c.UID)
+	assert.Equal(t, kid, c.KeyID)
+	assert.Equal(t, c.IssuedAt+3600, c.ExpiresAt)
+	assert.False(t, c.ExpiresWithin(time.Minute))
+	assert.True(t, c.ExpiresWithin(2*time.Hour))
+
+	tests := []struct {
+		name string
+		tok  string
+		err  error
+	}{
+		{name: "garbage", tok: "abc", err: ErrMalformed},
+		{name: "legacy cookie", tok: "deadbeef-4f3c5a0e-9f1b-4a7e-8d55-2d7c0c3e9a11", err: ErrMalformed},
+		{name: "tampered", tok: tok[:strings.LastIndex(tok, ".")] + ".AAAA", err: ErrSignature},
+		{name: "unknown key", tok: Issue([]byte("other"), "other", "user-1", time.Hour), err: ErrUnknownKey},
+		{name: "expired", tok: Issue(key, kid, "user-1", -time.Second), err: ErrExpired},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.tok, keys)
+		assert.ErrorIs(t, err, tt.err, tt.name)
+	}
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// MetadataCarrier позволяет передавать контекст трассировки в метаданных gRPC.
+type MetadataCarrier metadata.MD
+
+// Get возвращает первое значение ключа.
+func (c MetadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Set заменяет значение ключа.
+func (c MetadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys возвращает все ключи.
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Inject добавляет в метаданные md контекст трассировки из ctx.
+func Inject(ctx context.Context, md metadata.MD) {
+	otel.GetTextMapPropagator().Inject(ctx, MetadataCarrier(md))
+}
+
+// UnaryServerInterceptor возвращает перехватчик gRPC, который продолжает трассировку
+// из метаданных traceparent и tracestate и создает серверный спан вызова.
+// Должен идти после журнала доступа, чтобы идентификатор трассировки попал в журнал.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, MetadataCarrier(md))
+
+		service, method := splitMethod(info.FullMethod)
+		ctx, span := Tracer().Start(ctx, strings.TrimPrefix(info.FullMethod, "/"),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(method)))
+		defer span.End()
+		if sc := span.SpanContext(); sc.IsValid() {
+			logger.AddFields(ctx, "trace_id", sc.TraceID().String())
+		}
+
+		resp, err := handler(ctx, req)
+		code := status.Code(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+		if err != nil {
+			span.SetStatus(codes.Error, code.String())
+		}
+		return resp, err
+	}
+}
+
+// splitMethod разбирает полное имя метода вида "/пакет.Сервис/Метод".
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "", service
+	}
+	return service, method
+}
@@ -0,0 +1,113 @@
+// Модуль tracing настраивает трассировку OpenTelemetry: экспорт спанов по OTLP или в stdout
+// и передачу контекста трассировки в формате W3C Trace Context.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Способы экспорта спанов.
+const (
+	// ExporterNone - спаны не экспортируются, контекст трассировки только передается дальше.
+	ExporterNone = "none"
+	// ExporterOTLP - экспорт по OTLP/gRPC в коллектор.
+	ExporterOTLP = "otlp"
+	// ExporterStdout - вывод спанов в stdout, например для тестов.
+	ExporterStdout = "stdout"
+)
+
+// ServiceName - имя сервиса в спанах.
+const ServiceName = "shortener"
+
+// instrumentationName - имя библиотеки инструментирования.
+const instrumentationName = "github.com/jon69/shorturl"
+
+// ShutdownFunc выгружает накопленные спаны и останавливает экспорт.
+type ShutdownFunc func(ctx context.Context) error
+
+// ParseExporter проверяет способ экспорта спанов. Пустая строка означает ExporterNone.
+func ParseExporter(str string) (string, error) {
+	switch e := strings.ToLower(strings.TrimSpace(str)); e {
+	case "", ExporterNone:
+		return ExporterNone, nil
+	case ExporterOTLP, ExporterStdout:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown trace exporter %q", str)
+}
+
+// Setup устанавливает глобальные провайдер трассировки и формат передачи контекста.
+// endpoint - адрес коллектора (хост:порт) для ExporterOTLP, по умолчанию localhost:4317.
+func Setup(ctx context.Context, exporter string, endpoint string, version string) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithInsecure()}
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		exp, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(ServiceName), semconv.ServiceVersion(version)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer возвращает трассировщик сервиса.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start начинает внутренний спан name, дочерний к спану из ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End завершает спан, отмечая его ошибочным, если операция не удалась.
+func End(span trace.Span, ok bool) {
+	if !ok {
+		span.SetStatus(codes.Error, "operation failed")
+	}
+	span.End()
+}
+
+// Detach возвращает контекст без отмены и срока действия, но с текущим спаном из ctx,
+// для фоновой работы, которая продолжается после ответа клиенту.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
@@ -0,0 +1,249 @@
+// Веб-интерфейс сервиса: сокращение ссылок и управление ссылками пользователя через HTTP API.
+// Пользователь определяется кукой, которую сервис выдает при загрузке страницы.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+// csrfToken возвращает CSRF токен из куки для заголовка X-CSRF-Token.
+function csrfToken() {
+  const m = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+  return m ? decodeURIComponent(m[1]) : "";
+}
+
+async function api(method, path, body) {
+  const headers = { "X-CSRF-Token": csrfToken() };
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+  }
+  return fetch(path, {
+    method,
+    headers,
+    credentials: "same-origin",
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+}
+
+function showError(text) {
+  $("error").textContent = text;
+  $("error").hidden = !text;
+}
+
+function showResult(shortURL) {
+  $("result-link").textContent = shortURL;
+  $("result-link").href = shortURL;
+  $("result").querySelector(".copy").dataset.copy = shortURL;
+  $("result").hidden = false;
+}
+
+// parseShort разбирает краткую ссылку на домен и краткую форму.
+function parseShort(shortURL) {
+  const u = new URL(shortURL);
+  return { domain: u.hostname, code: u.pathname.replace(/^\//, "") };
+}
+
+function button(label, onClick) {
+  const b = document.createElement("button");
+  b.type = "button";
+  b.textContent = label;
+  b.addEventListener("click", onClick);
+  return b;
+}
+
+async function copy(text, b) {
+  try {
+    await navigator.clipboard.writeText(text);
+    b.textContent = "Copied";
+    setTimeout(() => { b.textContent = "Copy"; }, 1500);
+  } catch (e) {
+    window.prompt("Copy the link", text);
+  }
+}
+
+function showQR(link) {
+  const { domain, code } = parseShort(link.short_url);
+  $("qr-image").src = "/api/qr/" + encodeURIComponent(code) + "?domain=" + encodeURIComponent(domain);
+  $("qr-link").textContent = link.short_url;
+  $("qr").showModal();
+}
+
+async function remove(link, row) {
+  if (!window.confirm("Delete " + link.short_url + "?")) {
+    return;
+  }
+  const { domain, code } = parseShort(link.short_url);
+  const resp = await api("DELETE", "/api/user/urls?domain=" + encodeURIComponent(domain), [code]);
+  if (resp.status !== 202) {
+    showError("Can not delete link: " + (await resp.text()));
+    return;
+  }
+  // удаление выполняется в фоне, строка отмечается удаленной сразу
+  row.classList.add("deleted");
+  row.querySelector(".actions").replaceChildren();
+}
+
+// splitTags разбирает теги, перечисленные через запятую.
+function splitTags(text) {
+  return text.split(",").map((t) => t.trim()).filter((t) => t);
+}
+
+function filterByTag(tag) {
+  $("tag").value = tag;
+  loadLinks(false);
+}
+
+// editMeta запрашивает новый заголовок и теги ссылки и сохраняет их.
+async function editMeta(link, row) {
+  const title = window.prompt("Title", link.title || "");
+  if (title === null) {
+    return;
+  }
+  const tags = window.prompt("Tags, comma separated", (link.tags || []).join(", "));
+  if (tags === null) {
+    return;
+  }
+  const { domain, code } = parseShort(link.short_url);
+  const resp = await api("PATCH", "/api/user/urls/" + encodeURIComponent(code) + "?domain=" + encodeURIComponent(domain),
+    { title, tags: splitTags(tags) });
+  if (resp.status !== 200) {
+    showError("Can not edit link: " + (await resp.text()));
+    return;
+  }
+  row.replaceWith(renderRow(await resp.json()));
+}
+
+function renderRow(link) {
+  const row = document.createElement("tr");
+  if (link.deleted) {
+    row.classList.add("deleted");
+  }
+
+  const short = document.createElement("td");
+  const a = document.createElement("a");
+  a.href = link.short_url;
+  a.textContent = link.short_url;
+  a.target = "_blank";
+  a.rel = "noopener";
+  short.append(a);
+
+  const dest = document.createElement("td");
+  dest.className = "dest";
+  if (link.title) {
+    const title = document.createElement("div");
+    title.className = "title";
+    title.textContent = link.title;
+    dest.append(title);
+  }
+  const url = document.createElement("div");
+  url.textContent = link.original_url;
+  url.title = link.original_url;
+  dest.append(url);
+  for (const tag of link.tags || []) {
+    const t = button(tag, () => filterByTag(tag));
+    t.className = "tag";
+    dest.append(t);
+  }
+
+  const clicks = document.createElement("td");
+  clicks.className = "num";
+  clicks.textContent = String(link.clicks || 0);
+
+  const actions = document.createElement("td");
+  actions.className = "actions";
+  if (!link.deleted) {
+    const c = button("Copy", () => copy(link.short_url, c));
+    actions.append(c, button("QR", () => showQR(link)), button("Edit", () => editMeta(link, row)),
+      button("Delete", () => remove(link, row)));
+  }
+
+  row.append(short, dest, clicks, actions);
+  return row;
+}
+
+// PAGE_SIZE - количество ссылок, загружаемых за один запрос.
+const PAGE_SIZE = 50;
+
+// nextCursor - курсор следующей страницы ссылок, пустой если страниц больше нет.
+let nextCursor = "";
+
+// loadLinks загружает первую страницу ссылок или, если more, следующую страницу.
+async function loadLinks(more) {
+  const [sort, order] = $("sort").value.split(":");
+  const params = new URLSearchParams({ limit: String(PAGE_SIZE), sort, order });
+  const dest = $("dest").value.trim();
+  if (dest) {
+    params.set("dest", dest);
+  }
+  const tag = $("tag").value.trim();
+  if (tag) {
+    params.set("tag", tag);
+  }
+  if (more && nextCursor) {
+    params.set("cursor", nextCursor);
+  }
+  const resp = await api("GET", "/api/user/urls?" + params.toString());
+  let links = [];
+  if (resp.status === 200) {
+    links = await resp.json();
+  } else if (resp.status !== 204) {
+    showError("Can not load links: " + (await resp.text()));
+    return;
+  }
+  nextCursor = resp.headers.get("X-Next-Cursor") || "";
+  const total = Number(resp.headers.get("X-Total-Count") || 0);
+  const body = $("links").querySelector("tbody");
+  if (more) {
+    body.append(...links.map(renderRow));
+  } else {
+    body.replaceChildren(...links.map(renderRow));
+  }
+  $("total").textContent = total ? "(" + total + ")" : "";
+  $("links").hidden = total === 0;
+  $("empty").hidden = total !== 0;
+  $("more").hidden = !nextCursor;
+}
+
+async function shorten(event) {
+  event.preventDefault();
+  showError("");
+  const req = { url: $("url").value.trim() };
+  const domain = $("domain").value.trim();
+  if (domain) {
+    req.domain = domain;
+  }
+  const tags = splitTags($("tags").value);
+  if (tags.length) {
+    req.tags = tags;
+  }
+  const resp = await api("POST", "/api/shorten", req);
+  if (resp.status !== 201 && resp.status !== 409) {
+    showError("Can not shorten link: " + (await resp.text()));
+    return;
+  }
+  const data = await resp.json();
+  showResult(data.result);
+  $("url").value = "";
+  $("tags").value = "";
+  loadLinks(false);
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  $("shorten").addEventListener("submit", shorten);
+  const resultCopy = $("result").querySelector(".copy");
+  resultCopy.addEventListener("click", () => copy(resultCopy.dataset.copy, resultCopy));
+  // после отправки формы без JavaScript сервер возвращает созданную ссылку в параметре created
+  const created = new URLSearchParams(window.location.search).get("created");
+  if (created) {
+    showResult(created);
+  }
+  let filterTimer;
+  $("filter").addEventListener("submit", (event) => event.preventDefault());
+  for (const id of ["dest", "tag"]) {
+    $(id).addEventListener("input", () => {
+      clearTimeout(filterTimer);
+      filterTimer = setTimeout(() => loadLinks(false), 300);
+    });
+  }
+  $("sort").addEventListener("change", () => loadLinks(false));
+  $("more").addEventListener("click", () => loadLinks(true));
+  loadLinks(false);
+});
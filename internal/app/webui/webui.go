@@ -0,0 +1,89 @@
+// Модуль webui содержит встроенный в сервис веб-интерфейс для браузеров: сокращение ссылок
+// и управление ссылками пользователя через HTTP API сервиса.
+package webui
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jon69/shorturl/internal/app/cookie"
+	"github.com/jon69/shorturl/internal/app/logger"
+)
+
+// AssetsPrefix - путь, по которому отдаются статические файлы интерфейса.
+const AssetsPrefix = "/ui/"
+
+//go:embed static
+var static embed.FS
+
+// assets - статические файлы интерфейса без префикса каталога static.
+var assets = mustSub(static, "static")
+
+// index - шаблон главной страницы, в форму которой встраивается CSRF токен
+// для отправки без JavaScript.
+var index = template.Must(template.ParseFS(assets, "index.html"))
+
+// indexData - данные шаблона главной страницы.
+type indexData struct {
+	CSRFToken string
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// ServeIndex отдает главную страницу интерфейса.
+func ServeIndex(w http.ResponseWriter, r *http.Request) {
+	var page bytes.Buffer
+	if err := index.Execute(&page, indexData{CSRFToken: cookie.CSRFToken(r)}); err != nil {
+		logger.Error("failed to render ui page", "error", err)
+		http.Error(w, "ui is not available", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// страница ссылается на файлы интерфейса и содержит токен клиента, поэтому не кэшируется
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page.Bytes())
+}
+
+// Assets возвращает обработчик статических файлов интерфейса по пути AssetsPrefix.
+func Assets() http.Handler {
+	return http.StripPrefix(AssetsPrefix, http.FileServer(http.FS(assets)))
+}
+
+// WantsHTML проверяет, ожидает ли клиент в ответ HTML страницу, как браузер при отправке формы.
+// Клиенты вроде curl передают Accept: */* и получают ответ в прежнем формате.
+func WantsHTML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "text/html") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseForm возвращает URL и домен из полей url и domain тела формы application/x-www-form-urlencoded.
+func ParseForm(body []byte) (string, string) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", ""
+	}
+	return strings.TrimSpace(values.Get("url")), strings.TrimSpace(values.Get("domain"))
+}
+
+// Created перенаправляет браузер после отправки формы на главную страницу,
+// которая показывает созданную краткую ссылку.
+func Created(w http.ResponseWriter, r *http.Request, shortURL string) {
+	http.Redirect(w, r, "/?created="+url.QueryEscape(shortURL), http.StatusSeeOther)
+}
@@ -0,0 +1,44 @@
+package webui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jon69/shorturl/internal/app/cookie"
+)
+
+func TestWantsHTML(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Accept", "*/*")
+	assert.False(t, WantsHTML(r))
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.True(t, WantsHTML(r))
+
+	link, domain := ParseForm([]byte("url=http%3A%2F%2Fexample.com%2F%3Fa%3D1&domain=sho.rt"))
+	assert.Equal(t, "http://example.com/?a=1", link)
+	assert.Equal(t, "sho.rt", domain)
+}
+
+func TestServe(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServeIndex(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), AssetsPrefix+"app.js")
+
+	// токен из куки встраивается в форму для отправки без JavaScript
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: cookie.CSRFCookieName, Value: "tok123"})
+	w = httptest.NewRecorder()
+	ServeIndex(w, r)
+	assert.Contains(t, w.Body.String(), `name="csrf_token" value="tok123"`)
+
+	for _, name := range []string{"app.js", "style.css"} {
+		w = httptest.NewRecorder()
+		Assets().ServeHTTP(w, httptest.NewRequest(http.MethodGet, AssetsPrefix+name, nil))
+		assert.Equal(t, http.StatusOK, w.Code, name)
+	}
+}
@@ -19,18 +19,24 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	ShortURL_Ping_FullMethodName    = "/shorturl.ShortURL/Ping"
-	ShortURL_PostURL_FullMethodName = "/shorturl.ShortURL/PostURL"
-	ShortURL_GetURL_FullMethodName  = "/shorturl.ShortURL/GetURL"
+	ShortURL_Ping_FullMethodName     = "/shorturl.ShortURL/Ping"
+	ShortURL_PostURL_FullMethodName  = "/shorturl.ShortURL/PostURL"
+	ShortURL_GetURL_FullMethodName   = "/shorturl.ShortURL/GetURL"
+	ShortURL_GetStats_FullMethodName = "/shorturl.ShortURL/GetStats"
 )
 
 // ShortURLClient is the client API for ShortURL service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ShortURLClient interface {
+	// GET /v1/ping
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
+	// POST /v1/urls
 	PostURL(ctx context.Context, in *PostURLRequest, opts ...grpc.CallOption) (*PostURLResponse, error)
+	// GET /v1/urls/{id}
 	GetURL(ctx context.Context, in *GetURLRequest, opts ...grpc.CallOption) (*GetURLResponse, error)
+	// GET /v1/internal/stats, доступен только из доверенных подсетей
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
 }
 
 type shortURLClient struct {
@@ -68,13 +74,27 @@ func (c *shortURLClient) GetURL(ctx context.Context, in *GetURLRequest, opts ...
 	return out, nil
 }
 
+func (c *shortURLClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, ShortURL_GetStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShortURLServer is the server API for ShortURL service.
 // All implementations must embed UnimplementedShortURLServer
 // for forward compatibility
 type ShortURLServer interface {
+	// GET /v1/ping
 	Ping(context.Context, *PingRequest) (*PingResponse, error)
+	// POST /v1/urls
 	PostURL(context.Context, *PostURLRequest) (*PostURLResponse, error)
+	// GET /v1/urls/{id}
 	GetURL(context.Context, *GetURLRequest) (*GetURLResponse, error)
+	// GET /v1/internal/stats, доступен только из доверенных подсетей
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
 	mustEmbedUnimplementedShortURLServer()
 }
 
@@ -91,6 +111,9 @@ func (UnimplementedShortURLServer) PostURL(context.Context, *PostURLRequest) (*P
 func (UnimplementedShortURLServer) GetURL(context.Context, *GetURLRequest) (*GetURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetURL not implemented")
 }
+func (UnimplementedShortURLServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
 func (UnimplementedShortURLServer) mustEmbedUnimplementedShortURLServer() {}
 
 // UnsafeShortURLServer may be embedded to opt out of forward compatibility for this service.
@@ -158,6 +181,24 @@ func _ShortURL_GetURL_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShortURL_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURL_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ShortURL_ServiceDesc is the grpc.ServiceDesc for ShortURL service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -177,6 +218,285 @@ var ShortURL_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetURL",
 			Handler:    _ShortURL_GetURL_Handler,
 		},
+		{
+			MethodName: "GetStats",
+			Handler:    _ShortURL_GetStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/shorturl.proto",
+}
+
+const (
+	ShortURLAdmin_SearchLinks_FullMethodName    = "/shorturl.ShortURLAdmin/SearchLinks"
+	ShortURLAdmin_DisableLink_FullMethodName    = "/shorturl.ShortURLAdmin/DisableLink"
+	ShortURLAdmin_EnableLink_FullMethodName     = "/shorturl.ShortURLAdmin/EnableLink"
+	ShortURLAdmin_DeleteLink_FullMethodName     = "/shorturl.ShortURLAdmin/DeleteLink"
+	ShortURLAdmin_Takedown_FullMethodName       = "/shorturl.ShortURLAdmin/Takedown"
+	ShortURLAdmin_UserLinkCounts_FullMethodName = "/shorturl.ShortURLAdmin/UserLinkCounts"
+)
+
+// ShortURLAdminClient is the client API for ShortURLAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ShortURLAdminClient interface {
+	SearchLinks(ctx context.Context, in *SearchLinksRequest, opts ...grpc.CallOption) (*SearchLinksResponse, error)
+	DisableLink(ctx context.Context, in *SetLinkStateRequest, opts ...grpc.CallOption) (*SetLinkStateResponse, error)
+	EnableLink(ctx context.Context, in *SetLinkStateRequest, opts ...grpc.CallOption) (*SetLinkStateResponse, error)
+	DeleteLink(ctx context.Context, in *SetLinkStateRequest, opts ...grpc.CallOption) (*SetLinkStateResponse, error)
+	Takedown(ctx context.Context, in *TakedownRequest, opts ...grpc.CallOption) (*TakedownResponse, error)
+	UserLinkCounts(ctx context.Context, in *UserLinkCountsRequest, opts ...grpc.CallOption) (*UserLinkCountsResponse, error)
+}
+
+type shortURLAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewShortURLAdminClient(cc grpc.ClientConnInterface) ShortURLAdminClient {
+	return &shortURLAdminClient{cc}
+}
+
+func (c *shortURLAdminClient) SearchLinks(ctx context.Context, in *SearchLinksRequest, opts ...grpc.CallOption) (*SearchLinksResponse, error) {
+	out := new(SearchLinksResponse)
+	err := c.cc.Invoke(ctx, ShortURLAdmin_SearchLinks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortURLAdminClient) DisableLink(ctx context.Context, in *SetLinkStateRequest, opts ...grpc.CallOption) (*SetLinkStateResponse, error) {
+	out := new(SetLinkStateResponse)
+	err := c.cc.Invoke(ctx, ShortURLAdmin_DisableLink_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortURLAdminClient) EnableLink(ctx context.Context, in *SetLinkStateRequest, opts ...grpc.CallOption) (*SetLinkStateResponse, error) {
+	out := new(SetLinkStateResponse)
+	err := c.cc.Invoke(ctx, ShortURLAdmin_EnableLink_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortURLAdminClient) DeleteLink(ctx context.Context, in *SetLinkStateRequest, opts ...grpc.CallOption) (*SetLinkStateResponse, error) {
+	out := new(SetLinkStateResponse)
+	err := c.cc.Invoke(ctx, ShortURLAdmin_DeleteLink_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortURLAdminClient) Takedown(ctx context.Context, in *TakedownRequest, opts ...grpc.CallOption) (*TakedownResponse, error) {
+	out := new(TakedownResponse)
+	err := c.cc.Invoke(ctx, ShortURLAdmin_Takedown_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortURLAdminClient) UserLinkCounts(ctx context.Context, in *UserLinkCountsRequest, opts ...grpc.CallOption) (*UserLinkCountsResponse, error) {
+	out := new(UserLinkCountsResponse)
+	err := c.cc.Invoke(ctx, ShortURLAdmin_UserLinkCounts_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ShortURLAdminServer is the server API for ShortURLAdmin service.
+// All implementations must embed UnimplementedShortURLAdminServer
+// for forward compatibility
+type ShortURLAdminServer interface {
+	SearchLinks(context.Context, *SearchLinksRequest) (*SearchLinksResponse, error)
+	DisableLink(context.Context, *SetLinkStateRequest) (*SetLinkStateResponse, error)
+	EnableLink(context.Context, *SetLinkStateRequest) (*SetLinkStateResponse, error)
+	DeleteLink(context.Context, *SetLinkStateRequest) (*SetLinkStateResponse, error)
+	Takedown(context.Context, *TakedownRequest) (*TakedownResponse, error)
+	UserLinkCounts(context.Context, *UserLinkCountsRequest) (*UserLinkCountsResponse, error)
+	mustEmbedUnimplementedShortURLAdminServer()
+}
+
+// UnimplementedShortURLAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedShortURLAdminServer struct {
+}
+
+func (UnimplementedShortURLAdminServer) SearchLinks(context.Context, *SearchLinksRequest) (*SearchLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchLinks not implemented")
+}
+func (UnimplementedShortURLAdminServer) DisableLink(context.Context, *SetLinkStateRequest) (*SetLinkStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableLink not implemented")
+}
+func (UnimplementedShortURLAdminServer) EnableLink(context.Context, *SetLinkStateRequest) (*SetLinkStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnableLink not implemented")
+}
+func (UnimplementedShortURLAdminServer) DeleteLink(context.Context, *SetLinkStateRequest) (*SetLinkStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLink not implemented")
+}
+func (UnimplementedShortURLAdminServer) Takedown(context.Context, *TakedownRequest) (*TakedownResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Takedown not implemented")
+}
+func (UnimplementedShortURLAdminServer) UserLinkCounts(context.Context, *UserLinkCountsRequest) (*UserLinkCountsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UserLinkCounts not implemented")
+}
+func (UnimplementedShortURLAdminServer) mustEmbedUnimplementedShortURLAdminServer() {}
+
+// UnsafeShortURLAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ShortURLAdminServer will
+// result in compilation errors.
+type UnsafeShortURLAdminServer interface {
+	mustEmbedUnimplementedShortURLAdminServer()
+}
+
+func RegisterShortURLAdminServer(s grpc.ServiceRegistrar, srv ShortURLAdminServer) {
+	s.RegisterService(&ShortURLAdmin_ServiceDesc, srv)
+}
+
+func _ShortURLAdmin_SearchLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLAdminServer).SearchLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURLAdmin_SearchLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLAdminServer).SearchLinks(ctx, req.(*SearchLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortURLAdmin_DisableLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLAdminServer).DisableLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURLAdmin_DisableLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLAdminServer).DisableLink(ctx, req.(*SetLinkStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortURLAdmin_EnableLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLAdminServer).EnableLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURLAdmin_EnableLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLAdminServer).EnableLink(ctx, req.(*SetLinkStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortURLAdmin_DeleteLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLAdminServer).DeleteLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURLAdmin_DeleteLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLAdminServer).DeleteLink(ctx, req.(*SetLinkStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortURLAdmin_Takedown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TakedownRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLAdminServer).Takedown(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURLAdmin_Takedown_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLAdminServer).Takedown(ctx, req.(*TakedownRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortURLAdmin_UserLinkCounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserLinkCountsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLAdminServer).UserLinkCounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURLAdmin_UserLinkCounts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLAdminServer).UserLinkCounts(ctx, req.(*UserLinkCountsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ShortURLAdmin_ServiceDesc is the grpc.ServiceDesc for ShortURLAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ShortURLAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shorturl.ShortURLAdmin",
+	HandlerType: (*ShortURLAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SearchLinks",
+			Handler:    _ShortURLAdmin_SearchLinks_Handler,
+		},
+		{
+			MethodName: "DisableLink",
+			Handler:    _ShortURLAdmin_DisableLink_Handler,
+		},
+		{
+			MethodName: "EnableLink",
+			Handler:    _ShortURLAdmin_EnableLink_Handler,
+		},
+		{
+			MethodName: "DeleteLink",
+			Handler:    _ShortURLAdmin_DeleteLink_Handler,
+		},
+		{
+			MethodName: "Takedown",
+			Handler:    _ShortURLAdmin_Takedown_Handler,
+		},
+		{
+			MethodName: "UserLinkCounts",
+			Handler:    _ShortURLAdmin_UserLinkCounts_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/shorturl.proto",